@@ -0,0 +1,479 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/olivere/elastic"
+	"github.com/pmdcosta/elklogs/internal/elasticconn"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// completionCacheTTL is how long the indices and fields fetched for completions are reused
+const completionCacheTTL = 5 * time.Minute
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish",
+	Short: "Generate the shell completion script",
+	Long: `Generate the shell completion script.
+Index names, output format fields and document fields are completed from the cluster given in the command line,
+and are cached for a few minutes.
+
+  bash: source <(elklogs completion bash)
+  zsh:  elklogs completion zsh > "${fpath[1]}/_elklogs"
+  fish: elklogs completion fish > ~/.config/fish/completions/elklogs.fish`,
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Args:      cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		script, ok := completionScripts[args[0]]
+		if !ok {
+			rootConfig.logger.WithField("shell", args[0]).Fatal("unsupported shell")
+		}
+		fmt.Print(script)
+	},
+}
+
+// completeCmd is called by the completion scripts with the command line up to the cursor
+var completeCmd = &cobra.Command{
+	Use:                "__complete LINE",
+	Hidden:             true,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, c := range complete(strings.Join(args, " ")) {
+			fmt.Println(c)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+	rootCmd.AddCommand(completeCmd)
+}
+
+// completionScripts holds the completion script of each shell, all of them delegate to the __complete command
+var completionScripts = map[string]string{
+	"bash": `_elklogs() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local IFS=$'\n'
+    COMPREPLY=($(ELKLOGS_COMP_WORD="$cur" elklogs __complete "${COMP_LINE:0:COMP_POINT}" 2>/dev/null))
+}
+complete -o default -F _elklogs elklogs
+`,
+	"zsh": `#compdef elklogs
+_elklogs() {
+    local -a candidates
+    candidates=("${(@f)$(elklogs __complete "${(j: :)words[1,CURRENT]}" 2>/dev/null)}")
+    candidates=(${candidates:#})
+    (( ${#candidates} )) && compadd -U -Q -- "${candidates[@]}"
+}
+compdef _elklogs elklogs
+`,
+	"fish": `function __elklogs_complete
+    elklogs __complete (commandline -cp) 2>/dev/null
+end
+complete -c elklogs -f -a '(__elklogs_complete)'
+`,
+}
+
+// complete returns the candidates for the last word of the command line
+func complete(line string) []string {
+	words := splitLine(line)
+	if len(words) < 2 {
+		return nil
+	}
+	words = words[1:]
+	cur := words[len(words)-1]
+
+	// walk the previous words to find the subcommand, the cluster url and the flags
+	c := rootCmd
+	var positional []string
+	values := make(map[string]string)
+	var pending *pflag.Flag
+	for _, w := range words[:len(words)-1] {
+		if pending != nil {
+			values[pending.Name] = strings.Trim(w, `"'`)
+			pending = nil
+			continue
+		}
+		if strings.HasPrefix(w, "-") {
+			name := strings.TrimLeft(w, "-")
+			if i := strings.Index(name, "="); i >= 0 {
+				if f := lookupFlag(c, name[:i]); f != nil {
+					values[f.Name] = name[i+1:]
+				}
+				continue
+			}
+			if f := lookupFlag(c, name); f != nil && f.NoOptDefVal == "" {
+				pending = f
+			}
+			continue
+		}
+		if c == rootCmd && len(positional) == 0 {
+			if sub := findCommand(w); sub != nil {
+				c = sub
+				continue
+			}
+		}
+		positional = append(positional, w)
+	}
+
+	var url string
+	if len(positional) > 0 {
+		url = positional[0]
+	}
+	source := &completionSource{url: url, user: values["user"], password: values["password"], pattern: rootConfig.indexPattern, timestampField: defaultTimestampField}
+	if p, ok := values["index-pattern"]; ok {
+		source.pattern = p
+	}
+	if f, ok := values["timestamp-field"]; ok {
+		source.timestampField = f
+	}
+
+	// complete the value of a flag
+	if pending != nil {
+		return trimWord(filterPrefix(completeFlag(pending, cur, source), cur), cur)
+	}
+	if strings.HasPrefix(cur, "--") && strings.Contains(cur, "=") {
+		i := strings.Index(cur, "=")
+		if f := lookupFlag(c, cur[2:i]); f != nil {
+			prefix, value := cur[:i+1], cur[i+1:]
+			var result []string
+			for _, v := range filterPrefix(completeFlag(f, value, source), value) {
+				result = append(result, prefix+v)
+			}
+			return trimWord(result, cur)
+		}
+		return nil
+	}
+
+	// complete the flag names
+	if strings.HasPrefix(cur, "-") {
+		var names []string
+		visit := func(f *pflag.Flag) {
+			if !f.Hidden {
+				names = append(names, "--"+f.Name)
+			}
+		}
+		c.Flags().VisitAll(visit)
+		c.InheritedFlags().VisitAll(visit)
+		if c == rootCmd {
+			c.PersistentFlags().VisitAll(visit)
+		}
+		sort.Strings(names)
+		return filterPrefix(names, cur)
+	}
+
+	// complete the arguments
+	if c == rootCmd && len(positional) == 0 {
+		var names []string
+		for _, sub := range rootCmd.Commands() {
+			if sub.IsAvailableCommand() {
+				names = append(names, sub.Name())
+			}
+		}
+		return filterPrefix(names, cur)
+	}
+	if len(c.ValidArgs) > 0 {
+		return filterPrefix(c.ValidArgs, cur)
+	}
+	return nil
+}
+
+// completionAnnotation is the flag annotation registering how the values of the flag are completed,
+// the kind of completion followed by its arguments
+const completionAnnotation = "elklogs_completion"
+
+// kinds of flag value completions
+const (
+	completeIndices = "indices" // index names
+	completeFormat  = "format"  // output format, completing the %field being typed
+	completeFields  = "fields"  // comma separated field names
+	completeValues  = "values"  // most frequent values of the field given as argument
+	completeChoices = "choices" // the values given as arguments
+)
+
+// registerCompletion registers how the values of the flag are completed
+func registerCompletion(flags *pflag.FlagSet, name string, kind string, args ...string) {
+	if err := flags.SetAnnotation(name, completionAnnotation, append([]string{kind}, args...)); err != nil {
+		panic(err)
+	}
+}
+
+// completeFlag returns the candidates for the value of the flag, as registered in its annotation
+func completeFlag(f *pflag.Flag, cur string, source *completionSource) []string {
+	completion := f.Annotations[completionAnnotation]
+	if len(completion) == 0 {
+		return nil
+	}
+
+	// values can be quoted, since the shell keeps the quote in the current word
+	var quote string
+	if strings.HasPrefix(cur, `"`) || strings.HasPrefix(cur, `'`) {
+		quote, cur = cur[:1], cur[1:]
+	}
+
+	var candidates []string
+	switch kind, args := completion[0], completion[1:]; kind {
+	case completeIndices:
+		candidates = source.indices()
+	case completeFormat:
+		// complete the format field being typed
+		prefix := cur
+		if i := strings.LastIndex(cur, "%"); i >= 0 {
+			prefix = cur[:i]
+		}
+		for _, name := range source.fields() {
+			candidates = append(candidates, prefix+"%"+name)
+		}
+	case completeFields:
+		// complete the last of the comma separated fields
+		var prefix string
+		if i := strings.LastIndex(cur, ","); i >= 0 {
+			prefix = cur[:i+1]
+		}
+		for _, name := range source.fields() {
+			candidates = append(candidates, prefix+name)
+		}
+	case completeValues:
+		if len(args) > 0 {
+			candidates = source.values(args[0])
+		}
+	case completeChoices:
+		candidates = append(candidates, args...)
+	}
+
+	if quote == "" {
+		return candidates
+	}
+	for i := range candidates {
+		candidates[i] = quote + candidates[i]
+	}
+	return candidates
+}
+
+// splitLine splits the command line in words, keeping quoted words together along with their quotes.
+// The last word is empty when the line ends with a space.
+func splitLine(line string) []string {
+	var words []string
+	var word []rune
+	var quote rune
+	inWord := false
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, string(word))
+				word, inWord = word[:0], false
+			}
+			continue
+		}
+		word = append(word, r)
+		inWord = true
+	}
+	return append(words, string(word))
+}
+
+// trimWord trims the candidates to the word being completed as seen by the shell,
+// since bash also splits words on characters such as ':'
+func trimWord(candidates []string, cur string) []string {
+	word, ok := os.LookupEnv("ELKLOGS_COMP_WORD")
+	if !ok || !strings.HasSuffix(cur, word) {
+		return candidates
+	}
+	strip := len(cur) - len(word)
+	for i := range candidates {
+		candidates[i] = candidates[i][strip:]
+	}
+	return candidates
+}
+
+// lookupFlag finds a flag of the command by name or shorthand
+func lookupFlag(c *cobra.Command, name string) *pflag.Flag {
+	for _, flags := range []*pflag.FlagSet{c.Flags(), c.PersistentFlags(), c.InheritedFlags()} {
+		if f := flags.Lookup(name); f != nil {
+			return f
+		}
+		if len(name) == 1 {
+			if f := flags.ShorthandLookup(name); f != nil {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// findCommand finds a subcommand of the root command by name
+func findCommand(name string) *cobra.Command {
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// filterPrefix returns the values starting with the prefix
+func filterPrefix(values []string, prefix string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// completionSource fetches the dynamic completions from the cluster, caching them on disk
+type completionSource struct {
+	url      string
+	user     string
+	password string
+	pattern  string
+
+	timestampField string
+
+	conn   connector
+	dialed bool
+}
+
+// completionDialTimeout bounds the connection to the cluster, so completing does not hang on unreachable ones
+const completionDialTimeout = time.Second
+
+// connect lazily connects to the cluster or opens the files once, returning nil if they are not reachable
+func (s *completionSource) connect() connector {
+	if s.dialed || s.url == "" {
+		return s.conn
+	}
+	s.dialed = true
+	dialer := &net.Dialer{Timeout: completionDialTimeout}
+	s.conn, _ = newConnector(s.url, s.user, s.password, nil, nil, elasticconn.OverrideElasticConfig([]elastic.ClientOptionFunc{
+		elastic.SetHealthcheckTimeoutStartup(completionDialTimeout),
+		elastic.SetHealthcheckTimeout(completionDialTimeout),
+		elastic.SetHttpClient(&http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}),
+	}))
+	return s.conn
+}
+
+// indices returns the index names of the cluster
+func (s *completionSource) indices() []string {
+	return s.cached("indices", func() ([]string, error) {
+		c := s.connect()
+		if c == nil {
+			return nil, fmt.Errorf("not connected")
+		}
+		return c.GetIndexNames(context.Background())
+	})
+}
+
+// fields returns the fields mapped in the indices matching the pattern
+func (s *completionSource) fields() []string {
+	return s.cached("fields", func() ([]string, error) {
+		c := s.connect()
+		if c == nil {
+			return nil, fmt.Errorf("not connected")
+		}
+		indices, err := c.GetIndexNames(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		indices = tail.MatchIndex(indices, s.pattern)
+		if len(indices) == 0 {
+			return nil, nil
+		}
+		mappings, err := c.GetMappings(context.Background(), indices)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, f := range tail.MergeFields(mappings) {
+			if f.Types["object"] == nil && f.Types["nested"] == nil {
+				names = append(names, f.Name)
+			}
+		}
+		return names, nil
+	})
+}
+
+// values returns the most frequent values of the field in the latest index matching the pattern
+func (s *completionSource) values(field string) []string {
+	return s.cached("values:"+field, func() ([]string, error) {
+		c := s.connect()
+		if c == nil {
+			return nil, fmt.Errorf("not connected")
+		}
+		indices, err := c.GetIndexNames(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		indices, err = tail.FilterIndex(indices, s.pattern, nil, nil)
+		if err != nil || len(indices) == 0 || indices[0] == "" {
+			return nil, err
+		}
+		terms, _, err := c.Terms(context.Background(), indices, s.timestampField, "", nil, nil, field, 100, "", 0)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]string, 0, len(terms))
+		for _, t := range terms {
+			values = append(values, t.Value)
+		}
+		return values, nil
+	})
+}
+
+// completionCache is the on disk format of the cached completions
+type completionCache struct {
+	Time   time.Time `json:"time"`
+	Values []string  `json:"values"`
+}
+
+// cached returns the values cached for the kind of completion, fetching them again once expired
+func (s *completionSource) cached(kind string, fetch func() ([]string, error)) []string {
+	if s.url == "" {
+		return nil
+	}
+
+	var path string
+	if dir, err := os.UserCacheDir(); err == nil {
+		key := sha1.Sum([]byte(strings.Join([]string{s.url, s.user, s.pattern, kind}, "\n")))
+		path = filepath.Join(dir, "elklogs", "completion-"+hex.EncodeToString(key[:]))
+
+		var cache completionCache
+		if b, err := ioutil.ReadFile(path); err == nil && json.Unmarshal(b, &cache) == nil && time.Since(cache.Time) < completionCacheTTL {
+			return cache.Values
+		}
+	}
+
+	// failures are cached too, so each completion does not wait for an unreachable cluster again
+	values, err := fetch()
+	if err != nil {
+		values = nil
+	}
+	if path != "" {
+		if b, err := json.Marshal(completionCache{Time: time.Now(), Values: values}); err == nil {
+			if os.MkdirAll(filepath.Dir(path), 0700) == nil {
+				ioutil.WriteFile(path, b, 0600)
+			}
+		}
+	}
+	return values
+}
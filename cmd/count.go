@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// countConfig holds the configs for the count and histogram cmds
+var countConfig struct {
+	after          string
+	before         string
+	query          string
+	timestampField string
+	output         string
+
+	// histogram
+	histogramOutput string
+	interval        string
+	splitBy         string
+	splitSize       int
+}
+
+var countCmd = &cobra.Command{
+	Use:   "count URL",
+	Short: "Count the logs matching the query",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		count(args)
+	},
+}
+
+var histogramCmd = &cobra.Command{
+	Use:   "histogram URL",
+	Short: "Count the logs matching the query by time interval",
+	Long: `Count the logs matching the query by time interval,
+drawn as a bar chart or sparkline scaled to the terminal width.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		histogram(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(countCmd)
+	rootCmd.AddCommand(histogramCmd)
+
+	for _, c := range []*cobra.Command{countCmd, histogramCmd} {
+		c.Flags().StringVarP(&countConfig.after, "after", "a", "", `Count logs after specified date or duration before now (example: -a "2016-06-17T15:00" or -a=-1h)`)
+		c.Flags().StringVarP(&countConfig.before, "before", "b", "", `Count logs before specified date or duration before now (example: -b "2016-06-17T15:00" or -b=-30m)`)
+		c.Flags().StringVarP(&countConfig.query, "query", "q", "", `Elastic query string search (example: -q "host:myhost.example.com AND level:error")`)
+		c.Flags().StringVar(&countConfig.timestampField, "timestamp-field", defaultTimestampField, `Timestamp field name in the database`)
+		addKubernetesFlags(c)
+	}
+	countCmd.Flags().StringVarP(&countConfig.output, "output", "o", "table", "Output format, table or json")
+	registerCompletion(countCmd.Flags(), "output", completeChoices, "table", "json")
+	histogramCmd.Flags().StringVarP(&countConfig.histogramOutput, "output", "o", "bars", "Output format, bars, sparkline, table or json")
+	registerCompletion(histogramCmd.Flags(), "output", completeChoices, "bars", "sparkline", "table", "json")
+	histogramCmd.Flags().StringVar(&countConfig.interval, "interval", "1m", "Histogram interval (example: --interval 1h)")
+	histogramCmd.Flags().StringVar(&countConfig.splitBy, "split-by", "", `Split the counts by the most frequent values of the field (example: --split-by "host")`)
+	registerCompletion(histogramCmd.Flags(), "split-by", completeFields)
+	histogramCmd.Flags().IntVar(&countConfig.splitSize, "split-size", 5, "Number of values of the split field to show")
+}
+
+// countQuery connects to the cluster or opens the files and selects the indices for the count query
+func countQuery(url string) (connector, *domain.Query, []string) {
+	q := &domain.Query{
+		IndexPattern:   rootConfig.indexPattern,
+		AfterDateTime:  parseDate(countConfig.after, "after"),
+		BeforeDateTime: parseDate(countConfig.before, "before"),
+		Query:          kubernetesQuery(countConfig.query),
+		TimestampField: countConfig.timestampField,
+	}
+
+	c := logsConnector(url, nil, nil)
+	indices, err := tail.New(rootConfig.logger, c).Indices(context.Background(), q)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not select indices")
+	}
+	return c, q, indices
+}
+
+func count(args []string) {
+	if countConfig.output != "table" && countConfig.output != "json" {
+		rootConfig.logger.WithFields(logrus.Fields{"output": countConfig.output}).Fatal("invalid output format")
+	}
+
+	c, q, indices := countQuery(args[0])
+	n, err := c.Count(context.Background(), indices, q.TimestampField, q.Query, q.AfterDateTime, q.BeforeDateTime)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not count logs")
+	}
+
+	if countConfig.output == "json" {
+		fmt.Printf("{\"count\":%d}\n", n)
+		return
+	}
+	fmt.Println(n)
+}
+
+func histogram(args []string) {
+	switch countConfig.histogramOutput {
+	case "bars", "sparkline", "table", "json":
+	default:
+		rootConfig.logger.WithFields(logrus.Fields{"output": countConfig.histogramOutput}).Fatal("invalid output format")
+	}
+
+	c, q, indices := countQuery(args[0])
+	buckets, err := c.Histogram(context.Background(), indices, q.TimestampField, q.Query, q.AfterDateTime, q.BeforeDateTime, countConfig.interval, countConfig.splitBy, countConfig.splitSize)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not count logs")
+	}
+
+	switch countConfig.histogramOutput {
+	case "json":
+		b, err := json.MarshalIndent(buckets, "", "  ")
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not encode the histogram")
+		}
+		fmt.Println(string(b))
+	case "sparkline":
+		fmt.Println(tail.Sparkline(buckets))
+	case "bars":
+		for _, l := range tail.BarChart(buckets, terminalWidth()) {
+			fmt.Println(l)
+		}
+	default:
+		series := tail.SeriesNames(buckets)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprint(w, "TIME\tCOUNT")
+		for _, s := range series {
+			fmt.Fprintf(w, "\t%s", s)
+		}
+		fmt.Fprintln(w)
+		for _, b := range buckets {
+			fmt.Fprintf(w, "%s\t%d", b.Time.Format("2006-01-02T15:04:05"), b.Count)
+			for _, s := range series {
+				fmt.Fprintf(w, "\t%d", b.Series[s])
+			}
+			fmt.Fprintln(w)
+		}
+		w.Flush()
+	}
+}
+
+// terminalWidth returns the width of the terminal, falling back to $COLUMNS or 80 columns
+func terminalWidth() int {
+	if w, _, err := terminal.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return 80
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/patterns"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// diffConfig holds the configs for the diff cmd
+var diffConfig struct {
+	baseline       string
+	current        string
+	query          string
+	timestampField string
+	by             string
+	size           int
+	field          string
+	entries        int
+	similarity     float64
+	output         string
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff URL",
+	Short: "Compare the logs of two time windows",
+	Long: `Compare the logs matching the query in a baseline and a current time window,
+reporting the change in volume, the values of a field whose share shifted the most,
+and the message patterns only seen in the current window.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		diff(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().StringVar(&diffConfig.baseline, "baseline", "-1h..-30m", `Baseline time window (example: --baseline "2016-06-17T15:00..2016-06-17T16:00")`)
+	diffCmd.Flags().StringVar(&diffConfig.current, "current", "-30m..now", `Current time window (example: --current "-30m..now")`)
+	diffCmd.Flags().StringVarP(&diffConfig.query, "query", "q", "", `Elastic query string search (example: -q "host:myhost.example.com AND level:error")`)
+	diffCmd.Flags().StringVar(&diffConfig.timestampField, "timestamp-field", defaultTimestampField, `Timestamp field name in the database`)
+	diffCmd.Flags().StringVar(&diffConfig.by, "by", "", `Compare the most frequent values of the field (example: --by "kubernetes.pod.name")`)
+	registerCompletion(diffCmd.Flags(), "by", completeFields)
+	diffCmd.Flags().IntVarP(&diffConfig.size, "size", "k", 10, "Number of values and patterns to show")
+	diffCmd.Flags().StringVar(&diffConfig.field, "field", "message", "Field holding the message to group in patterns")
+	registerCompletion(diffCmd.Flags(), "field", completeFields)
+	diffCmd.Flags().IntVarP(&diffConfig.entries, "entries", "n", 1000, "Number of logs of each window grouped in patterns (0 skips the patterns)")
+	diffCmd.Flags().Float64Var(&diffConfig.similarity, "similarity", 0.5, "Minimum ratio of equal tokens for a message to join a pattern")
+	diffCmd.Flags().StringVarP(&diffConfig.output, "output", "o", "table", "Output format, table or json")
+	registerCompletion(diffCmd.Flags(), "output", completeChoices, "table", "json")
+	addKubernetesFlags(diffCmd)
+}
+
+// diffWindow is a time window of the comparison
+type diffWindow struct {
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+	Count int64      `json:"count"`
+
+	query   *domain.Query
+	indices []string
+}
+
+// diffResult is the output of the diff cmd
+type diffResult struct {
+	Baseline *diffWindow        `json:"baseline"`
+	Current  *diffWindow        `json:"current"`
+	Change   *float64           `json:"change"` // missing when there were no baseline logs
+	Values   []*tail.TermChange `json:"values,omitempty"`
+	Patterns []patternRow       `json:"new_patterns,omitempty"`
+}
+
+func diff(args []string) {
+	if diffConfig.output != "table" && diffConfig.output != "json" {
+		rootConfig.logger.WithFields(logrus.Fields{"output": diffConfig.output}).Fatal("invalid output format")
+	}
+
+	diffConfig.query = kubernetesQuery(diffConfig.query)
+
+	c := logsConnector(args[0], nil, nil)
+	defer c.Close()
+	t := tail.New(rootConfig.logger, c)
+
+	ctx := context.Background()
+	baseline := newDiffWindow(ctx, t, diffConfig.baseline, "baseline")
+	current := newDiffWindow(ctx, t, diffConfig.current, "current")
+
+	r := &diffResult{Baseline: baseline, Current: current}
+	for _, w := range []*diffWindow{baseline, current} {
+		var err error
+		if w.Count, err = c.Count(ctx, w.indices, diffConfig.timestampField, diffConfig.query, w.Start, w.End); err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not count logs")
+		}
+	}
+	if change, ok := tail.Change(baseline.Count, current.Count); ok {
+		r.Change = &change
+	}
+
+	if diffConfig.by != "" {
+		r.Values = compareValues(ctx, c, baseline, current)
+	}
+	if diffConfig.entries > 0 {
+		r.Patterns = newPatterns(ctx, t, baseline, current)
+	}
+	printDiff(r)
+}
+
+// newDiffWindow parses the time window and selects its indices
+func newDiffWindow(ctx context.Context, t *tail.Tail, value string, name string) *diffWindow {
+	start, end, err := tail.ParseRange(value, time.Now())
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatalf("invalid %s window", name)
+	}
+	w := &diffWindow{Start: start, End: end}
+	w.query = &domain.Query{
+		IndexPattern:   rootConfig.indexPattern,
+		AfterDateTime:  start,
+		BeforeDateTime: end,
+		Query:          diffConfig.query,
+		Entries:        diffConfig.entries,
+	}
+	if w.indices, err = t.Indices(ctx, w.query); err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not select indices")
+	}
+	return w
+}
+
+// compareValues compares the most frequent values of the field in both windows
+func compareValues(ctx context.Context, c connector, baseline *diffWindow, current *diffWindow) []*tail.TermChange {
+	terms := make([][]*domain.Term, 0, 2)
+	for _, w := range []*diffWindow{baseline, current} {
+		r, _, err := c.Terms(ctx, w.indices, diffConfig.timestampField, diffConfig.query, w.Start, w.End, diffConfig.by, diffConfig.size, "", 0)
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err, "field": diffConfig.by}).Fatal("could not count the field values")
+		}
+		terms = append(terms, r)
+	}
+	changes := tail.CompareTerms(terms[0], baseline.Count, terms[1], current.Count)
+	if len(changes) > diffConfig.size {
+		changes = changes[:diffConfig.size]
+	}
+	return changes
+}
+
+// newPatterns groups the messages of both windows, returning the patterns that only appear in the current one
+func newPatterns(ctx context.Context, t *tail.Tail, baseline *diffWindow, current *diffWindow) []patternRow {
+	m := patterns.NewMiner(diffConfig.similarity, 1)
+	var created []*patterns.Template
+	for _, w := range []*diffWindow{baseline, current} {
+		if err := t.Reset(w.query); err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("invalid query")
+		}
+		logs, err := t.Fetch(ctx, w.query, w.indices)
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not fetch logs")
+		}
+		for _, l := range logs {
+			message, err := tail.FieldValue(l.Message, diffConfig.field)
+			if err != nil {
+				continue
+			}
+			if tpl, ok := m.Add(strings.TrimSpace(message)); ok && w == current {
+				created = append(created, tpl)
+			}
+		}
+	}
+
+	// the most frequent new patterns first, as counted in the current window
+	rows := make([]patternRow, 0, len(created))
+	for _, tpl := range m.Templates() {
+		for _, c := range created {
+			if tpl == c {
+				rows = append(rows, patternRow{Template: tpl, Pattern: tpl.String(), New: true})
+			}
+		}
+	}
+	if len(rows) > diffConfig.size {
+		rows = rows[:diffConfig.size]
+	}
+	return rows
+}
+
+func printDiff(r *diffResult) {
+	if diffConfig.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(r); err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not encode the diff")
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WINDOW\tRANGE\tLOGS\tCHANGE")
+	fmt.Fprintf(w, "baseline\t%s\t%d\t\n", diffConfig.baseline, r.Baseline.Count)
+	fmt.Fprintf(w, "current\t%s\t%d\t%s\n", diffConfig.current, r.Current.Count, formatChange(r.Baseline.Count, r.Current.Count))
+	w.Flush()
+
+	if len(r.Values) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "%s\tBASELINE\tCURRENT\tCHANGE\tSHARE\tSHIFT\n", strings.ToUpper(diffConfig.by))
+		for _, v := range r.Values {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%.1f%% → %.1f%%\t%+.1fpp\n", v.Value, v.Baseline, v.Current, formatChange(v.Baseline, v.Current), v.BaselineShare, v.CurrentShare, v.Shift())
+		}
+		w.Flush()
+	}
+
+	if len(r.Patterns) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "COUNT\tNEW PATTERN")
+		for _, p := range r.Patterns {
+			fmt.Fprintf(w, "%d\t%s\n", p.Count, p.Pattern)
+			for _, e := range p.Examples {
+				fmt.Fprintf(w, "\t  e.g. %s\n", e)
+			}
+		}
+		w.Flush()
+	}
+}
+
+// formatChange formats the relative change of the number of logs
+func formatChange(baseline int64, current int64) string {
+	change, ok := tail.Change(baseline, current)
+	if !ok {
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", change)
+}
@@ -1,21 +1,44 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/pmdcosta/elklogs/internal/domain"
 	"github.com/pmdcosta/elklogs/internal/elasticconn"
+	"github.com/pmdcosta/elklogs/internal/fileconn"
 	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/pmdcosta/elklogs/pkg/elklogs"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+// exit codes, so scripts can branch on how elklogs stopped
+const (
+	exitError      = 1 // the query failed
+	exitTimeout    = 2 // the timeout was reached before any other stop condition
+	exitMatched    = 3 // the until pattern matched with --fail-on-match
+	exitNotMatched = 4 // the logs ended before the until pattern matched, without following
+)
+
 var rootCmd = &cobra.Command{
-	Use:     "elklogs",
-	Short:   "elklogs query and tail ELK logs from the terminal",
+	Use:   "elklogs",
+	Short: "elklogs query and tail ELK logs from the terminal",
+	Long: `elklogs query and tail ELK logs from the terminal
+
+Logs exported to files can be queried instead of a cluster with a file:// URL
+followed by a glob pattern, such as file://logs-*.ndjson.gz.
+
+Exit codes:
+  0  logs retrieved, --until-match matched or --max-lines reached
+  1  the query failed
+  2  --timeout reached
+  3  --until-match matched with --fail-on-match
+  4  --until-match did not match before the logs ended, without -f`,
 	Version: version,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
@@ -31,7 +54,7 @@ var rootCmd = &cobra.Command{
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 }
 
@@ -39,18 +62,20 @@ func Execute() {
 var rootConfig struct {
 	logger *logrus.Entry
 	debug  bool
-}
 
-// logsConfig holds the configs for the logs cmd
-var logsConfig struct {
 	// auth
 	user     string
 	password string
 
+	// indices
+	indexPattern string
+}
+
+// logsConfig holds the configs for the logs cmd
+var logsConfig struct {
 	// query
 	after          string
 	before         string
-	indexPattern   string
 	query          string
 	format         string
 	timestampField string
@@ -61,6 +86,34 @@ var logsConfig struct {
 	entries  int
 	refresh  time.Duration
 	showTime bool
+	parallel int
+
+	// client side filters
+	grep       string
+	grepInvert string
+	grepField  string
+
+	// surrounding logs
+	contextAfter  int
+	contextBefore int
+	contextLines  int
+	contextBy     string
+
+	// correlated logs
+	correlateBy  string
+	serviceField string
+
+	// multi-line grouping
+	multiline         bool
+	multilinePatterns []string
+	multilineBy       []string
+	multilineField    string
+
+	// stop conditions
+	untilMatch  string
+	failOnMatch bool
+	maxLines    int
+	timeout     time.Duration
 }
 
 func init() {
@@ -68,25 +121,65 @@ func init() {
 
 	// persistent flags
 	rootCmd.PersistentFlags().BoolVar(&rootConfig.debug, "debug", false, "Enable debug logs")
+	rootCmd.PersistentFlags().StringVarP(&rootConfig.user, "user", "u", "", "Elastic search basic auth user")
+	rootCmd.PersistentFlags().StringVarP(&rootConfig.password, "password", "p", "", "Elastic search basic auth password")
+	rootCmd.PersistentFlags().StringVar(&rootConfig.indexPattern, "index-pattern", "logstash-[0-9].*", "Only log indices that match the pattern will be retrieved")
+	registerCompletion(rootCmd.PersistentFlags(), "index-pattern", completeIndices)
 
 	// behavior flags
 	rootCmd.Flags().BoolVarP(&logsConfig.follow, "follow", "f", false, "Follow log output")
 	rootCmd.Flags().IntVarP(&logsConfig.entries, "entries", "n", 50, "Number of lines to show from the end of the logs")
+	rootCmd.Flags().IntVar(&logsConfig.parallel, "parallel", 0, "Number of indices to query concurrently, merging the results by timestamp (0 runs a single search)")
+
+	// client side filter flags
+	rootCmd.Flags().StringVar(&logsConfig.grep, "grep", "", `Only show logs matching the regexp, evaluated on the output line (example: --grep "(?i)timeout")`)
+	rootCmd.Flags().StringVar(&logsConfig.grepInvert, "grep-v", "", "Hide logs matching the regexp, evaluated on the output line")
+	rootCmd.Flags().StringVar(&logsConfig.grepField, "grep-field", "", `Evaluate --grep and --grep-v on the field instead of the output line (example: --grep-field "message")`)
+	registerCompletion(rootCmd.Flags(), "grep-field", completeFields)
 
-	// connection flags
-	rootCmd.Flags().StringVarP(&logsConfig.user, "user", "u", "", "Elastic search basic auth user")
-	rootCmd.Flags().StringVarP(&logsConfig.password, "password", "p", "", "Elastic search basic auth password")
+	// surrounding logs flags
+	rootCmd.Flags().IntVarP(&logsConfig.contextAfter, "after-context", "A", 0, "Print the number of logs after each match")
+	rootCmd.Flags().IntVarP(&logsConfig.contextBefore, "before-context", "B", 0, "Print the number of logs before each match")
+	rootCmd.Flags().IntVarP(&logsConfig.contextLines, "context-lines", "C", 0, "Print the number of logs before and after each match")
+	rootCmd.Flags().StringVar(&logsConfig.contextBy, "context-by", "", `Only print surrounding logs sharing the field value with the match (example: --context-by "kubernetes.pod.name")`)
+	registerCompletion(rootCmd.Flags(), "context-by", completeFields)
+
+	// stop flags
+	rootCmd.Flags().StringVar(&logsConfig.untilMatch, "until-match", "", `Stop after the first log matching the query string or /regexp/ (example: --until-match "/Started application/")`)
+	rootCmd.Flags().BoolVar(&logsConfig.failOnMatch, "fail-on-match", false, "Exit with an error code when --until-match matches")
+	rootCmd.Flags().IntVar(&logsConfig.maxLines, "max-lines", 0, "Stop after printing the number of lines (0 is unlimited)")
+	rootCmd.Flags().DurationVar(&logsConfig.timeout, "timeout", 0, `Stop with an error code after the duration (example: --timeout 5m)`)
 
 	// query flags
-	rootCmd.Flags().StringVarP(&logsConfig.after, "after", "a", "", `Get logs after specified date (example: -a "2016-06-17T15:00")`)
-	rootCmd.Flags().StringVarP(&logsConfig.before, "before", "b", "", `Get logs before specified date (example: -a "2016-06-17T15:00")`)
-	rootCmd.Flags().StringVar(&logsConfig.indexPattern, "index-pattern", "logstash-[0-9].*", "Only log indices that match the pattern will be retrieved")
+	rootCmd.Flags().StringVarP(&logsConfig.after, "after", "a", "", `Get logs after specified date or duration before now (example: -a "2016-06-17T15:00" or -a=-1h)`)
+	rootCmd.Flags().StringVarP(&logsConfig.before, "before", "b", "", `Get logs before specified date or duration before now (example: -b "2016-06-17T15:00" or -b=-30m)`)
 	rootCmd.Flags().BoolVarP(&logsConfig.reverse, "reverse", "r", false, "Show the newest entries first")
 	rootCmd.Flags().StringVarP(&logsConfig.query, "query", "q", "", `Elastic query string search (example: -q "host:myhost.example.com AND level:error")`)
 	rootCmd.Flags().DurationVar(&logsConfig.refresh, "refresh", 1*time.Second, `Refresh interval (example: --refresh 1s)`)
 	rootCmd.Flags().StringVarP(&logsConfig.format, "output", "o", "", `Output format (example: -o "%timestamp: %log")`)
-	rootCmd.Flags().StringVar(&logsConfig.timestampField, "timestamp-field", "@timestamp", `Timestamp field name in the database`)
+	registerCompletion(rootCmd.Flags(), "output", completeFormat)
+	rootCmd.Flags().StringVar(&logsConfig.timestampField, "timestamp-field", defaultTimestampField, `Timestamp field name in the database`)
 	rootCmd.Flags().BoolVarP(&logsConfig.showTime, "timestamp", "t", false, "Show timestamp before the log")
+
+	// correlation flags
+	rootCmd.Flags().StringVar(&logsConfig.correlateBy, "correlate-by", "", `Print the logs sharing the field with each log, across all indices (example: --correlate-by "trace.id")`)
+	registerCompletion(rootCmd.Flags(), "correlate-by", completeFields)
+	rootCmd.Flags().StringVar(&logsConfig.serviceField, "service-field", "service.name", "Field the correlated logs are grouped by")
+	registerCompletion(rootCmd.Flags(), "service-field", completeFields)
+
+	// multi-line flags
+	rootCmd.Flags().BoolVar(&logsConfig.multiline, "multiline", false, "Group the lines of stack traces with the previous log of the same source")
+	rootCmd.Flags().StringArrayVar(&logsConfig.multilinePatterns, "multiline-pattern", nil, `Regexp matching the continuation lines, replacing the default Java and Python rules (example: --multiline-pattern "^\s")`)
+	rootCmd.Flags().StringSliceVar(&logsConfig.multilineBy, "multiline-by", []string{"host.name", "kubernetes.pod.name", "stream"}, "Fields identifying the source of the lines")
+	registerCompletion(rootCmd.Flags(), "multiline-by", completeFields)
+	rootCmd.Flags().StringVar(&logsConfig.multilineField, "multiline-field", "message", "Field the continuation patterns apply to")
+	registerCompletion(rootCmd.Flags(), "multiline-field", completeFields)
+
+	// kubernetes flags
+	addKubernetesFlags(rootCmd)
+
+	// output file flags
+	addOutputFlags(rootCmd)
 }
 
 // initLogger sets up the application logger
@@ -97,23 +190,96 @@ func initLogger() {
 	}
 }
 
-func run(args []string) {
-	// parse query time filters
-	var after *time.Time
-	var before *time.Time
-	if logsConfig.after != "" {
-		a, err := time.Parse("2006-01-02T15:04", logsConfig.after)
-		if err != nil {
-			rootConfig.logger.WithFields(logrus.Fields{"err": err, "date": logsConfig.after}).Fatal("invalid after date")
-		}
-		after = &a
+// isTerminal checks if the file is a terminal, to decide if the output can be colored
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// defaultTimestampField is the default timestamp field of the logs
+const defaultTimestampField = "@timestamp"
+
+// fileURLPrefix prefixes the glob pattern of the files queried instead of a cluster
+const fileURLPrefix = "file://"
+
+// connector queries the logs of the cluster or of the files, *elasticconn.Elastic or *fileconn.Files
+type connector interface {
+	tail.CountConnector
+	GetIndices(ctx context.Context) ([]*domain.Index, error)
+	GetMappings(ctx context.Context, indices []string) (map[string][]*domain.Field, error)
+	GetDocument(ctx context.Context, index string, id string, fields []string) (*domain.Document, error)
+	FindDocument(ctx context.Context, indices []string, id string) ([]string, error)
+	Histogram(ctx context.Context, indices []string, timestampField string, query string, after *time.Time, before *time.Time, interval string, splitBy string, splitSize int) ([]*domain.Bucket, error)
+	Terms(ctx context.Context, indices []string, timestampField string, query string, after *time.Time, before *time.Time, field string, size int, subField string, subSize int) ([]*domain.Term, int64, error)
+}
+
+// logsConnector creates the connector of the url, the files of file:// urls or the elastic cluster.
+// The time range only applies to the files, skipping their documents outside it: with a cluster,
+// the logs command only uses it to select the daily indices to query.
+func logsConnector(url string, after *time.Time, before *time.Time) connector {
+	c, err := newConnector(url, rootConfig.user, rootConfig.password, after, before)
+	if err != nil && strings.HasPrefix(url, fileURLPrefix) {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err, "url": url}).Fatal("failed to open log files")
 	}
-	if logsConfig.before != "" {
-		b, err := time.Parse("2006-01-02T15:04", logsConfig.before)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err, "url": url}).Fatal("failed to connect to elastic cluster")
+	}
+	return c
+}
+
+// newConnector creates the connector of the url, the elastic options only applying to clusters
+func newConnector(url string, user string, password string, after *time.Time, before *time.Time, options ...elasticconn.ElasticOptionFunc) (connector, error) {
+	if strings.HasPrefix(url, fileURLPrefix) {
+		c, err := fileconn.New(strings.TrimPrefix(url, fileURLPrefix), fileconn.Config{After: after, Before: before})
 		if err != nil {
-			rootConfig.logger.WithFields(logrus.Fields{"err": err, "date": logsConfig.before}).Fatal("invalid before date")
+			return nil, err
 		}
-		before = &b
+		return c, nil
+	}
+	c, err := elasticconn.New(url, user, password, options...)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// libraryConnector creates the library connector of the url, the files of file:// urls or the elastic cluster
+func libraryConnector(url string) elklogs.Connector {
+	var c elklogs.Connector
+	var err error
+	if strings.HasPrefix(url, fileURLPrefix) {
+		c, err = elklogs.NewFileConnector(strings.TrimPrefix(url, fileURLPrefix))
+	} else {
+		c, err = elklogs.NewElasticConnector(url, rootConfig.user, rootConfig.password)
+	}
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err, "url": url}).Fatal("failed to connect to elastic cluster")
+	}
+	return c
+}
+
+// parseDate parses a query time filter, returning nil if it is not set.
+// Besides dates, "now" and negative durations relative to now (such as -1h) are accepted.
+func parseDate(value string, name string) *time.Time {
+	d, err := tail.ParseDate(value, time.Now())
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err, "date": value}).Fatalf("invalid %s date", name)
+	}
+	return d
+}
+
+func run(args []string) {
+	// parse query time filters
+	after := parseDate(logsConfig.after, "after")
+	before := parseDate(logsConfig.before, "before")
+
+	// logs of kubernetes workloads are prefixed with namespace/pod[container] by default
+	query := kubernetesQuery(logsConfig.query)
+	if logsConfig.format == "" && !kubernetesConfig.filter.Empty() {
+		logsConfig.format = tail.KubernetesFormat(kubernetesFields(), "message")
 	}
 
 	// parse output format
@@ -122,36 +288,82 @@ func run(args []string) {
 		rootConfig.logger.WithFields(logrus.Fields{"format": logsConfig.format}).Fatal("invalid output format")
 	}
 
+	if logsConfig.failOnMatch && logsConfig.untilMatch == "" {
+		rootConfig.logger.Fatal("--fail-on-match requires --until-match")
+	}
+
+	// -A and -B take precedence over -C
+	if logsConfig.contextAfter == 0 {
+		logsConfig.contextAfter = logsConfig.contextLines
+	}
+	if logsConfig.contextBefore == 0 {
+		logsConfig.contextBefore = logsConfig.contextLines
+	}
+
+	// continuation lines are only grouped when enabled
+	var multilinePatterns []string
+	if logsConfig.multiline || len(logsConfig.multilinePatterns) > 0 {
+		multilinePatterns = tail.DefaultMultilinePatterns
+		if len(logsConfig.multilinePatterns) > 0 {
+			multilinePatterns = logsConfig.multilinePatterns
+		}
+	}
+
 	// set tailing mode
 	if !logsConfig.follow {
 		logsConfig.refresh = 0
 	}
 
 	q := &domain.Query{
-		IndexPattern:   logsConfig.indexPattern,
-		AfterDateTime:  after,
-		BeforeDateTime: before,
-		Reverse:        logsConfig.reverse,
-		Query:          logsConfig.query,
-		Refresh:        logsConfig.refresh,
-		Entries:        logsConfig.entries,
-		Format:         logsConfig.format,
-		FormatFields:   fields,
-		TimestampField: logsConfig.timestampField,
-		ShowTime:       logsConfig.showTime,
-	}
-
-	// create elastic connector
-	c, err := elasticconn.New(args[0], logsConfig.user, logsConfig.password)
-	if err != nil {
-		rootConfig.logger.WithFields(logrus.Fields{"err": err, "url": args[0]}).Fatal("failed to connect to elastic cluster")
+		IndexPattern:      rootConfig.indexPattern,
+		AfterDateTime:     after,
+		BeforeDateTime:    before,
+		Reverse:           logsConfig.reverse,
+		Query:             query,
+		Refresh:           logsConfig.refresh,
+		Entries:           logsConfig.entries,
+		Format:            logsConfig.format,
+		FormatFields:      fields,
+		TimestampField:    logsConfig.timestampField,
+		ShowTime:          logsConfig.showTime,
+		Parallel:          logsConfig.parallel,
+		Grep:              logsConfig.grep,
+		GrepInvert:        logsConfig.grepInvert,
+		GrepField:         logsConfig.grepField,
+		Highlight:         isTerminal(os.Stdout),
+		ContextAfter:      logsConfig.contextAfter,
+		ContextBefore:     logsConfig.contextBefore,
+		ContextBy:         logsConfig.contextBy,
+		CorrelateBy:       logsConfig.correlateBy,
+		ServiceField:      logsConfig.serviceField,
+		MultilinePatterns: multilinePatterns,
+		MultilineBy:       logsConfig.multilineBy,
+		MultilineField:    logsConfig.multilineField,
+		UntilMatch:        logsConfig.untilMatch,
+		FailOnMatch:       logsConfig.failOnMatch,
+		MaxLines:          logsConfig.maxLines,
+		Timeout:           logsConfig.timeout,
 	}
 
+	// create elastic connector, the files being filtered by the time range too
+	c := logsConnector(args[0], after, before)
+
 	// create tail
-	t := tail.New(rootConfig.logger, c)
+	t := tail.New(rootConfig.logger, c, tail.WithSinks(outputSinks()...))
 
 	// start tailing logs
 	if err := t.Start(q); err != nil {
+		switch err {
+		case tail.ErrTimeout:
+			rootConfig.logger.WithFields(logrus.Fields{"timeout": logsConfig.timeout}).Debug("timeout reached")
+			os.Exit(exitTimeout)
+		case tail.ErrMatched:
+			rootConfig.logger.WithFields(logrus.Fields{"until": logsConfig.untilMatch}).Debug("until pattern matched")
+			os.Exit(exitMatched)
+		case tail.ErrNotMatched:
+			rootConfig.logger.WithFields(logrus.Fields{"until": logsConfig.untilMatch}).Debug("until pattern not matched")
+			os.Exit(exitNotMatched)
+		}
 		rootConfig.logger.WithFields(logrus.Fields{"err": err, "url": args[0]}).Fatal("failed to connect to elastic cluster")
 	}
 
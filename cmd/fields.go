@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// fieldsConfig holds the configs for the fields cmd
+var fieldsConfig struct {
+	sample         int
+	conflicts      bool
+	output         string
+	timestampField string
+}
+
+var fieldsCmd = &cobra.Command{
+	Use:   "fields URL [INDEX_PATTERN]",
+	Short: "List the fields mapped in the indices matching the index pattern",
+	Long: `List the fields mapped in the indices matching the index pattern with their types,
+flagging fields mapped with different types across indices.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		fields(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fieldsCmd)
+
+	fieldsCmd.Flags().IntVar(&fieldsConfig.sample, "sample", 0, "Number of recent logs sampled to report how often each field is populated (0 disables sampling)")
+	fieldsCmd.Flags().BoolVar(&fieldsConfig.conflicts, "conflicts", false, "Only show the fields mapped with different types across indices")
+	fieldsCmd.Flags().StringVarP(&fieldsConfig.output, "output", "o", "table", "Output format, table or json")
+	registerCompletion(fieldsCmd.Flags(), "output", completeChoices, "table", "json")
+	fieldsCmd.Flags().StringVar(&fieldsConfig.timestampField, "timestamp-field", defaultTimestampField, "Timestamp field name in the database, used to sample the most recent logs")
+}
+
+// fieldRow is a row of the fields output
+type fieldRow struct {
+	Name      string              `json:"name"`
+	Types     map[string][]string `json:"types"`
+	Conflict  bool                `json:"conflict"`
+	Populated *float64            `json:"populated,omitempty"` // ratio of the sampled logs holding the field
+
+	info *tail.FieldInfo
+}
+
+func fields(args []string) {
+	if fieldsConfig.output != "table" && fieldsConfig.output != "json" {
+		rootConfig.logger.WithFields(logrus.Fields{"output": fieldsConfig.output}).Fatal("invalid output format")
+	}
+	pattern := rootConfig.indexPattern
+	if len(args) > 1 {
+		pattern = args[1]
+	}
+
+	ctx := context.Background()
+	c := logsConnector(args[0], nil, nil)
+	indices, err := c.GetIndexNames(ctx)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not fetch available indices")
+	}
+	indices = tail.MatchIndex(indices, pattern)
+	if len(indices) == 0 {
+		rootConfig.logger.WithFields(logrus.Fields{"pattern": pattern}).Fatal("no indices match the pattern")
+	}
+
+	mappings, err := c.GetMappings(ctx, indices)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not fetch the mappings")
+	}
+	info := tail.MergeFields(mappings)
+
+	// sample the most recent logs
+	var sampled int
+	if fieldsConfig.sample > 0 {
+		logs, err := c.ExecuteQuery(ctx, indices, fieldsConfig.timestampField, false, "", fieldsConfig.sample)
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not fetch logs")
+		}
+		if err := tail.SampleFields(info, logs); err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not process logs")
+		}
+		sampled = len(logs)
+	}
+
+	rows := make([]*fieldRow, 0, len(info))
+	for _, f := range info {
+		if fieldsConfig.conflicts && !f.Conflict() {
+			continue
+		}
+		r := &fieldRow{Name: f.Name, Types: f.Types, Conflict: f.Conflict(), info: f}
+		if sampled > 0 {
+			p := float64(f.Populated) / float64(sampled)
+			r.Populated = &p
+		}
+		rows = append(rows, r)
+	}
+
+	if fieldsConfig.output == "json" {
+		b, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not encode the fields")
+		}
+		fmt.Println(string(b))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if sampled > 0 {
+		fmt.Fprintln(w, "FIELD\tTYPE\tPOPULATED")
+	} else {
+		fmt.Fprintln(w, "FIELD\tTYPE")
+	}
+	for _, r := range rows {
+		types := strings.Join(r.info.TypeNames(), ",")
+		if r.Conflict {
+			types = fmt.Sprintf("%s (conflict: %s)", types, describeConflict(r.info))
+		}
+		if r.Populated != nil {
+			fmt.Fprintf(w, "%s\t%s\t%.0f%%\n", r.Name, types, *r.Populated*100)
+		} else {
+			fmt.Fprintf(w, "%s\t%s\n", r.Name, types)
+		}
+	}
+	w.Flush()
+}
+
+// describeConflict summarizes how many indices map the field with each type
+func describeConflict(f *tail.FieldInfo) string {
+	parts := make([]string, 0, len(f.Types))
+	for _, t := range f.TypeNames() {
+		parts = append(parts, fmt.Sprintf("%s in %d indices", t, len(f.Types[t])))
+	}
+	return strings.Join(parts, ", ")
+}
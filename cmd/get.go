@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// getConfig holds the configs for the get cmd
+var getConfig struct {
+	fields      []string
+	format      string
+	ingestField string
+}
+
+var getCmd = &cobra.Command{
+	Use:   "get URL [INDEX] ID",
+	Short: "Show a single document by ID",
+	Long: `Show a single document by ID along with its metadata.
+When the index is not provided, the document is searched in every index matching the index pattern.`,
+	Args: cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		get(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+
+	getCmd.Flags().StringSliceVar(&getConfig.fields, "fields", nil, `Only include the source fields (example: --fields "@timestamp,message")`)
+	registerCompletion(getCmd.Flags(), "fields", completeFields)
+	getCmd.Flags().StringVarP(&getConfig.format, "output", "o", "", `Output format, the document is pretty printed with its metadata by default (example: -o "%timestamp: %log")`)
+	registerCompletion(getCmd.Flags(), "output", completeFormat)
+	getCmd.Flags().StringVar(&getConfig.ingestField, "ingest-field", "event.ingested", "Ingest timestamp field name in the database")
+}
+
+func get(args []string) {
+	ctx := context.Background()
+	c := logsConnector(args[0], nil, nil)
+	id := args[len(args)-1]
+
+	// find the index holding the document
+	var index string
+	if len(args) == 3 {
+		index = args[1]
+	} else {
+		indices, err := c.GetIndexNames(ctx)
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not fetch available indices")
+		}
+		found, err := c.FindDocument(ctx, tail.MatchIndex(indices, rootConfig.indexPattern), id)
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err, "id": id}).Fatal("could not search the document")
+		}
+		switch len(found) {
+		case 0:
+			rootConfig.logger.WithFields(logrus.Fields{"id": id, "pattern": rootConfig.indexPattern}).Fatal("document not found")
+		case 1:
+			index = found[0]
+		default:
+			rootConfig.logger.WithFields(logrus.Fields{"id": id, "indices": found}).Fatal("document found in several indices, the index must be provided")
+		}
+	}
+
+	doc, err := c.GetDocument(ctx, index, id, getConfig.fields)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err, "index": index, "id": id}).Fatal("could not fetch the document")
+	}
+	if doc.Source != nil && getConfig.ingestField != "" {
+		if value, err := tail.FieldValue(doc.Source, getConfig.ingestField); err == nil {
+			if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				doc.Ingested = &t
+			}
+		}
+	}
+
+	// print the document source with the output format
+	if getConfig.format != "" {
+		fields := tail.GetFields(getConfig.format)
+		if len(fields) == 0 {
+			rootConfig.logger.WithFields(logrus.Fields{"format": getConfig.format}).Fatal("invalid output format")
+		}
+		if doc.Source == nil {
+			rootConfig.logger.WithFields(logrus.Fields{"index": index, "id": id}).Fatal("document has no source")
+		}
+		entries, err := tail.ProcessLogs([]*json.RawMessage{doc.Source}, false, getConfig.format, fields)
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not process the document")
+		}
+		fmt.Println(entries[0])
+		return
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not encode the document")
+	}
+	fmt.Println(string(b))
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// indicesConfig holds the configs for the indices cmd
+var indicesConfig struct {
+	after  string
+	before string
+	sort   string
+	output string
+}
+
+var indicesCmd = &cobra.Command{
+	Use:   "indices URL",
+	Short: "List the indices matching the index pattern",
+	Long: `List the indices matching the index pattern with their date, size and health,
+showing which of them would be queried with the current time filters.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		indices(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(indicesCmd)
+
+	indicesCmd.Flags().StringVarP(&indicesConfig.after, "after", "a", "", `Select indices after specified date (example: -a "2016-06-17T15:00")`)
+	indicesCmd.Flags().StringVarP(&indicesConfig.before, "before", "b", "", `Select indices before specified date (example: -b "2016-06-17T15:00")`)
+	indicesCmd.Flags().StringVar(&indicesConfig.sort, "sort", "date", "Sort the indices by date, size or name")
+	registerCompletion(indicesCmd.Flags(), "sort", completeChoices, "date", "size", "name")
+	indicesCmd.Flags().StringVarP(&indicesConfig.output, "output", "o", "table", "Output format, table or json")
+	registerCompletion(indicesCmd.Flags(), "output", completeChoices, "table", "json")
+}
+
+// indexRow is a row of the indices output
+type indexRow struct {
+	Name      string `json:"name"`
+	Date      string `json:"date,omitempty"`
+	DocsCount int64  `json:"docs_count"`
+	StoreSize int64  `json:"store_size"`
+	Health    string `json:"health"`
+	Selected  bool   `json:"selected"`
+}
+
+func indices(args []string) {
+	if indicesConfig.output != "table" && indicesConfig.output != "json" {
+		rootConfig.logger.WithFields(logrus.Fields{"output": indicesConfig.output}).Fatal("invalid output format")
+	}
+	if indicesConfig.sort != "date" && indicesConfig.sort != "size" && indicesConfig.sort != "name" {
+		rootConfig.logger.WithFields(logrus.Fields{"sort": indicesConfig.sort}).Fatal("invalid sort order")
+	}
+	after := parseDate(indicesConfig.after, "after")
+	before := parseDate(indicesConfig.before, "before")
+
+	c := logsConnector(args[0], nil, nil)
+	all, err := c.GetIndices(context.Background())
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not fetch available indices")
+	}
+
+	// check which of the matching indices would be selected by the time filters
+	names := make([]string, 0, len(all))
+	for _, idx := range all {
+		names = append(names, idx.Name)
+	}
+	names = tail.MatchIndex(names, rootConfig.indexPattern)
+	matched := make(map[string]bool, len(names))
+	for _, idx := range names {
+		matched[idx] = true
+	}
+	selected := make(map[string]bool, len(names))
+	filtered, err := tail.FilterIndex(names, rootConfig.indexPattern, after, before)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Warn("could not filter indices")
+	}
+	for _, idx := range filtered {
+		selected[idx] = true
+	}
+
+	rows := make([]*indexRow, 0, len(names))
+	for _, idx := range all {
+		if !matched[idx.Name] {
+			continue
+		}
+		r := &indexRow{
+			Name:      idx.Name,
+			DocsCount: idx.DocsCount,
+			StoreSize: idx.StoreSize,
+			Health:    idx.Health,
+			Selected:  selected[idx.Name],
+		}
+		if d, err := tail.ExtractIndexDate(idx.Name); err == nil {
+			r.Date = d.Format("2006-01-02")
+		}
+		rows = append(rows, r)
+	}
+	sortIndexRows(rows, indicesConfig.sort)
+
+	if indicesConfig.output == "json" {
+		b, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not encode the indices")
+		}
+		fmt.Println(string(b))
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tDATE\tDOCS\tSIZE\tHEALTH\tSELECTED")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%t\n", r.Name, r.Date, r.DocsCount, formatBytes(r.StoreSize), r.Health, r.Selected)
+	}
+	w.Flush()
+}
+
+// sortIndexRows sorts the rows by date or size, newest and largest first, or by name
+func sortIndexRows(rows []*indexRow, by string) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		switch by {
+		case "size":
+			if rows[i].StoreSize == rows[j].StoreSize {
+				return rows[i].Name < rows[j].Name
+			}
+			return rows[i].StoreSize > rows[j].StoreSize
+		case "name":
+			return rows[i].Name < rows[j].Name
+		default:
+			if rows[i].Date == rows[j].Date {
+				return rows[i].Name < rows[j].Name
+			}
+			return rows[i].Date > rows[j].Date
+		}
+	})
+}
+
+// formatBytes formats a size in bytes using binary units
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%db", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cb", float64(b)/float64(div), "kmgtpe"[exp])
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// kubernetesConfig holds the kubernetes shortcuts of the query cmds
+var kubernetesConfig struct {
+	filter tail.KubernetesFilter
+	fields map[string]string
+}
+
+// addKubernetesFlags adds the kubernetes shortcuts to a cmd with a query
+func addKubernetesFlags(c *cobra.Command) {
+	c.Flags().StringVar(&kubernetesConfig.filter.Namespace, "namespace", "", "Only logs from the kubernetes namespace")
+	registerCompletion(c.Flags(), "namespace", completeValues, tail.DefaultKubernetesFields.Namespace)
+	c.Flags().StringVar(&kubernetesConfig.filter.Pod, "pod", "", `Only logs from the kubernetes pods matching the glob (example: --pod "api-*")`)
+	c.Flags().StringVar(&kubernetesConfig.filter.Container, "container", "", "Only logs from the kubernetes container")
+	registerCompletion(c.Flags(), "container", completeValues, tail.DefaultKubernetesFields.Container)
+	c.Flags().StringToStringVar(&kubernetesConfig.filter.Labels, "label", nil, `Only logs from the kubernetes pods with the label (example: --label app=api)`)
+	c.Flags().StringVar(&kubernetesConfig.filter.Deployment, "deployment", "", "Only logs from the kubernetes deployment")
+	registerCompletion(c.Flags(), "deployment", completeValues, tail.DefaultKubernetesFields.Deployment)
+	c.Flags().StringToStringVar(&kubernetesConfig.fields, "k8s-fields", nil, `Fields holding the kubernetes metadata, for shippers other than Filebeat (example: --k8s-fields namespace=k8s.ns,pod=k8s.pod)`)
+}
+
+// kubernetesFields returns the fields holding the kubernetes metadata
+func kubernetesFields() tail.KubernetesFields {
+	fields, err := tail.ParseKubernetesFields(kubernetesConfig.fields)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("invalid kubernetes fields")
+	}
+	return fields
+}
+
+// kubernetesQuery combines the query with the kubernetes shortcuts
+func kubernetesQuery(query string) string {
+	q, err := kubernetesConfig.filter.Query(kubernetesFields(), query)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("invalid kubernetes filter")
+	}
+	return q
+}
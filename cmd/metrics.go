@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/metrics"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// metricsConfig holds the configs for the metrics cmd
+var metricsConfig struct {
+	listen       string
+	rules        []string
+	entries      int
+	refresh      time.Duration
+	retries      int
+	retryBackoff time.Duration
+}
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics URL",
+	Short: "Expose the logs matching queries as Prometheus metrics",
+	Long: `Follow the logs matching each rule and expose them as Prometheus metrics on /metrics.
+
+Rules are comma separated key=value pairs:
+  name    name of the metric, <name>_total for counters
+  query   query string of the logs
+  labels  fields whose values label the series, separated by commas
+  value   numeric field whose latest value is exposed as a gauge, the logs are counted if not set
+
+Example: --rule 'name=errors,query=level:error,labels=service,host.name'
+
+The logs are counted from the start of the command. The poll duration, logs per second,
+lag behind now, retries and failed polls of each rule are exposed as elklogs_* metrics.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		serveMetrics(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(metricsCmd)
+
+	metricsCmd.Flags().StringVar(&metricsConfig.listen, "listen", ":9100", "Address to listen on")
+	metricsCmd.Flags().StringArrayVar(&metricsConfig.rules, "rule", nil, "Rule turning the logs into a metric, can be repeated (example: --rule 'name=errors,query=level:error,labels=service')")
+	metricsCmd.Flags().IntVarP(&metricsConfig.entries, "entries", "n", 1000, "Number of logs fetched per query, the refreshes page through the logs arrived since the previous one")
+	metricsCmd.Flags().DurationVar(&metricsConfig.refresh, "refresh", 10*time.Second, `Refresh interval of the rules (example: --refresh 10s)`)
+	metricsCmd.Flags().IntVar(&metricsConfig.retries, "retries", 3, "Number of retries of a failed query before the refresh is skipped")
+	metricsCmd.Flags().DurationVar(&metricsConfig.retryBackoff, "retry-backoff", 1*time.Second, "Wait before the first retry of a failed query, doubled on each retry")
+}
+
+func serveMetrics(args []string) {
+	if metricsConfig.refresh <= 0 {
+		rootConfig.logger.WithFields(logrus.Fields{"refresh": metricsConfig.refresh}).Fatal("the refresh interval must be positive")
+	}
+	if len(metricsConfig.rules) == 0 {
+		rootConfig.logger.Fatal("at least one rule is required")
+	}
+	rules := make([]metrics.Rule, 0, len(metricsConfig.rules))
+	for _, s := range metricsConfig.rules {
+		r, err := metrics.ParseRule(s)
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("invalid rule")
+		}
+		rules = append(rules, r)
+	}
+
+	c := logsConnector(args[0], nil, nil)
+	defer c.Close()
+
+	collector, err := metrics.New(rootConfig.logger, c, metrics.Config{
+		IndexPattern: rootConfig.indexPattern,
+		Entries:      metricsConfig.entries,
+		Refresh:      metricsConfig.refresh,
+		Retries:      metricsConfig.retries,
+		RetryBackoff: metricsConfig.retryBackoff,
+	}, rules)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("invalid rules")
+	}
+	go collector.Run(context.Background())
+
+	rootConfig.logger.WithFields(logrus.Fields{"listen": metricsConfig.listen, "rules": len(rules)}).Info("serving metrics")
+	if err := http.ListenAndServe(metricsConfig.listen, collector.Handler()); err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err, "listen": metricsConfig.listen}).Fatal("server failed")
+	}
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// outputConfig holds the configs for writing the logs to files
+var outputConfig struct {
+	file     string
+	format   string
+	quiet    bool
+	maxSize  string
+	interval time.Duration
+	compress bool
+	maxFiles int
+}
+
+// size units accepted by --rotate-size
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// addOutputFlags adds the output file flags to the command
+func addOutputFlags(c *cobra.Command) {
+	c.Flags().StringVar(&outputConfig.file, "output-file", "", `Also write the logs to the file, {date}, {time} and {index} are replaced in the name (example: --output-file "logs-{date}-{index}.ndjson")`)
+	c.Flags().StringVar(&outputConfig.format, "output-file-format", "", `Format of the file lines, "json" for the log documents (defaults to the output format)`)
+	c.Flags().BoolVar(&outputConfig.quiet, "output-file-only", false, "Do not print the logs when writing them to a file or forwarding them")
+	c.Flags().StringVar(&outputConfig.maxSize, "rotate-size", "", `Start a new file before the output file exceeds the size (example: --rotate-size 100MB)`)
+	c.Flags().DurationVar(&outputConfig.interval, "rotate-interval", 0, `Start a new file at each multiple of the interval since the local midnight, or since the local epoch for intervals over a day (example: --rotate-interval 24h)`)
+	c.Flags().BoolVar(&outputConfig.compress, "rotate-compress", false, "Gzip the rotated files")
+	c.Flags().IntVar(&outputConfig.maxFiles, "rotate-max-files", 0, "Number of output files kept, removing the oldest ones (0 keeps all of them)")
+	addForwardFlags(c)
+}
+
+// outputSinks returns the sinks the logs are written to: the standard output, the output file
+// and the forwarding destinations, if set
+func outputSinks() []tail.Sink {
+	var sinks []tail.Sink
+	if !outputConfig.quiet || (outputConfig.file == "" && !forwarding()) {
+		sinks = append(sinks, tail.NewWriterSink(os.Stdout, isTerminal(os.Stdout)))
+	}
+	sinks = append(sinks, forwardSinks()...)
+	if outputConfig.file == "" {
+		return sinks
+	}
+
+	size, err := parseSize(outputConfig.maxSize)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err, "size": outputConfig.maxSize}).Fatal("invalid rotation size")
+	}
+	rotation := tail.Rotation{
+		MaxSize:  size,
+		Interval: outputConfig.interval,
+		Compress: outputConfig.compress,
+		MaxFiles: outputConfig.maxFiles,
+	}
+
+	// lines are written as printed unless the file has its own format
+	var formatter tail.Formatter
+	switch outputConfig.format {
+	case "":
+	case "json":
+		formatter = tail.JSONFormatter
+	default:
+		fields := tail.GetFields(outputConfig.format)
+		if len(fields) == 0 {
+			rootConfig.logger.WithFields(logrus.Fields{"format": outputConfig.format}).Fatal("invalid output file format")
+		}
+		formatter = tail.NewFormatter(false, outputConfig.format, fields)
+	}
+
+	s, err := tail.NewFileSink(outputConfig.file, rotation, formatter)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err, "file": outputConfig.file}).Fatal("failed to open the output file")
+	}
+	return append(sinks, s)
+}
+
+// parseSize parses a size in bytes with an optional unit, such as 512KB or 100MB
+func parseSize(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	number := strings.ToUpper(strings.TrimSpace(value))
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(number, u.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, u.suffix)), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/patterns"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// patternsConfig holds the configs for the patterns cmd
+var patternsConfig struct {
+	follow     bool
+	refresh    time.Duration
+	entries    int
+	after      string
+	before     string
+	query      string
+	field      string
+	size       int
+	examples   int
+	similarity float64
+	output     string
+}
+
+var patternsCmd = &cobra.Command{
+	Use:   "patterns URL",
+	Short: "Group the logs by message pattern",
+	Long: `Group the logs by message pattern, replacing variable tokens such as numbers, UUIDs and IPs with placeholders,
+and print the patterns ranked by count with example messages.
+In follow mode the new logs keep being grouped and newly seen patterns are printed as they appear.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		minePatterns(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(patternsCmd)
+
+	patternsCmd.Flags().BoolVarP(&patternsConfig.follow, "follow", "f", false, "Print the new patterns as they appear")
+	patternsCmd.Flags().DurationVar(&patternsConfig.refresh, "refresh", 1*time.Second, `Refresh interval (example: --refresh 1s)`)
+	patternsCmd.Flags().IntVarP(&patternsConfig.entries, "entries", "n", 1000, "Number of logs grouped, and fetched on each refresh")
+	patternsCmd.Flags().StringVarP(&patternsConfig.after, "after", "a", "", `Group logs after specified date or duration before now (example: -a "2016-06-17T15:00" or -a=-1h)`)
+	patternsCmd.Flags().StringVarP(&patternsConfig.before, "before", "b", "", `Group logs before specified date or duration before now (example: -b "2016-06-17T15:00" or -b=-30m)`)
+	patternsCmd.Flags().StringVarP(&patternsConfig.query, "query", "q", "", `Elastic query string search (example: -q "host:myhost.example.com AND level:error")`)
+	patternsCmd.Flags().StringVar(&patternsConfig.field, "field", "message", "Field holding the message to group")
+	registerCompletion(patternsCmd.Flags(), "field", completeFields)
+	patternsCmd.Flags().IntVarP(&patternsConfig.size, "size", "k", 20, "Number of patterns to show")
+	patternsCmd.Flags().IntVar(&patternsConfig.examples, "examples", 1, "Number of example messages to show for each pattern")
+	patternsCmd.Flags().Float64Var(&patternsConfig.similarity, "similarity", 0.5, "Minimum ratio of equal tokens for a message to join a pattern")
+	patternsCmd.Flags().StringVarP(&patternsConfig.output, "output", "o", "table", "Output format, table or json")
+	registerCompletion(patternsCmd.Flags(), "output", completeChoices, "table", "json")
+	addKubernetesFlags(patternsCmd)
+}
+
+func minePatterns(args []string) {
+	if patternsConfig.output != "table" && patternsConfig.output != "json" {
+		rootConfig.logger.WithFields(logrus.Fields{"output": patternsConfig.output}).Fatal("invalid output format")
+	}
+
+	q := &domain.Query{
+		IndexPattern:   rootConfig.indexPattern,
+		AfterDateTime:  parseDate(patternsConfig.after, "after"),
+		BeforeDateTime: parseDate(patternsConfig.before, "before"),
+		Query:          kubernetesQuery(patternsConfig.query),
+		Entries:        patternsConfig.entries,
+	}
+
+	c := logsConnector(args[0], nil, nil)
+	defer c.Close()
+	t := tail.New(rootConfig.logger, c)
+
+	ctx := context.Background()
+	indices, err := t.Indices(ctx, q)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not select indices")
+	}
+	if err := t.Reset(q); err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("invalid query")
+	}
+
+	m := patterns.NewMiner(patternsConfig.similarity, patternsConfig.examples)
+	fetch := func() []*patterns.Template {
+		logs, err := t.Fetch(ctx, q, indices)
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not fetch logs")
+		}
+		var created []*patterns.Template
+		for _, l := range logs {
+			message, err := tail.FieldValue(l.Message, patternsConfig.field)
+			if err != nil {
+				rootConfig.logger.WithFields(logrus.Fields{"id": l.ID, "field": patternsConfig.field}).Debug("log without message field")
+				continue
+			}
+			if tpl, ok := m.Add(strings.TrimSpace(message)); ok {
+				created = append(created, tpl)
+			}
+		}
+		return created
+	}
+
+	fetch()
+	printPatterns(m.Templates())
+	for patternsConfig.follow {
+		time.Sleep(patternsConfig.refresh)
+		for _, tpl := range fetch() {
+			printNewPattern(tpl)
+		}
+	}
+}
+
+// printPatterns prints the most frequent patterns with their share of the logs and their examples
+func printPatterns(templates []*patterns.Template) {
+	var total int64
+	for _, tpl := range templates {
+		total += tpl.Count
+	}
+	if len(templates) > patternsConfig.size {
+		templates = templates[:patternsConfig.size]
+	}
+
+	if patternsConfig.output == "json" {
+		rows := make([]patternRow, 0, len(templates))
+		for _, tpl := range templates {
+			rows = append(rows, patternRow{Template: tpl, Pattern: tpl.String()})
+		}
+		// placeholders are kept readable
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rows); err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not encode the patterns")
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COUNT\tPERCENT\tPATTERN")
+	for _, tpl := range templates {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", tpl.Count, percent(tpl.Count, total), tpl)
+		for _, e := range tpl.Examples {
+			fmt.Fprintf(w, "\t\t  e.g. %s\n", e)
+		}
+	}
+	w.Flush()
+}
+
+// printNewPattern prints a pattern seen for the first time in follow mode
+func printNewPattern(tpl *patterns.Template) {
+	if patternsConfig.output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(patternRow{Template: tpl, Pattern: tpl.String(), New: true}); err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not encode the pattern")
+		}
+		return
+	}
+	fmt.Printf("%s NEW %s\n", time.Now().Format("15:04:05"), tpl)
+	for _, e := range tpl.Examples {
+		fmt.Printf("  e.g. %s\n", e)
+	}
+}
+
+// patternRow is a pattern of the json output
+type patternRow struct {
+	*patterns.Template
+	Pattern string `json:"pattern"`
+	New     bool   `json:"new,omitempty"`
+}
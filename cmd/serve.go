@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/server"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// serveConfig holds the configs for the serve cmd
+var serveConfig struct {
+	listen       string
+	entries      int
+	refresh      time.Duration
+	history      int
+	clientBuffer int
+	heartbeat    time.Duration
+	origins      []string
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve URL",
+	Short: "Stream logs to http clients",
+	Long: `Stream logs to http clients as server-sent events or newline delimited json.
+
+Endpoints:
+  /stream  the logs of a query, followed on each refresh
+           parameters: q, after, before, grep, grep-v, grep-field, format (sse or ndjson), output (line format)
+           example: /stream?q=level:error&after=-1h&format=ndjson&output=%message
+  /ws      a websocket session per viewer, whose query can change without reconnecting
+           messages: {"type":"subscribe|update|pause|resume|history","query":{"q":"...","grep":"...","entries":50}}
+  /health  the number of streams and clients, failing if the cluster is unreachable
+
+Clients with the same query share a single poller of the cluster.
+Clients that cannot keep up with their stream are disconnected with an error event.
+Websocket sessions opened by pages of other origins are rejected, unless allowed with --allowed-origins.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		serve(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveConfig.listen, "listen", ":8080", "Address to listen on")
+	serveCmd.Flags().IntVarP(&serveConfig.entries, "entries", "n", 50, "Number of logs fetched when a stream starts and on each refresh")
+	serveCmd.Flags().DurationVar(&serveConfig.refresh, "refresh", 1*time.Second, `Refresh interval of the streams (example: --refresh 1s)`)
+	serveCmd.Flags().IntVar(&serveConfig.history, "history", 100, "Number of latest logs sent to the clients joining a running stream")
+	serveCmd.Flags().IntVar(&serveConfig.clientBuffer, "client-buffer", 1000, "Number of logs queued per client before it is disconnected as too slow")
+	serveCmd.Flags().DurationVar(&serveConfig.heartbeat, "heartbeat", 15*time.Second, "Interval of the keep alive comments of event streams (0 disables them)")
+	serveCmd.Flags().StringSliceVar(&serveConfig.origins, "allowed-origins", nil, `Origins of the pages allowed to open websocket sessions, "*" allows any (example: --allowed-origins "https://logs.example.com")`)
+}
+
+func serve(args []string) {
+	if serveConfig.refresh <= 0 {
+		rootConfig.logger.WithFields(logrus.Fields{"refresh": serveConfig.refresh}).Fatal("the refresh interval must be positive")
+	}
+
+	c := libraryConnector(args[0])
+	defer c.Close()
+
+	s := server.New(rootConfig.logger, c, server.Config{
+		IndexPattern: rootConfig.indexPattern,
+		Entries:      serveConfig.entries,
+		Refresh:      serveConfig.refresh,
+		History:      serveConfig.history,
+		ClientBuffer: serveConfig.clientBuffer,
+		Heartbeat:    serveConfig.heartbeat,
+
+		AllowedOrigins: serveConfig.origins,
+	})
+
+	rootConfig.logger.WithFields(logrus.Fields{"listen": serveConfig.listen}).Info("serving logs")
+	if err := http.ListenAndServe(serveConfig.listen, s.Handler()); err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err, "listen": serveConfig.listen}).Fatal("server failed")
+	}
+}
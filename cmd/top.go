@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// ansi escape codes used to redraw the terminal in follow mode
+const clearScreen = "\x1b[H\x1b[2J"
+
+// topConfig holds the configs for the top cmd
+var topConfig struct {
+	follow         bool
+	refresh        time.Duration
+	after          string
+	before         string
+	query          string
+	timestampField string
+	output         string
+
+	size   int
+	by     string
+	bySize int
+}
+
+var topCmd = &cobra.Command{
+	Use:   "top URL FIELD",
+	Short: "Show the most frequent values of a field",
+	Long: `Show the most frequent values of a field in the logs matching the query,
+with their count and percentage, optionally broken down by a second field.
+In follow mode the values are refreshed in place, and a relative -a moves the window with each refresh.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		top(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+
+	topCmd.Flags().BoolVarP(&topConfig.follow, "follow", "f", false, "Refresh the values in place")
+	topCmd.Flags().DurationVar(&topConfig.refresh, "refresh", 2*time.Second, `Refresh interval (example: --refresh 1s)`)
+	topCmd.Flags().StringVarP(&topConfig.after, "after", "a", "", `Count logs after specified date or duration before now (example: -a "2016-06-17T15:00" or -a=-15m)`)
+	topCmd.Flags().StringVarP(&topConfig.before, "before", "b", "", `Count logs before specified date or duration before now (example: -b "2016-06-17T15:00" or -b=-5m)`)
+	topCmd.Flags().StringVarP(&topConfig.query, "query", "q", "", `Elastic query string search (example: -q "host:myhost.example.com AND level:error")`)
+	topCmd.Flags().StringVar(&topConfig.timestampField, "timestamp-field", defaultTimestampField, `Timestamp field name in the database`)
+	topCmd.Flags().StringVarP(&topConfig.output, "output", "o", "table", "Output format, table or json")
+	registerCompletion(topCmd.Flags(), "output", completeChoices, "table", "json")
+	topCmd.Flags().IntVarP(&topConfig.size, "size", "k", 10, "Number of values to show")
+	topCmd.Flags().StringVar(&topConfig.by, "by", "", `Break down each value by the most frequent values of the field (example: --by "kubernetes.pod.name")`)
+	registerCompletion(topCmd.Flags(), "by", completeFields)
+	topCmd.Flags().IntVar(&topConfig.bySize, "by-size", 5, "Number of values of the --by field to show")
+	addKubernetesFlags(topCmd)
+}
+
+// topResult is the output of a top refresh
+type topResult struct {
+	Time  time.Time      `json:"time"`
+	Total int64          `json:"total"`
+	Terms []*domain.Term `json:"terms"`
+}
+
+func top(args []string) {
+	if topConfig.output != "table" && topConfig.output != "json" {
+		rootConfig.logger.WithFields(logrus.Fields{"output": topConfig.output}).Fatal("invalid output format")
+	}
+
+	c := logsConnector(args[0], nil, nil)
+	field := args[1]
+	redraw := topConfig.follow && topConfig.output == "table" && isTerminal(os.Stdout)
+	for {
+		result := fetchTop(c, field)
+		if redraw {
+			fmt.Print(clearScreen)
+		}
+		printTop(field, result)
+		if !topConfig.follow {
+			return
+		}
+		time.Sleep(topConfig.refresh)
+	}
+}
+
+// fetchTop runs the terms aggregation, evaluating the time filters again so relative dates follow the current time
+func fetchTop(c connector, field string) *topResult {
+	q := &domain.Query{
+		IndexPattern:   rootConfig.indexPattern,
+		AfterDateTime:  parseDate(topConfig.after, "after"),
+		BeforeDateTime: parseDate(topConfig.before, "before"),
+		Query:          kubernetesQuery(topConfig.query),
+		TimestampField: topConfig.timestampField,
+	}
+
+	ctx := context.Background()
+	indices, err := tail.New(rootConfig.logger, c).Indices(ctx, q)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not select indices")
+	}
+	terms, total, err := c.Terms(ctx, indices, q.TimestampField, q.Query, q.AfterDateTime, q.BeforeDateTime, field, topConfig.size, topConfig.by, topConfig.bySize)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err, "field": field}).Fatal("could not count the field values")
+	}
+	return &topResult{Time: time.Now(), Total: total, Terms: terms}
+}
+
+// printTop prints the values with their percentage of the total, and the second field values with their
+// percentage of the value
+func printTop(field string, result *topResult) {
+	if topConfig.output == "json" {
+		// one object per line in follow mode
+		b, err := json.Marshal(result)
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not encode the values")
+		}
+		fmt.Println(string(b))
+		return
+	}
+
+	if topConfig.follow {
+		fmt.Printf("%s  %d logs\n\n", result.Time.Format("15:04:05"), result.Total)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tCOUNT\tPERCENT\n", strings.ToUpper(field))
+	for _, t := range result.Terms {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", t.Value, t.Count, percent(t.Count, result.Total))
+		for _, s := range t.Terms {
+			fmt.Fprintf(w, "  %s\t%d\t%s\n", s.Value, s.Count, percent(s.Count, t.Count))
+		}
+	}
+	w.Flush()
+}
+
+// percent formats the share of the count in the total
+func percent(count int64, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(count)*100/float64(total))
+}
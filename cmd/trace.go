@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// traceConfig holds the configs for the trace cmd
+var traceConfig struct {
+	correlateBy  string
+	serviceField string
+	format       string
+	entries      int
+	after        string
+	before       string
+	follow       bool
+	quiet        time.Duration
+	refresh      time.Duration
+}
+
+var traceCmd = &cobra.Command{
+	Use:   "trace URL ID",
+	Short: "Show the logs of a trace across services and indices",
+	Long: `Show the logs sharing the trace id across all the indices matching the index pattern, sorted in time.
+The logs are indented by service with their time since the first log of the trace.
+In follow mode the new logs are printed until none arrive for the quiet period.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		trace(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(traceCmd)
+
+	traceCmd.Flags().StringVar(&traceConfig.correlateBy, "correlate-by", "trace.id", `Field holding the id (example: --correlate-by "transaction.id")`)
+	registerCompletion(traceCmd.Flags(), "correlate-by", completeFields)
+	traceCmd.Flags().StringVar(&traceConfig.serviceField, "service-field", "service.name", "Field the logs are grouped by")
+	registerCompletion(traceCmd.Flags(), "service-field", completeFields)
+	traceCmd.Flags().StringVarP(&traceConfig.format, "output", "o", "%message", `Output format (example: -o "%log.level %message")`)
+	registerCompletion(traceCmd.Flags(), "output", completeFormat)
+	traceCmd.Flags().IntVarP(&traceConfig.entries, "entries", "n", 1000, "Maximum number of logs to show")
+	traceCmd.Flags().StringVarP(&traceConfig.after, "after", "a", "", `Search logs after specified date or duration before now, instead of all indices (example: -a=-1h)`)
+	traceCmd.Flags().StringVarP(&traceConfig.before, "before", "b", "", `Search logs before specified date or duration before now, instead of all indices (example: -b=-30m)`)
+	traceCmd.Flags().BoolVarP(&traceConfig.follow, "follow", "f", false, "Keep printing the new logs of the trace")
+	traceCmd.Flags().DurationVar(&traceConfig.quiet, "quiet", 10*time.Second, "Stop following once no new logs arrive for the duration")
+	traceCmd.Flags().DurationVar(&traceConfig.refresh, "refresh", 1*time.Second, `Refresh interval (example: --refresh 1s)`)
+}
+
+func trace(args []string) {
+	fields := tail.GetFields(traceConfig.format)
+	if len(fields) == 0 {
+		rootConfig.logger.WithFields(logrus.Fields{"format": traceConfig.format}).Fatal("invalid output format")
+	}
+
+	q := &domain.Query{
+		IndexPattern:   rootConfig.indexPattern,
+		AfterDateTime:  parseDate(traceConfig.after, "after"),
+		BeforeDateTime: parseDate(traceConfig.before, "before"),
+		Query:          tail.CorrelationQuery(traceConfig.correlateBy, args[1]),
+		Entries:        traceConfig.entries,
+	}
+
+	c := logsConnector(args[0], nil, nil)
+	defer c.Close()
+	t := tail.New(rootConfig.logger, c)
+
+	ctx := context.Background()
+	indices, err := t.TraceIndices(ctx, q)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not select indices")
+	}
+	if err := t.Reset(q); err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("invalid query")
+	}
+
+	tracer := tail.NewTracer(traceConfig.serviceField, traceConfig.format)
+	count := 0
+	last := time.Now()
+	for {
+		logs, err := t.Fetch(ctx, q, indices)
+		if err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not fetch logs")
+		}
+		for _, l := range logs {
+			line, err := tracer.Line(l)
+			if err != nil {
+				rootConfig.logger.WithFields(logrus.Fields{"err": err, "id": l.ID}).Fatal("could not process logs")
+			}
+			fmt.Println(line)
+		}
+		count += len(logs)
+		if len(logs) > 0 {
+			last = time.Now()
+		}
+
+		if !traceConfig.follow || time.Since(last) >= traceConfig.quiet {
+			break
+		}
+		time.Sleep(traceConfig.refresh)
+	}
+
+	if count == 0 {
+		rootConfig.logger.WithFields(logrus.Fields{"field": traceConfig.correlateBy, "id": args[1]}).Fatal("no logs found")
+	}
+	rootConfig.logger.WithFields(logrus.Fields{"logs": count, "services": tracer.Services()}).Debug("trace printed")
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/ui"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// uiConfig holds the configs for the ui cmd
+var uiConfig struct {
+	entries int
+	refresh time.Duration
+	after   string
+	before  string
+	query   string
+	grep    string
+	columns string
+}
+
+var uiCmd = &cobra.Command{
+	Use:   "ui URL",
+	Short: "Browse the logs in an interactive terminal UI",
+	Long: `Browse the logs in a full screen terminal UI that follows the new logs.
+Move with the arrow keys, moving up from the oldest log loads the previous page.
+Press enter to show the selected document, space to pause, / to edit the query, t to edit the time range,
+c to edit the columns, 1-9 to toggle a column and q to quit.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		browse(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(uiCmd)
+
+	uiCmd.Flags().IntVarP(&uiConfig.entries, "entries", "n", 100, "Number of logs loaded in each page")
+	uiCmd.Flags().DurationVar(&uiConfig.refresh, "refresh", 1*time.Second, `Refresh interval (example: --refresh 1s)`)
+	uiCmd.Flags().StringVarP(&uiConfig.after, "after", "a", "", `Show logs after specified date or duration before now (example: -a "2016-06-17T15:00" or -a=-1h)`)
+	uiCmd.Flags().StringVarP(&uiConfig.before, "before", "b", "", `Show logs before specified date or duration before now (example: -b "2016-06-17T15:00" or -b=-30m)`)
+	uiCmd.Flags().StringVarP(&uiConfig.query, "query", "q", "", `Elastic query string search (example: -q "host:myhost.example.com AND level:error")`)
+	uiCmd.Flags().StringVar(&uiConfig.grep, "grep", "", `Only show logs matching the regexp, evaluated on the log json (example: --grep "(?i)timeout")`)
+	uiCmd.Flags().StringVar(&uiConfig.columns, "columns", "@timestamp,message", "Comma separated fields shown as columns")
+	registerCompletion(uiCmd.Flags(), "columns", completeFields)
+	addKubernetesFlags(uiCmd)
+}
+
+func browse(args []string) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		rootConfig.logger.Fatal("the ui requires a terminal")
+	}
+
+	// the range is kept as typed so relative dates are evaluated again on reload
+	var window string
+	if uiConfig.after != "" || uiConfig.before != "" {
+		window = uiConfig.after + ".." + uiConfig.before
+	}
+	q := &domain.Query{
+		IndexPattern: rootConfig.indexPattern,
+		Query:        kubernetesQuery(uiConfig.query),
+		Refresh:      uiConfig.refresh,
+		Entries:      uiConfig.entries,
+		Grep:         uiConfig.grep,
+	}
+
+	c := logsConnector(args[0], nil, nil)
+	defer c.Close()
+
+	// logs would be drawn over the screen
+	logger := rootConfig.logger
+	if !rootConfig.debug {
+		l := logrus.New()
+		l.Out = ioutil.Discard
+		logger = logrus.NewEntry(l)
+	}
+
+	b := ui.New(logger, c, q, window, strings.Split(uiConfig.columns, ","))
+	if err := b.Run(context.Background(), os.Stdin, os.Stdout); err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not start the ui")
+	}
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/pmdcosta/elklogs/pkg/elklogs"
 	"github.com/spf13/cobra"
 )
 
@@ -12,7 +13,7 @@ var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Show the Elklogs version information",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("elklogs version %s\n", version)
+		fmt.Printf("elklogs version %s (library API %s)\n", version, elklogs.Version)
 	},
 }
 
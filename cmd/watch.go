@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/alert"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// watchConfig holds the configs for the watch cmd
+var watchConfig struct {
+	rules         string
+	refresh       time.Duration
+	actionTimeout time.Duration
+	dryRun        bool
+	once          bool
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch URL",
+	Short: "Evaluate alert rules, posting to webhooks or running commands when they fire",
+	Long: `Evaluate the alert rules on each refresh, notifying when they fire and when they resolve.
+
+A rule fires when the number of logs matching its query over the window reaches its threshold,
+or on any match. It is notified once per firing, and fires again at most once per cooldown.
+Webhooks receive the event as json, or the rendering of their body template.
+Commands are run with sh, the matching logs on stdin as json lines and the event in
+the ELKLOGS_ID, ELKLOGS_RULE, ELKLOGS_STATUS and ELKLOGS_COUNT variables.
+
+Rules file (yaml or json):
+  rules:
+    - name: api-errors
+      query: level:error AND service:api
+      threshold: 10        # or any: true
+      window: 5m
+      cooldown: 30m
+      entries: 10          # latest matching logs attached to the firing events
+      webhook:
+        url: https://hooks.example.com/alerts
+        headers:
+          Authorization: Bearer token
+        body: '{"text": {{json (printf "%s is %s with %d logs" .Rule .Status .Count)}}}'
+    - name: panics
+      query: message:panic
+      any: true
+      window: 1m
+      command: mail -s "$ELKLOGS_RULE $ELKLOGS_STATUS" oncall@example.com`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		watch(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().StringVar(&watchConfig.rules, "rules", "", "Path of the rules file (yaml or json)")
+	watchCmd.Flags().DurationVar(&watchConfig.refresh, "refresh", 30*time.Second, `Interval between the evaluations of the rules (example: --refresh 1m)`)
+	watchCmd.Flags().DurationVar(&watchConfig.actionTimeout, "action-timeout", 30*time.Second, "Timeout of the webhooks and commands")
+	watchCmd.Flags().BoolVar(&watchConfig.dryRun, "dry-run", false, "Print the rules that would fire or resolve instead of running their actions")
+	watchCmd.Flags().BoolVar(&watchConfig.once, "once", false, "Evaluate the rules once and exit, failing if a rule could not be evaluated")
+}
+
+func watch(args []string) {
+	if watchConfig.rules == "" {
+		rootConfig.logger.Fatal("the rules file is required")
+	}
+	if watchConfig.refresh <= 0 {
+		rootConfig.logger.WithFields(logrus.Fields{"refresh": watchConfig.refresh}).Fatal("the refresh interval must be positive")
+	}
+	rules, err := alert.LoadRules(watchConfig.rules)
+	if err != nil {
+		rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("invalid rules")
+	}
+
+	c := logsConnector(args[0], nil, nil)
+	defer c.Close()
+
+	w := alert.New(rootConfig.logger, c, alert.Config{
+		IndexPattern:  rootConfig.indexPattern,
+		Refresh:       watchConfig.refresh,
+		ActionTimeout: watchConfig.actionTimeout,
+		DryRun:        watchConfig.dryRun,
+		Output:        os.Stdout,
+	}, rules)
+
+	if watchConfig.once {
+		if err := w.Evaluate(context.Background()); err != nil {
+			rootConfig.logger.WithFields(logrus.Fields{"err": err}).Fatal("could not evaluate rules")
+		}
+		return
+	}
+	rootConfig.logger.WithFields(logrus.Fields{"rules": len(rules), "dry-run": watchConfig.dryRun}).Info("watching rules")
+	w.Run(context.Background())
+}
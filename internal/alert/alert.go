@@ -0,0 +1,287 @@
+// Package alert evaluates alert rules over the logs on each refresh, notifying when they fire and resolve
+// through a webhook or a local command. A rule is notified once per firing: the later evaluations
+// matching again are deduplicated until it resolves, and firing again waits for its cooldown.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+)
+
+// statuses of the events
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// timestampField is the field the windows of the rules apply to
+const timestampField = "@timestamp"
+
+// Connector counts and retrieves the logs of the rules
+type Connector interface {
+	tail.Connector
+	Count(ctx context.Context, indices []string, timestampField string, query string, after *time.Time, before *time.Time) (int64, error)
+}
+
+// Config configures the watcher
+type Config struct {
+	IndexPattern  string
+	Refresh       time.Duration // interval between the evaluations of the rules
+	ActionTimeout time.Duration // timeout of the webhooks and commands
+	DryRun        bool          // print the events instead of running the actions
+	Output        io.Writer     // where the events of dry runs are printed
+}
+
+// Event is sent to the webhooks, and to the commands in the environment
+type Event struct {
+	ID        string            `json:"id"` // shared by the firing and resolved events of an alert
+	Rule      string            `json:"rule"`
+	Status    string            `json:"status"`
+	Query     string            `json:"query"`
+	Count     int64             `json:"count"` // logs matching the query in the window
+	Threshold int64             `json:"threshold,omitempty"`
+	Window    Duration          `json:"window"`
+	Time      time.Time         `json:"time"`
+	Entries   []json.RawMessage `json:"entries,omitempty"` // latest matching logs of the firing events, oldest first
+}
+
+// Watcher evaluates the rules and runs their actions
+type Watcher struct {
+	logger    *logrus.Entry
+	connector Connector
+	config    Config
+	states    []*state
+	client    *http.Client
+	now       func() time.Time
+}
+
+// state tracks whether a rule is firing and if it was notified
+type state struct {
+	rule     *Rule
+	tail     *tail.Tail
+	firing   bool
+	notified bool      // the current firing was notified, so its resolution is too
+	fired    time.Time // time of the last firing notification
+}
+
+// New creates a watcher of the rules
+func New(logger *logrus.Entry, connector Connector, config Config, rules []*Rule) *Watcher {
+	w := &Watcher{
+		logger:    logger,
+		connector: connector,
+		config:    config,
+		client:    &http.Client{},
+		now:       time.Now,
+	}
+	for _, r := range rules {
+		w.states = append(w.states, &state{rule: r, tail: tail.New(logger.WithFields(logrus.Fields{"rule": r.Name}), connector)})
+	}
+	return w
+}
+
+// Run evaluates the rules on each refresh until the context is done
+func (w *Watcher) Run(ctx context.Context) error {
+	for {
+		w.Evaluate(ctx)
+		select {
+		case <-time.After(w.config.Refresh):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Evaluate evaluates each rule once, running the actions of the ones firing or resolving.
+// The rules that fail are logged and evaluated again on the next call.
+func (w *Watcher) Evaluate(ctx context.Context) error {
+	failed := 0
+	for _, s := range w.states {
+		if err := w.evaluate(ctx, s); err != nil {
+			failed++
+			w.logger.WithFields(logrus.Fields{"rule": s.rule.Name, "err": err}).Warn("rule evaluation failed")
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rules failed", failed, len(w.states))
+	}
+	return nil
+}
+
+// evaluate counts the logs of the rule in its window and notifies the changes of its state
+func (w *Watcher) evaluate(ctx context.Context, s *state) error {
+	r := s.rule
+	now := w.now()
+	after := now.Add(-r.Window.Duration)
+	names, err := w.connector.GetIndexNames(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not fetch available indices")
+	}
+	indices, err := tail.FilterIndex(names, w.config.IndexPattern, &after, &now)
+	if err != nil {
+		return errors.Wrap(err, "could not filter indices")
+	}
+	var count int64
+	if len(indices) > 0 {
+		if count, err = w.connector.Count(ctx, indices, timestampField, r.Query, &after, &now); err != nil {
+			return errors.Wrap(err, "could not count logs")
+		}
+	}
+	matched := count >= r.Threshold
+	if r.Any {
+		matched = count > 0
+	}
+	logger := w.logger.WithFields(logrus.Fields{"rule": r.Name, "count": count})
+	logger.Debug("rule evaluated")
+
+	ev := &Event{ID: fmt.Sprintf("%s-%d", r.Name, now.Unix()), Rule: r.Name, Query: r.Query, Count: count, Threshold: r.Threshold, Window: r.Window, Time: now}
+	switch {
+	case matched && !s.notified && (s.fired.IsZero() || now.Sub(s.fired) >= r.Cooldown.Duration):
+		ev.Status = StatusFiring
+		q := &domain.Query{Query: r.Query, Entries: r.Entries, AfterDateTime: &after, BeforeDateTime: &now}
+		if ev.Entries, err = w.entries(ctx, s, q, indices); err != nil {
+			return err
+		}
+		if err := w.notify(ctx, r, ev); err != nil {
+			return err
+		}
+		s.firing, s.notified, s.fired = true, true, now
+	case matched && !s.firing:
+		s.firing = true
+		logger.Info("firing suppressed by the cooldown")
+	case !matched && s.firing:
+		if s.notified {
+			ev.ID, ev.Status = fmt.Sprintf("%s-%d", r.Name, s.fired.Unix()), StatusResolved
+			if err := w.notify(ctx, r, ev); err != nil {
+				return err
+			}
+		}
+		s.firing, s.notified = false, false
+	}
+	return nil
+}
+
+// entries retrieves the latest logs matching the rule, oldest first
+func (w *Watcher) entries(ctx context.Context, s *state, q *domain.Query, indices []string) ([]json.RawMessage, error) {
+	if len(indices) == 0 {
+		return nil, nil
+	}
+	if err := s.tail.Reset(q); err != nil {
+		return nil, err
+	}
+	logs, err := s.tail.Fetch(ctx, q, indices)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]json.RawMessage, 0, len(logs))
+	for _, l := range logs {
+		if l.Message != nil {
+			entries = append(entries, *l.Message)
+		}
+	}
+	return entries, nil
+}
+
+// notify runs the actions of the rule for the event, or prints them on dry runs
+func (w *Watcher) notify(ctx context.Context, r *Rule, ev *Event) error {
+	w.logger.WithFields(logrus.Fields{"rule": r.Name, "status": ev.Status, "count": ev.Count}).Info("alert " + ev.Status)
+	if w.config.DryRun {
+		fmt.Fprintf(w.config.Output, "%s %s %s: %d logs in %s\n", ev.Time.Format(time.RFC3339), ev.Status, r.Name, ev.Count, r.Window)
+		if r.Webhook != nil {
+			fmt.Fprintf(w.config.Output, "  would post to %s\n", r.Webhook.URL)
+		}
+		if r.Command != "" {
+			fmt.Fprintf(w.config.Output, "  would run %s\n", r.Command)
+		}
+		return nil
+	}
+
+	if w.config.ActionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.config.ActionTimeout)
+		defer cancel()
+	}
+	var err error
+	if r.Webhook != nil {
+		err = w.post(ctx, r, ev)
+	}
+	if r.Command != "" {
+		if cerr := w.run(ctx, r, ev); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// post sends the event to the webhook of the rule
+func (w *Watcher) post(ctx context.Context, r *Rule, ev *Event) error {
+	var body []byte
+	if r.body == nil {
+		var err error
+		if body, err = json.Marshal(ev); err != nil {
+			return err
+		}
+	} else {
+		var buf bytes.Buffer
+		if err := r.body.Execute(&buf, ev); err != nil {
+			return errors.Wrap(err, "could not render webhook body")
+		}
+		if !json.Valid(buf.Bytes()) {
+			return fmt.Errorf("webhook body is not valid json: %s", buf.String())
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range r.Webhook.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "webhook failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// run runs the command of the rule with the entries of the event on stdin, one json document per line
+func (w *Watcher) run(ctx context.Context, r *Rule, ev *Event) error {
+	var stdin bytes.Buffer
+	for _, e := range ev.Entries {
+		stdin.Write(e)
+		stdin.WriteByte('\n')
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", r.Command)
+	cmd.Stdin = &stdin
+	cmd.Env = append(os.Environ(),
+		"ELKLOGS_ID="+ev.ID,
+		"ELKLOGS_RULE="+ev.Rule,
+		"ELKLOGS_STATUS="+ev.Status,
+		"ELKLOGS_COUNT="+strconv.FormatInt(ev.Count, 10),
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("command failed: %s", bytes.TrimSpace(out)))
+	}
+	return nil
+}
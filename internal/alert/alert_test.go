@@ -0,0 +1,209 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/tail/tailtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// addLogs adds logs with the messages a second apart, the last one at the time
+func addLogs(c *tailtest.Connector, at time.Time, messages ...string) {
+	for i, m := range messages {
+		c.Add("", at.Add(time.Duration(i+1-len(messages))*time.Second), map[string]interface{}{"message": m})
+	}
+}
+
+// messages returns the messages of the entries of an event body
+func messages(entries interface{}) []string {
+	var result []string
+	for _, e := range entries.([]interface{}) {
+		result = append(result, e.(map[string]interface{})["message"].(string))
+	}
+	return result
+}
+
+// webhookServer records the bodies posted to it
+type webhookServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+}
+
+func newWebhookServer() *webhookServer {
+	s := &webhookServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		body["token"] = r.Header.Get("X-Token")
+		s.bodies = append(s.bodies, body)
+	}))
+	return s
+}
+
+// body returns the nth body posted
+func (s *webhookServer) body(n int) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bodies[n]
+}
+
+// statuses returns the statuses of the events posted
+func (s *webhookServer) statuses() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []string
+	for _, b := range s.bodies {
+		result = append(result, b["status"].(string))
+	}
+	return result
+}
+
+func newTestWatcher(c *tailtest.Connector, config Config, rules ...*Rule) (*Watcher, *time.Time) {
+	config.IndexPattern = "logstash-[0-9].*"
+	w := New(logrus.WithFields(nil), c, config, rules)
+	// elasticsearch keeps the milliseconds of the timestamps, which bound the entries fetched
+	now := time.Now().Truncate(time.Millisecond)
+	w.now = func() time.Time { return now }
+	return w, &now
+}
+
+func TestWatcher_transitions(t *testing.T) {
+	hook := newWebhookServer()
+	defer hook.Close()
+	rule := &Rule{Name: "errors", Threshold: 5, Window: Duration{time.Minute}, Cooldown: Duration{10 * time.Minute}, Entries: 2,
+		Webhook: &Webhook{URL: hook.URL, Headers: map[string]string{"X-Token": "secret"}}}
+	assert.Nil(t, rule.validate())
+	c := tailtest.New(t)
+	defer c.Close()
+	w, now := newTestWatcher(c, Config{}, rule)
+	ctx := context.Background()
+
+	// below the threshold nothing is sent, the logs older than the window are not counted
+	addLogs(c, now.Add(-2*time.Minute), "x", "y")
+	addLogs(c, *now, "a", "b", "c", "d")
+	assert.Nil(t, w.Evaluate(ctx))
+	assert.Empty(t, hook.statuses())
+
+	// firing is sent once with the latest entries
+	*now = now.Add(time.Second)
+	addLogs(c, *now, "e")
+	assert.Nil(t, w.Evaluate(ctx))
+	assert.Nil(t, w.Evaluate(ctx))
+	assert.Equal(t, []string{StatusFiring}, hook.statuses())
+	fired := hook.body(0)
+	assert.Equal(t, "secret", fired["token"])
+	assert.Equal(t, float64(5), fired["count"])
+	assert.Equal(t, "1m0s", fired["window"])
+	assert.Equal(t, []string{"d", "e"}, messages(fired["entries"]))
+
+	// resolving shares the id of the firing event
+	*now = now.Add(time.Minute)
+	assert.Nil(t, w.Evaluate(ctx))
+	assert.Nil(t, w.Evaluate(ctx))
+	assert.Equal(t, []string{StatusFiring, StatusResolved}, hook.statuses())
+	assert.Equal(t, fired["id"], hook.body(1)["id"])
+
+	// firing again waits for the cooldown, then is sent if still matching
+	*now = now.Add(time.Minute)
+	addLogs(c, *now, strings.Split("abcdefghij", "")...)
+	assert.Nil(t, w.Evaluate(ctx))
+	*now = now.Add(2 * time.Minute)
+	assert.Nil(t, w.Evaluate(ctx))
+	*now = now.Add(3 * time.Minute)
+	addLogs(c, *now, strings.Split("abcdefghij", "")...)
+	assert.Nil(t, w.Evaluate(ctx))
+	assert.Equal(t, []string{StatusFiring, StatusResolved}, hook.statuses())
+	*now = now.Add(4 * time.Minute)
+	addLogs(c, *now, strings.Split("abcdefghij", "")...)
+	assert.Nil(t, w.Evaluate(ctx))
+	assert.Equal(t, []string{StatusFiring, StatusResolved, StatusFiring}, hook.statuses())
+}
+
+func TestWatcher_webhookTemplate(t *testing.T) {
+	hook := newWebhookServer()
+	defer hook.Close()
+	rule := &Rule{Name: "panics", Any: true, Window: Duration{time.Minute},
+		Webhook: &Webhook{URL: hook.URL, Body: `{"text": {{json (printf "%s is %s" .Rule .Status)}}, "status": "{{.Status}}"}`}}
+	assert.Nil(t, rule.validate())
+	c := tailtest.New(t)
+	defer c.Close()
+	w, now := newTestWatcher(c, Config{}, rule)
+	addLogs(c, *now, "a")
+
+	assert.Nil(t, w.Evaluate(context.Background()))
+	assert.Equal(t, "panics is firing", hook.body(0)["text"])
+
+	// invalid bodies fail the evaluation, which is retried
+	rule.body.Parse(`{"text": {{.Rule}}}`)
+	*now = now.Add(2 * time.Minute)
+	assert.NotNil(t, w.Evaluate(context.Background()))
+	assert.Len(t, hook.statuses(), 1)
+	assert.True(t, w.states[0].notified)
+}
+
+func TestWatcher_command(t *testing.T) {
+	dir, err := ioutil.TempDir("", "alert")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+	rule := &Rule{Name: "panics", Any: true, Window: Duration{time.Minute}, Command: `(echo "$ELKLOGS_RULE $ELKLOGS_STATUS $ELKLOGS_COUNT"; cat) >> ` + out}
+	assert.Nil(t, rule.validate())
+	c := tailtest.New(t)
+	defer c.Close()
+	w, now := newTestWatcher(c, Config{ActionTimeout: 5 * time.Second}, rule)
+	c.Add("", *now, map[string]interface{}{"message": "a"})
+	c.Add("", *now, map[string]interface{}{"message": "b"})
+
+	assert.Nil(t, w.Evaluate(context.Background()))
+	ts := now.Format(time.RFC3339Nano)
+	*now = now.Add(2 * time.Minute)
+	assert.Nil(t, w.Evaluate(context.Background()))
+	b, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, "panics firing 2\n"+
+		`{"@timestamp":"`+ts+`","message":"a"}`+"\n"+
+		`{"@timestamp":"`+ts+`","message":"b"}`+"\n"+
+		"panics resolved 0\n", string(b))
+
+	rule.Command = "echo oops; exit 1"
+	addLogs(c, *now, "c")
+	err = w.Evaluate(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestWatcher_dryRun(t *testing.T) {
+	hook := newWebhookServer()
+	defer hook.Close()
+	rule := &Rule{Name: "errors", Threshold: 1, Window: Duration{5 * time.Minute}, Webhook: &Webhook{URL: hook.URL}, Command: "exit 1"}
+	assert.Nil(t, rule.validate())
+	c := tailtest.New(t)
+	defer c.Close()
+	var buf bytes.Buffer
+	w, now := newTestWatcher(c, Config{DryRun: true, Output: &buf}, rule)
+	addLogs(c, *now, "a", "b", "c")
+
+	assert.Nil(t, w.Evaluate(context.Background()))
+	assert.Nil(t, w.Evaluate(context.Background()))
+	assert.Empty(t, hook.statuses())
+	ts := now.Format(time.RFC3339)
+	assert.Equal(t, []string{
+		ts + " firing errors: 3 logs in 5m0s",
+		"  would post to " + hook.URL,
+		"  would run exit 1",
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
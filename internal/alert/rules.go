@@ -0,0 +1,175 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// default number of matching entries attached to the firing events
+const defaultEntries = 10
+
+// Rule fires when the logs matching its query over the window reach the threshold, or on any match
+type Rule struct {
+	Name      string   `json:"name" yaml:"name"`
+	Query     string   `json:"query" yaml:"query"`
+	Threshold int64    `json:"threshold" yaml:"threshold"` // minimum number of logs in the window
+	Any       bool     `json:"any" yaml:"any"`             // fire on any match, instead of a threshold
+	Window    Duration `json:"window" yaml:"window"`
+	Cooldown  Duration `json:"cooldown" yaml:"cooldown"` // minimum time between the firing events of the rule
+	Entries   int      `json:"entries" yaml:"entries"`   // matching entries attached to the firing events
+	Webhook   *Webhook `json:"webhook" yaml:"webhook"`
+	Command   string   `json:"command" yaml:"command"` // shell command run with the matching entries on stdin
+
+	body *template.Template
+}
+
+// Webhook is a json POST sent on the events of a rule
+type Webhook struct {
+	URL     string            `json:"url" yaml:"url"`
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	Body    string            `json:"body" yaml:"body"` // template of the json body, the event itself if empty
+}
+
+// Duration is a duration written as a string, such as 5m
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses the duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("invalid duration %s, expected a string such as 5m", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// UnmarshalYAML parses the duration string
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return errors.New("invalid duration, expected a string such as 5m")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// MarshalJSON writes the duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// rulesFile is the document of a rules file
+type rulesFile struct {
+	Rules []*Rule `json:"rules" yaml:"rules"`
+}
+
+// LoadRules reads the rules of a yaml or json file, files with the .json extension being json
+func LoadRules(path string) ([]*Rule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read rules")
+	}
+	var rules []*Rule
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		rules, err = parseRules(data, true)
+	} else {
+		rules, err = ParseRules(data)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	return rules, nil
+}
+
+// ParseRules parses and validates the rules of a yaml document, or of a json one if it starts with {
+func ParseRules(data []byte) ([]*Rule, error) {
+	return parseRules(data, bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")))
+}
+
+// parseRules parses and validates the rules of a json or yaml document, rejecting unknown fields
+func parseRules(data []byte, isJSON bool) ([]*Rule, error) {
+	var f rulesFile
+	if isJSON {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			return nil, errors.Wrap(err, "invalid rules")
+		}
+	} else if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, errors.Wrap(err, "invalid rules")
+	}
+	if len(f.Rules) == 0 {
+		return nil, errors.New("no rules")
+	}
+
+	names := make(map[string]bool)
+	for _, r := range f.Rules {
+		if r == nil {
+			return nil, errors.New("empty rule")
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("duplicate rule name: %s", r.Name)
+		}
+		names[r.Name] = true
+		if err := r.validate(); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("rule %q", r.Name))
+		}
+	}
+	return f.Rules, nil
+}
+
+// validate checks the rule and sets its defaults
+func (r *Rule) validate() error {
+	switch {
+	case r.Name == "":
+		return errors.New("the name is required")
+	case r.Window.Duration <= 0:
+		return errors.New("the window must be positive")
+	case r.Cooldown.Duration < 0:
+		return errors.New("the cooldown cannot be negative")
+	case r.Any && r.Threshold != 0:
+		return errors.New("any and threshold are exclusive")
+	case !r.Any && r.Threshold <= 0:
+		return errors.New("a positive threshold or any is required")
+	case r.Webhook == nil && r.Command == "":
+		return errors.New("a webhook or command is required")
+	case r.Webhook != nil && r.Webhook.URL == "":
+		return errors.New("the webhook url is required")
+	}
+	if r.Entries == 0 {
+		r.Entries = defaultEntries
+	}
+	if r.Webhook != nil && r.Webhook.Body != "" {
+		body, err := template.New(r.Name).Funcs(template.FuncMap{"json": toJSON}).Parse(r.Webhook.Body)
+		if err != nil {
+			return errors.Wrap(err, "invalid webhook body")
+		}
+		r.body = body
+	}
+	return nil
+}
+
+// toJSON marshals the value, so strings can be embedded in the json templates
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
@@ -0,0 +1,103 @@
+package alert
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]byte(`{
+  "rules": [
+    {
+      "name": "errors",
+      "query": "level:error",
+      "threshold": 10,
+      "window": "5m",
+      "cooldown": "15m",
+      "webhook": {"url": "http://localhost/hook", "body": "{\"text\": {{json .Rule}}}"}
+    },
+    {"name": "panics", "any": true, "window": "1m", "command": "cat > /dev/null"}
+  ]
+}`))
+	assert.Nil(t, err)
+	assert.Len(t, rules, 2)
+	assert.Equal(t, "errors", rules[0].Name)
+	assert.Equal(t, int64(10), rules[0].Threshold)
+	assert.Equal(t, 5*time.Minute, rules[0].Window.Duration)
+	assert.Equal(t, 15*time.Minute, rules[0].Cooldown.Duration)
+	assert.NotNil(t, rules[0].body)
+	assert.Equal(t, defaultEntries, rules[1].Entries)
+	assert.True(t, rules[1].Any)
+	assert.Equal(t, "cat > /dev/null", rules[1].Command)
+}
+
+func TestParseRules_yaml(t *testing.T) {
+	rules, err := ParseRules([]byte(`
+rules:
+  - name: errors
+    query: level:error AND service:api
+    threshold: 10
+    window: 5m
+    webhook:
+      url: http://localhost/hook
+      headers:
+        Authorization: Bearer token
+      body: '{"text": {{json .Rule}}}'
+  - name: panics
+    any: true
+    window: 1m
+    command: cat > /dev/null
+`))
+	assert.Nil(t, err)
+	assert.Len(t, rules, 2)
+	assert.Equal(t, "level:error AND service:api", rules[0].Query)
+	assert.Equal(t, int64(10), rules[0].Threshold)
+	assert.Equal(t, 5*time.Minute, rules[0].Window.Duration)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer token"}, rules[0].Webhook.Headers)
+	assert.NotNil(t, rules[0].body)
+	assert.True(t, rules[1].Any)
+	assert.Equal(t, "cat > /dev/null", rules[1].Command)
+}
+
+func TestLoadRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	doc := "rules:\n  - name: a\n    any: true\n    window: 1m\n    command: x\n"
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "rules.yml"), []byte(doc), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "rules.json"), []byte(doc), 0644))
+
+	rules, err := LoadRules(filepath.Join(dir, "rules.yml"))
+	assert.Nil(t, err)
+	assert.Len(t, rules, 1)
+
+	// the extension selects the format
+	_, err = LoadRules(filepath.Join(dir, "rules.json"))
+	assert.NotNil(t, err)
+}
+
+func TestParseRules_invalid(t *testing.T) {
+	for _, doc := range []string{
+		`{"rules": []}`,
+		`{"rules": [{"name": "a", "any": true, "window": "1m", "command": "x", "unknown": 1}]}`,
+		`{"rules": [{"name": "a", "any": true, "window": 5, "command": "x"}]}`,
+		`{"rules": [{"name": "a", "any": true, "command": "x"}]}`,
+		`{"rules": [{"name": "a", "window": "1m", "command": "x"}]}`,
+		`{"rules": [{"name": "a", "any": true, "threshold": 2, "window": "1m", "command": "x"}]}`,
+		`{"rules": [{"name": "a", "any": true, "window": "1m"}]}`,
+		`{"rules": [{"name": "a", "any": true, "window": "1m", "webhook": {"body": "x"}}]}`,
+		`{"rules": [{"name": "a", "any": true, "window": "1m", "webhook": {"url": "x", "body": "{{.Rule"}}]}`,
+		`{"rules": [{"name": "a", "any": true, "window": "1m", "command": "x"}, {"name": "a", "any": true, "window": "1m", "command": "x"}]}`,
+		"rules:\n  - name: a\n    any: true\n    window: 1m\n    command: x\n    unknown: 1\n",
+		"rules:\n  - name: a\n    any: true\n    window: 5\n    command: x\n",
+		"rules:\n  - name: a\n  any: true\n",
+	} {
+		_, err := ParseRules([]byte(doc))
+		assert.NotNil(t, err, doc)
+	}
+}
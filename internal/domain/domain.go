@@ -18,10 +18,108 @@ type Query struct {
 	FormatFields   []string
 	TimestampField string
 	ShowTime       bool
+	Parallel       int // number of indices queried concurrently, 0 runs a single search
+
+	// client side filters
+	Grep       string // keep logs matching the regexp
+	GrepInvert string // drop logs matching the regexp
+	GrepField  string // field the grep expressions apply to, the processed line if empty
+	Highlight  bool   // highlight the grep matches
+
+	// surrounding logs printed around each match
+	ContextBefore int
+	ContextAfter  int
+	ContextBy     string // field the surrounding logs must share with the match, such as the host
+
+	// logs sharing the correlation field with each printed log, such as the trace id
+	CorrelateBy  string
+	ServiceField string // field the correlated logs are grouped by
+
+	// multi-line grouping, continuation lines are appended to the previous log of the same source
+	MultilinePatterns []string // regexps matching the continuation lines, grouping is disabled if empty
+	MultilineBy       []string // fields identifying the source of the logs, such as the pod
+	MultilineField    string   // field the patterns apply to
+
+	// stop conditions
+	UntilMatch  string        // stop after the first match, query string or /regexp/
+	FailOnMatch bool          // a match on UntilMatch is a failure
+	MaxLines    int           // stop after printing the number of lines, 0 is unlimited
+	Timeout     time.Duration // stop with a timeout after the duration, 0 is unlimited
 }
 
 // LogEntry represents a log entry fetched from the database
 type LogEntry struct {
-	ID      string
-	Message *json.RawMessage
+	ID        string
+	Index     string
+	Timestamp time.Time // sort value of the entry, zero if unknown
+	Message   *json.RawMessage
+}
+
+// EntryKind tells why an entry is written to the output
+type EntryKind int
+
+const (
+	// EntryLog is a log returned by the query
+	EntryLog EntryKind = iota
+	// EntryContext is a log surrounding a match
+	EntryContext
+	// EntryCorrelated is a log sharing the correlation field with a written log
+	EntryCorrelated
+	// EntrySeparator separates groups of surrounding logs and holds no log
+	EntrySeparator
+)
+
+// Entry represents a log flowing through the output pipeline
+type Entry struct {
+	ID        string
+	Index     string
+	Timestamp time.Time              // zero if unknown
+	Source    map[string]interface{} // decoded log, nil for separators
+	Raw       *json.RawMessage
+
+	Kind    EntryKind
+	Line    string  // rendered line, continuation lines included
+	Matches [][]int // byte ranges of the line matched by the grep filter
+}
+
+// Document represents a single document fetched by ID, along with its metadata
+type Document struct {
+	Index       string           `json:"_index"`
+	Type        string           `json:"_type,omitempty"`
+	ID          string           `json:"_id"`
+	Version     *int64           `json:"_version,omitempty"`
+	SeqNo       *int64           `json:"_seq_no,omitempty"`
+	PrimaryTerm *int64           `json:"_primary_term,omitempty"`
+	Routing     string           `json:"_routing,omitempty"`
+	Ingested    *time.Time       `json:"_ingested,omitempty"` // set from the ingest timestamp field of the source
+	Source      *json.RawMessage `json:"_source,omitempty"`
+}
+
+// Index represents an index of the database along with its stats
+type Index struct {
+	Name      string
+	Health    string
+	DocsCount int64
+	StoreSize int64 // size in bytes
+}
+
+// Field represents a field of an index mapping
+type Field struct {
+	Name       string // full path using dot syntax
+	Type       string
+	MultiField bool // indexed from the value of its parent field, such as .keyword
+}
+
+// Bucket represents the number of logs in a time interval
+type Bucket struct {
+	Time   time.Time        `json:"time"`
+	Count  int64            `json:"count"`
+	Series map[string]int64 `json:"series,omitempty"` // number of logs by value of the split field
+}
+
+// Term represents the number of logs with a value of a field
+type Term struct {
+	Value string  `json:"value"`
+	Count int64   `json:"count"`
+	Terms []*Term `json:"terms,omitempty"` // number of logs by value of the second field
 }
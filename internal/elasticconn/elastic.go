@@ -2,6 +2,12 @@ package elasticconn
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/olivere/elastic"
@@ -48,8 +54,8 @@ func New(host string, user string, password string, options ...ElasticOptionFunc
 		}
 	}
 
-	// create the connection
-	db, err := elastic.NewClient(defaultOptions...)
+	// create the connection, the overridden options being applied after the default ones
+	db, err := elastic.NewClient(append(defaultOptions, e.config...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -96,11 +102,269 @@ func (e Elastic) ExecuteQuery(ctx context.Context, indices []string, timestampFi
 	result := make([]*domain.LogEntry, 0, len(r.Hits.Hits))
 	for _, i := range r.Hits.Hits {
 		e := domain.LogEntry{
-			ID:      i.Id,
-			Message: i.Source,
+			ID:        i.Id,
+			Index:     i.Index,
+			Timestamp: sortTimestamp(i.Sort),
+			Message:   i.Source,
 		}
 		result = append(result, &e)
 	}
 
 	return result, nil
 }
+
+// GetDocument retrieves a single document by ID along with its metadata, optionally only including some source fields
+func (e Elastic) GetDocument(ctx context.Context, index string, id string, fields []string) (*domain.Document, error) {
+	params := url.Values{}
+	if len(fields) > 0 {
+		params.Set("_source_include", strings.Join(fields, ","))
+	}
+
+	// the raw request is used since the client does not decode every metadata field, such as _seq_no
+	path := fmt.Sprintf("/%s/_all/%s", url.PathEscape(index), url.PathEscape(id))
+	r, err := e.db.PerformRequest(ctx, "GET", path, params, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc domain.Document
+	if err := json.Unmarshal(r.Body, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// FindDocument returns the indices that hold a document with the ID
+func (e Elastic) FindDocument(ctx context.Context, indices []string, id string) ([]string, error) {
+	r, err := e.db.Search().Index(indices...).Query(elastic.NewIdsQuery().Ids(id)).FetchSource(false).Size(len(indices)).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(r.Hits.Hits))
+	for _, i := range r.Hits.Hits {
+		result = append(result, i.Index)
+	}
+	return result, nil
+}
+
+// GetIndices retrieves the indices in the database along with their stats and health
+func (e Elastic) GetIndices(ctx context.Context) ([]*domain.Index, error) {
+	stats, err := e.db.IndexStats().Metric("docs", "store").Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	health, err := e.db.ClusterHealth().Level("indices").Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*domain.Index, 0, len(stats.Indices))
+	for name, s := range stats.Indices {
+		idx := &domain.Index{Name: name}
+		if s.Primaries != nil && s.Primaries.Docs != nil {
+			idx.DocsCount = s.Primaries.Docs.Count
+		}
+		if s.Total != nil && s.Total.Store != nil {
+			idx.StoreSize = s.Total.Store.SizeInBytes
+		}
+		if h, ok := health.Indices[name]; ok {
+			idx.Health = h.Status
+		}
+		result = append(result, idx)
+	}
+	return result, nil
+}
+
+// GetMappings retrieves the fields of the mappings of each index
+func (e Elastic) GetMappings(ctx context.Context, indices []string) (map[string][]*domain.Field, error) {
+	r, err := e.db.GetMapping().Index(indices...).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]*domain.Field, len(r))
+	for index, m := range r {
+		mappings, _ := asMap(m)["mappings"].(map[string]interface{})
+
+		// mappings are grouped by document type before elastic 7
+		var fields []*domain.Field
+		if _, ok := mappings["properties"]; ok {
+			fields = flattenMapping("", mappings, fields)
+		} else {
+			for _, typ := range mappings {
+				fields = flattenMapping("", asMap(typ), fields)
+			}
+		}
+		sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+		result[index] = fields
+	}
+	return result, nil
+}
+
+// flattenMapping appends the fields of the mapping properties using dot syntax
+func flattenMapping(prefix string, mapping map[string]interface{}, fields []*domain.Field) []*domain.Field {
+	for name, p := range asMap(mapping["properties"]) {
+		property := asMap(p)
+		path := prefix + name
+
+		typ, _ := property["type"].(string)
+		if typ == "" {
+			typ = "object"
+		}
+		fields = append(fields, &domain.Field{Name: path, Type: typ})
+
+		for sub, f := range asMap(property["fields"]) {
+			subType, _ := asMap(f)["type"].(string)
+			fields = append(fields, &domain.Field{Name: path + "." + sub, Type: subType, MultiField: true})
+		}
+		fields = flattenMapping(path+".", property, fields)
+	}
+	return fields
+}
+
+// asMap returns the value as a json object, or an empty one if it is not an object
+func asMap(v interface{}) map[string]interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return map[string]interface{}{}
+	}
+	return m
+}
+
+// Count counts the logs matching the query within the time range
+func (e Elastic) Count(ctx context.Context, indices []string, timestampField string, query string, after *time.Time, before *time.Time) (int64, error) {
+	r, err := e.db.Search().Index(indices...).Query(buildQuery(timestampField, query, after, before)).Size(0).Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return r.TotalHits(), nil
+}
+
+// Histogram counts the logs matching the query within the time range by interval,
+// optionally splitting the counts by the most frequent values of a field
+func (e Elastic) Histogram(ctx context.Context, indices []string, timestampField string, query string, after *time.Time, before *time.Time, interval string, splitBy string, splitSize int) ([]*domain.Bucket, error) {
+	agg := elastic.NewDateHistogramAggregation().Field(timestampField).Interval(interval).MinDocCount(0)
+	if after != nil && before != nil {
+		agg = agg.ExtendedBounds(after.UnixNano()/int64(time.Millisecond), before.UnixNano()/int64(time.Millisecond))
+	}
+	if splitBy != "" {
+		agg = agg.SubAggregation("split", elastic.NewTermsAggregation().Field(splitBy).Size(splitSize))
+	}
+
+	r, err := e.db.Search().Index(indices...).Query(buildQuery(timestampField, query, after, before)).Size(0).Aggregation("histogram", agg).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h, ok := r.Aggregations.DateHistogram("histogram")
+	if !ok {
+		return nil, nil
+	}
+
+	result := make([]*domain.Bucket, 0, len(h.Buckets))
+	for _, b := range h.Buckets {
+		bucket := &domain.Bucket{
+			Time:  time.Unix(0, int64(b.Key)*int64(time.Millisecond)).UTC(),
+			Count: b.DocCount,
+		}
+		if split, ok := b.Terms("split"); ok {
+			bucket.Series = make(map[string]int64, len(split.Buckets))
+			for _, t := range split.Buckets {
+				bucket.Series[fmt.Sprintf("%v", t.Key)] = t.DocCount
+			}
+		}
+		result = append(result, bucket)
+	}
+	return result, nil
+}
+
+// Terms counts the logs matching the query within the time range by the most frequent values of a field,
+// optionally breaking down each value by the most frequent values of a second field.
+// It also returns the total number of logs matching the query.
+func (e Elastic) Terms(ctx context.Context, indices []string, timestampField string, query string, after *time.Time, before *time.Time, field string, size int, subField string, subSize int) ([]*domain.Term, int64, error) {
+	agg := elastic.NewTermsAggregation().Field(field).Size(size)
+	if subField != "" {
+		agg = agg.SubAggregation("terms", elastic.NewTermsAggregation().Field(subField).Size(subSize))
+	}
+
+	r, err := e.db.Search().Index(indices...).Query(buildQuery(timestampField, query, after, before)).Size(0).Aggregation("terms", agg).Do(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	terms, ok := r.Aggregations.Terms("terms")
+	if !ok {
+		return nil, r.TotalHits(), nil
+	}
+
+	result := make([]*domain.Term, 0, len(terms.Buckets))
+	for _, b := range terms.Buckets {
+		term := &domain.Term{Value: termKey(b), Count: b.DocCount}
+		if sub, ok := b.Terms("terms"); ok {
+			term.Terms = make([]*domain.Term, 0, len(sub.Buckets))
+			for _, s := range sub.Buckets {
+				term.Terms = append(term.Terms, &domain.Term{Value: termKey(s), Count: s.DocCount})
+			}
+		}
+		result = append(result, term)
+	}
+	return result, r.TotalHits(), nil
+}
+
+// termKey returns the value of a terms bucket, using the formatted value for dates and booleans
+func termKey(b *elastic.AggregationBucketKeyItem) string {
+	if b.KeyAsString != nil {
+		return *b.KeyAsString
+	}
+	if n, ok := b.Key.(float64); ok {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", b.Key)
+}
+
+// buildQuery builds the query string query filtered by the time range
+func buildQuery(timestampField string, query string, after *time.Time, before *time.Time) elastic.Query {
+	q := elastic.NewBoolQuery()
+	if query != "" {
+		q = q.Must(elastic.NewQueryStringQuery(query))
+	}
+	if after != nil || before != nil {
+		r := elastic.NewRangeQuery(timestampField)
+		if after != nil {
+			r = r.Gte(after.Format(time.RFC3339))
+		}
+		if before != nil {
+			r = r.Lte(before.Format(time.RFC3339))
+		}
+		q = q.Filter(r)
+	}
+	return q
+}
+
+// sortTimestamp converts the date sort value of a hit (epoch millis) into a time
+func sortTimestamp(values []interface{}) time.Time {
+	if len(values) == 0 {
+		return time.Time{}
+	}
+	var ms int64
+	switch v := values[0].(type) {
+	case float64:
+		ms = int64(v)
+	case int64:
+		ms = v
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return time.Time{}
+		}
+		ms = n
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}
+		}
+		ms = n
+	default:
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC()
+}
@@ -3,8 +3,12 @@ package elasticconn_test
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/pmdcosta/elklogs/internal/domain"
 	"github.com/pmdcosta/elklogs/internal/elasticconn"
 	"github.com/stretchr/testify/assert"
 )
@@ -23,6 +27,21 @@ func MustCreateConnector(t *testing.T) *Elastic {
 	return c
 }
 
+// MustCreateStubConnector returns a new connector to a stub server for testing
+func MustCreateStubConnector(t *testing.T, handler http.HandlerFunc) (*Elastic, *httptest.Server) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `{"version":{"number":"5.6.0"}}`)
+			return
+		}
+		handler(w, r)
+	}))
+	e, err := elasticconn.New(s.URL, "", "")
+	assert.Nil(t, err)
+	return &Elastic{e}, s
+}
+
 func TestConnector_Connect(t *testing.T) {
 	MustCreateConnector(t)
 }
@@ -55,3 +74,130 @@ func testConnector_ExecuteQuery_query(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Len(t, r, 20)
 }
+
+func TestConnector_GetDocument(t *testing.T) {
+	c, s := MustCreateStubConnector(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/logstash-2018.11.28/_all/abc", r.URL.Path)
+		assert.Equal(t, "message", r.URL.Query().Get("_source_include"))
+		fmt.Fprint(w, `{"_index":"logstash-2018.11.28","_type":"doc","_id":"abc","_version":1,"_seq_no":7,"_primary_term":1,"found":true,"_source":{"message":"test"}}`)
+	})
+	defer s.Close()
+
+	d, err := c.GetDocument(context.Background(), "logstash-2018.11.28", "abc", []string{"message"})
+	assert.Nil(t, err)
+	assert.Equal(t, "logstash-2018.11.28", d.Index)
+	assert.Equal(t, int64(7), *d.SeqNo)
+	assert.Equal(t, `{"message":"test"}`, string(*d.Source))
+}
+
+func TestConnector_FindDocument(t *testing.T) {
+	c, s := MustCreateStubConnector(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/logstash-2018.11.28,logstash-2018.11.29/_search", r.URL.Path)
+		fmt.Fprint(w, `{"hits":{"total":1,"hits":[{"_index":"logstash-2018.11.29","_type":"doc","_id":"abc"}]}}`)
+	})
+	defer s.Close()
+
+	r, err := c.FindDocument(context.Background(), []string{"logstash-2018.11.28", "logstash-2018.11.29"}, "abc")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"logstash-2018.11.29"}, r)
+}
+
+func TestConnector_GetIndices(t *testing.T) {
+	c, s := MustCreateStubConnector(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_stats/docs,store":
+			fmt.Fprint(w, `{"indices":{"logstash-2018.11.28":{"primaries":{"docs":{"count":10}},"total":{"docs":{"count":20},"store":{"size_in_bytes":2048}}}}}`)
+		case "/_cluster/health":
+			assert.Equal(t, "indices", r.URL.Query().Get("level"))
+			fmt.Fprint(w, `{"status":"yellow","indices":{"logstash-2018.11.28":{"status":"green"}}}`)
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	})
+	defer s.Close()
+
+	r, err := c.GetIndices(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, r, 1)
+	assert.Equal(t, "logstash-2018.11.28", r[0].Name)
+	assert.Equal(t, int64(10), r[0].DocsCount)
+	assert.Equal(t, int64(2048), r[0].StoreSize)
+	assert.Equal(t, "green", r[0].Health)
+}
+
+func TestConnector_GetMappings(t *testing.T) {
+	c, s := MustCreateStubConnector(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/logstash-2018.11.28,logstash-2018.11.29/_mapping/_all", r.URL.Path)
+		fmt.Fprint(w, `{
+			"logstash-2018.11.28":{"mappings":{"doc":{"properties":{
+				"@timestamp":{"type":"date"},
+				"message":{"type":"text","fields":{"keyword":{"type":"keyword"}}},
+				"kubernetes":{"properties":{"pod":{"properties":{"name":{"type":"keyword"}}}}}
+			}}}},
+			"logstash-2018.11.29":{"mappings":{"properties":{"message":{"type":"keyword"}}}}
+		}`)
+	})
+	defer s.Close()
+
+	r, err := c.GetMappings(context.Background(), []string{"logstash-2018.11.28", "logstash-2018.11.29"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*domain.Field{
+		{Name: "@timestamp", Type: "date"},
+		{Name: "kubernetes", Type: "object"},
+		{Name: "kubernetes.pod", Type: "object"},
+		{Name: "kubernetes.pod.name", Type: "keyword"},
+		{Name: "message", Type: "text"},
+		{Name: "message.keyword", Type: "keyword", MultiField: true},
+	}, r["logstash-2018.11.28"])
+	assert.Equal(t, []*domain.Field{{Name: "message", Type: "keyword"}}, r["logstash-2018.11.29"])
+}
+
+func TestConnector_Count(t *testing.T) {
+	c, s := MustCreateStubConnector(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/logstash-2018.11.28/_search", r.URL.Path)
+		fmt.Fprint(w, `{"hits":{"total":42,"hits":[]}}`)
+	})
+	defer s.Close()
+
+	r, err := c.Count(context.Background(), []string{"logstash-2018.11.28"}, "@timestamp", "level:error", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), r)
+}
+
+func TestConnector_Histogram(t *testing.T) {
+	c, s := MustCreateStubConnector(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/logstash-2018.11.28/_search", r.URL.Path)
+		fmt.Fprint(w, `{"hits":{"total":3,"hits":[]},"aggregations":{"histogram":{"buckets":[
+			{"key":1543363200000,"doc_count":2,"split":{"buckets":[{"key":"a","doc_count":1},{"key":"b","doc_count":1}]}},
+			{"key":1543363260000,"doc_count":1,"split":{"buckets":[{"key":"a","doc_count":1}]}}
+		]}}}`)
+	})
+	defer s.Close()
+
+	r, err := c.Histogram(context.Background(), []string{"logstash-2018.11.28"}, "@timestamp", "", nil, nil, "1m", "host", 5)
+	assert.Nil(t, err)
+	assert.Len(t, r, 2)
+	assert.Equal(t, "2018-11-28T00:00:00Z", r[0].Time.Format(time.RFC3339))
+	assert.Equal(t, int64(2), r[0].Count)
+	assert.Equal(t, map[string]int64{"a": 1, "b": 1}, r[0].Series)
+	assert.Equal(t, map[string]int64{"a": 1}, r[1].Series)
+}
+
+func TestConnector_Terms(t *testing.T) {
+	c, s := MustCreateStubConnector(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/logstash-2018.11.28/_search", r.URL.Path)
+		fmt.Fprint(w, `{"hits":{"total":10,"hits":[]},"aggregations":{"terms":{"buckets":[
+			{"key":"web-1","doc_count":6,"terms":{"buckets":[{"key":500,"doc_count":4},{"key":502,"doc_count":2}]}},
+			{"key":"web-2","doc_count":3,"terms":{"buckets":[{"key":500,"doc_count":3}]}}
+		]}}}`)
+	})
+	defer s.Close()
+
+	r, total, err := c.Terms(context.Background(), []string{"logstash-2018.11.28"}, "@timestamp", "level:error", nil, nil, "host", 10, "status", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), total)
+	assert.Equal(t, []*domain.Term{
+		{Value: "web-1", Count: 6, Terms: []*domain.Term{{Value: "500", Count: 4}, {Value: "502", Count: 2}}},
+		{Value: "web-2", Count: 3, Terms: []*domain.Term{{Value: "500", Count: 3}}},
+	}, r)
+}
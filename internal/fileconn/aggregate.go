@@ -0,0 +1,410 @@
+package fileconn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+)
+
+// maxBuckets is the number of histogram buckets above which the interval is rejected, as in elasticsearch
+const maxBuckets = 10000
+
+// GetIndices returns the indices of the documents with their number of documents and size.
+// The size is the one of the json documents, and the files have no health.
+func (f *Files) GetIndices(ctx context.Context) ([]*domain.Index, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	docs, err := f.search(nil, "@timestamp", "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*domain.Index)
+	var result []*domain.Index
+	for _, d := range docs {
+		idx, ok := byName[d.index]
+		if !ok {
+			idx = &domain.Index{Name: d.index}
+			byName[d.index] = idx
+			result = append(result, idx)
+		}
+		idx.DocsCount++
+		idx.StoreSize += int64(len(d.raw))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// GetMappings returns the fields of the documents of each index, with the types elasticsearch would map them to.
+// A field keeps the type of its first value, except integers becoming floats.
+func (f *Files) GetMappings(ctx context.Context, indices []string) (map[string][]*domain.Field, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	docs, err := f.search(indices, "@timestamp", "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	byIndex := make(map[string]map[string]*domain.Field)
+	for _, d := range docs {
+		fields, ok := byIndex[d.index]
+		if !ok {
+			fields = make(map[string]*domain.Field)
+			byIndex[d.index] = fields
+		}
+		mapFields("", d.source, fields)
+	}
+
+	result := make(map[string][]*domain.Field, len(byIndex))
+	for index, fields := range byIndex {
+		list := make([]*domain.Field, 0, len(fields))
+		for _, field := range fields {
+			list = append(list, field)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		result[index] = list
+	}
+	return result, nil
+}
+
+// mapFields adds the fields of the object using dot syntax
+func mapFields(prefix string, source map[string]interface{}, fields map[string]*domain.Field) {
+	for name, v := range source {
+		path := prefix + name
+		// arrays are mapped by their first value
+		if a, ok := v.([]interface{}); ok {
+			v = nil
+			for _, e := range a {
+				if e != nil {
+					v = e
+					break
+				}
+			}
+		}
+		typ := fieldType(v)
+		if typ == "" {
+			continue
+		}
+		if field, ok := fields[path]; !ok {
+			fields[path] = &domain.Field{Name: path, Type: typ}
+		} else if field.Type == "long" && typ == "float" {
+			field.Type = typ
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			mapFields(path+".", m, fields)
+		}
+	}
+}
+
+// fieldType returns the type of the value as mapped dynamically by elasticsearch, empty for nulls
+func fieldType(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "long"
+		}
+		return "float"
+	case string:
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			if _, ok := parseTime(v); ok {
+				return "date"
+			}
+		}
+		return "text"
+	}
+	return ""
+}
+
+// GetDocument returns the document of the index with the ID, optionally only including some source fields.
+// The fields may use wildcards.
+func (f *Files) GetDocument(ctx context.Context, index string, id string, fields []string) (*domain.Document, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	docs, err := f.search([]string{index}, "@timestamp", "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range docs {
+		if d.id != id {
+			continue
+		}
+		source := d.raw
+		if len(fields) > 0 {
+			patterns := make([]*regexp.Regexp, 0, len(fields))
+			for _, field := range fields {
+				patterns = append(patterns, regexp.MustCompile("^"+strings.Replace(regexp.QuoteMeta(field), `\*`, ".*", -1)+"$"))
+			}
+			if source, err = json.Marshal(includeFields("", d.source, patterns)); err != nil {
+				return nil, err
+			}
+		}
+		return &domain.Document{Index: d.index, ID: d.id, Source: &source}, nil
+	}
+	return nil, fmt.Errorf("document %s not found in %s", id, index)
+}
+
+// includeFields returns the fields of the object matching the patterns, and the objects holding them
+func includeFields(prefix string, source map[string]interface{}, patterns []*regexp.Regexp) map[string]interface{} {
+	result := make(map[string]interface{})
+	for name, v := range source {
+		path := prefix + name
+		matched := false
+		for _, p := range patterns {
+			if p.MatchString(path) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			result[name] = v
+			continue
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			if nested := includeFields(path+".", m, patterns); len(nested) > 0 {
+				result[name] = nested
+			}
+		}
+	}
+	return result
+}
+
+// FindDocument returns the indices that hold a document with the ID
+func (f *Files) FindDocument(ctx context.Context, indices []string, id string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	docs, err := f.search(indices, "@timestamp", "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var result []string
+	for _, d := range docs {
+		if d.id == id && !seen[d.index] {
+			seen[d.index] = true
+			result = append(result, d.index)
+		}
+	}
+	return result, nil
+}
+
+// Histogram counts the documents of the indices matching the query within the time range by interval,
+// optionally splitting the counts by the most frequent values of a field. The intervals are the ones of
+// elasticsearch: fixed durations such as 90s or 10m, or the calendar 1w, 1M, 1q and 1y and their names.
+// The buckets span the time range if set, otherwise the documents, including the empty ones.
+func (f *Files) Histogram(ctx context.Context, indices []string, timestampField string, query string, after *time.Time, before *time.Time, interval string, splitBy string, splitSize int) ([]*domain.Bucket, error) {
+	iv, err := parseInterval(interval)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	docs, err := f.search(indices, timestampField, query, after, before)
+	if err != nil {
+		return nil, err
+	}
+
+	// documents without a timestamp are not counted, as in elasticsearch
+	byStart := make(map[time.Time][]*document)
+	var first, last time.Time
+	for _, d := range docs {
+		ts := d.timestampOf(timestampField)
+		if ts.IsZero() {
+			continue
+		}
+		start := iv.start(ts)
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if last.IsZero() || start.After(last) {
+			last = start
+		}
+		byStart[start] = append(byStart[start], d)
+	}
+	if after != nil && before != nil {
+		if first.IsZero() || iv.start(*after).Before(first) {
+			first = iv.start(*after)
+		}
+		if last.IsZero() || iv.start(*before).After(last) {
+			last = iv.start(*before)
+		}
+	}
+	if first.IsZero() {
+		return nil, nil
+	}
+
+	var result []*domain.Bucket
+	for t := first; !t.After(last); t = iv.next(t) {
+		if len(result) == maxBuckets {
+			return nil, fmt.Errorf("more than %d buckets of %s, use a larger interval", maxBuckets, interval)
+		}
+		b := &domain.Bucket{Time: t, Count: int64(len(byStart[t]))}
+		if splitBy != "" {
+			terms := topTerms(byStart[t], splitBy, splitSize)
+			b.Series = make(map[string]int64, len(terms))
+			for _, term := range terms {
+				b.Series[term.value] = int64(len(term.docs))
+			}
+		}
+		result = append(result, b)
+	}
+	return result, nil
+}
+
+// Terms counts the documents of the indices matching the query within the time range by the most frequent values
+// of a field, optionally breaking down each value by the most frequent values of a second field.
+// It also returns the total number of documents matching the query.
+func (f *Files) Terms(ctx context.Context, indices []string, timestampField string, query string, after *time.Time, before *time.Time, field string, size int, subField string, subSize int) ([]*domain.Term, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	docs, err := f.search(indices, timestampField, query, after, before)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	terms := topTerms(docs, field, size)
+	result := make([]*domain.Term, 0, len(terms))
+	for _, t := range terms {
+		term := &domain.Term{Value: t.value, Count: int64(len(t.docs))}
+		if subField != "" {
+			sub := topTerms(t.docs, subField, subSize)
+			term.Terms = make([]*domain.Term, 0, len(sub))
+			for _, s := range sub {
+				term.Terms = append(term.Terms, &domain.Term{Value: s.value, Count: int64(len(s.docs))})
+			}
+		}
+		result = append(result, term)
+	}
+	return result, int64(len(docs)), nil
+}
+
+// termDocs holds the documents with a value of a field
+type termDocs struct {
+	value string
+	docs  []*document
+}
+
+// topTerms returns the most frequent values of the field in the documents, with the documents holding them.
+// Documents with several values count for each of them. Values with the same count are sorted by value.
+func topTerms(docs []*document, field string, size int) []*termDocs {
+	byValue := make(map[string]*termDocs)
+	for _, d := range docs {
+		seen := make(map[string]bool)
+		for _, v := range values(d.source, field) {
+			value := text(v)
+			if seen[value] {
+				continue
+			}
+			seen[value] = true
+			t, ok := byValue[value]
+			if !ok {
+				t = &termDocs{value: value}
+				byValue[value] = t
+			}
+			t.docs = append(t.docs, d)
+		}
+	}
+
+	result := make([]*termDocs, 0, len(byValue))
+	for _, t := range byValue {
+		result = append(result, t)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if len(result[i].docs) == len(result[j].docs) {
+			return result[i].value < result[j].value
+		}
+		return len(result[i].docs) > len(result[j].docs)
+	})
+	if size > 0 && len(result) > size {
+		result = result[:size]
+	}
+	return result
+}
+
+// interval is a histogram interval, of fixed duration or of calendar months or weeks
+type interval struct {
+	fixed  time.Duration
+	months int
+	week   bool
+}
+
+// calendar intervals by name and unit
+var calendarIntervals = map[string]interval{
+	"second":  {fixed: time.Second},
+	"minute":  {fixed: time.Minute},
+	"hour":    {fixed: time.Hour},
+	"day":     {fixed: 24 * time.Hour},
+	"week":    {week: true},
+	"1w":      {week: true},
+	"month":   {months: 1},
+	"1M":      {months: 1},
+	"quarter": {months: 3},
+	"1q":      {months: 3},
+	"year":    {months: 12},
+	"1y":      {months: 12},
+}
+
+// fixed interval units
+var intervalUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+}
+
+// parseInterval parses a histogram interval
+func parseInterval(s string) (interval, error) {
+	if iv, ok := calendarIntervals[s]; ok {
+		return iv, nil
+	}
+	unit := strings.TrimLeft(s, "0123456789")
+	n, err := strconv.Atoi(strings.TrimSuffix(s, unit))
+	if d, ok := intervalUnits[unit]; ok && err == nil && n > 0 {
+		return interval{fixed: time.Duration(n) * d}, nil
+	}
+	return interval{}, fmt.Errorf("invalid interval: %s", s)
+}
+
+// start returns the start of the interval holding the time, in UTC
+func (iv interval) start(t time.Time) time.Time {
+	t = t.UTC()
+	switch {
+	case iv.months > 0:
+		month := (int(t.Month()) - 1) / iv.months * iv.months
+		return time.Date(t.Year(), time.Month(month+1), 1, 0, 0, 0, 0, time.UTC)
+	case iv.week:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		// weeks start on monday
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	ns := t.UnixNano()
+	r := ns % int64(iv.fixed)
+	if r < 0 {
+		r += int64(iv.fixed)
+	}
+	return time.Unix(0, ns-r).UTC()
+}
+
+// next returns the start of the interval following the one starting at the time
+func (iv interval) next(t time.Time) time.Time {
+	switch {
+	case iv.months > 0:
+		return t.AddDate(0, iv.months, 0)
+	case iv.week:
+		return t.AddDate(0, 0, 7)
+	}
+	return t.Add(iv.fixed)
+}
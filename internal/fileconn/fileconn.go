@@ -0,0 +1,417 @@
+// Package fileconn queries logs exported to files instead of an elasticsearch cluster, such as the json
+// files written by --output-file-format json or the hits of the search api. The files hold a json document
+// per line, and may be gzipped. The documents are loaded in memory and read again as the files grow,
+// so following them tails the lines appended since the last query.
+package fileconn
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+)
+
+// DefaultIndexFormat names the index of the documents without one after their day,
+// so they match the default index pattern
+const DefaultIndexFormat = "logstash-2006.01.02"
+
+// Config configures the file connector
+type Config struct {
+	IndexFormat string     // time layout naming the index of the documents without one, by their timestamp
+	After       *time.Time // only the documents after the time are queried
+	Before      *time.Time // only the documents before the time are queried
+}
+
+// Files queries the documents of the files matching a glob pattern
+type Files struct {
+	pattern string
+	config  Config
+	now     func() time.Time
+
+	mu    sync.Mutex
+	files map[string]*file
+	names []string // names of the files, in the order of their documents
+}
+
+// file holds the documents read from a file
+type file struct {
+	name   string
+	info   os.FileInfo
+	offset int64 // bytes read, the documents of gzipped files being read again when they change
+	lines  int   // lines read, which number the documents without an id
+	open   bool  // the last line read had no newline yet
+	docs   []*document
+}
+
+// document is a log read from a file
+type document struct {
+	id     string
+	index  string
+	source map[string]interface{}
+	raw    json.RawMessage
+
+	timestampField string // field of the timestamp, parsed again when the query uses another field
+	timestamp      time.Time
+}
+
+// hit is a document exported with its metadata, as returned by the search api
+type hit struct {
+	Index  string          `json:"_index"`
+	ID     string          `json:"_id"`
+	Source json.RawMessage `json:"_source"`
+}
+
+// New creates a connector querying the files matching the glob pattern.
+// The pattern is expanded again on each query, so new files are found when following.
+func New(pattern string, config Config) (*Files, error) {
+	if config.IndexFormat == "" {
+		config.IndexFormat = DefaultIndexFormat
+	}
+	f := &Files{pattern: pattern, config: config, now: time.Now, files: make(map[string]*file)}
+	if err := f.refresh(); err != nil {
+		return nil, err
+	}
+	if len(f.names) == 0 {
+		return nil, fmt.Errorf("no file matches %s", pattern)
+	}
+	return f, nil
+}
+
+// Close releases the documents
+func (f *Files) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files = make(map[string]*file)
+	f.names = nil
+	return nil
+}
+
+// GetIndexNames returns the indices of the documents
+func (f *Files) GetIndexNames(ctx context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.refresh(); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var indices []string
+	for _, name := range f.names {
+		for _, d := range f.files[name].docs {
+			if !seen[d.index] {
+				seen[d.index] = true
+				indices = append(indices, d.index)
+			}
+		}
+	}
+	sort.Strings(indices)
+	return indices, nil
+}
+
+// ExecuteQuery returns the documents of the indices matching the query, sorted by their timestamp,
+// oldest first if order is true and newest first otherwise. Documents sharing a timestamp keep their order
+// in the files. All the matching documents are returned if entries is not positive.
+func (f *Files) ExecuteQuery(ctx context.Context, indices []string, timestampField string, order bool, query string, entries int) ([]*domain.LogEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	docs, err := f.search(indices, timestampField, query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		return docs[i].timestamp.Before(docs[j].timestamp)
+	})
+	if !order {
+		for i, j := 0, len(docs)-1; i < j; i, j = i+1, j-1 {
+			docs[i], docs[j] = docs[j], docs[i]
+		}
+	}
+	if entries > 0 && len(docs) > entries {
+		docs = docs[:entries]
+	}
+
+	result := make([]*domain.LogEntry, 0, len(docs))
+	for _, d := range docs {
+		raw := d.raw
+		result = append(result, &domain.LogEntry{ID: d.id, Index: d.index, Timestamp: d.timestamp, Message: &raw})
+	}
+	return result, nil
+}
+
+// Count counts the documents of the indices matching the query within the time range
+func (f *Files) Count(ctx context.Context, indices []string, timestampField string, query string, after *time.Time, before *time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	docs, err := f.search(indices, timestampField, query, after, before)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(docs)), nil
+}
+
+// search reads the new documents and returns the ones matching, in the order of the files.
+// The files must be locked.
+func (f *Files) search(indices []string, timestampField string, query string, after *time.Time, before *time.Time) ([]*document, error) {
+	if err := f.refresh(); err != nil {
+		return nil, err
+	}
+	// the query is parsed on each search, so the dates relative to now move with the clock when following
+	m, err := parseQuery(query, f.now())
+	if err != nil {
+		return nil, err
+	}
+
+	// no indices search all of them, as in elasticsearch
+	selected := make(map[string]bool, len(indices))
+	for _, idx := range indices {
+		selected[idx] = true
+	}
+	after, before = latest(after, f.config.After), earliest(before, f.config.Before)
+
+	var docs []*document
+	for _, name := range f.names {
+		for _, d := range f.files[name].docs {
+			if len(selected) > 0 && !selected[d.index] {
+				continue
+			}
+			ts := d.timestampOf(timestampField)
+			if (after != nil || before != nil) && ts.IsZero() {
+				continue
+			}
+			if (after != nil && ts.Before(*after)) || (before != nil && ts.After(*before)) {
+				continue
+			}
+			if m.match(d.source) {
+				docs = append(docs, d)
+			}
+		}
+	}
+	return docs, nil
+}
+
+// refresh expands the pattern and reads the documents appended to the files, or all of them if they
+// were replaced or truncated. The files that no longer exist are dropped. The files must be locked.
+func (f *Files) refresh() error {
+	names, err := filepath.Glob(f.pattern)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	files := make(map[string]*file, len(names))
+	kept := names[:0]
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		fl, ok := f.files[name]
+		if !ok || !os.SameFile(fl.info, info) || info.Size() < fl.offset {
+			fl = &file{name: name}
+		}
+		if err := fl.read(info, f.config.IndexFormat); err != nil {
+			return err
+		}
+		files[name] = fl
+		kept = append(kept, name)
+	}
+	f.files, f.names = files, kept
+	return nil
+}
+
+// read reads the documents appended to the file since the last read
+func (fl *file) read(info os.FileInfo, indexFormat string) error {
+	if fl.info != nil && info.Size() == fl.offset && info.ModTime().Equal(fl.info.ModTime()) {
+		return nil
+	}
+	in, err := os.Open(fl.name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// gzipped files cannot be read from an offset, so they are read again when they change
+	r := bufio.NewReader(in)
+	if magic, _ := r.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("%s: %s", fl.name, err)
+		}
+		data, err := ioutil.ReadAll(gz)
+		if err != nil {
+			return fmt.Errorf("%s: %s", fl.name, err)
+		}
+		fl.docs, fl.lines, fl.open = nil, 0, false
+		if _, err := fl.parse(data, true, indexFormat); err != nil {
+			return err
+		}
+		fl.info, fl.offset = info, info.Size()
+		return nil
+	}
+
+	if _, err := in.Seek(fl.offset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	n, err := fl.parse(data, false, indexFormat)
+	if err != nil {
+		return err
+	}
+	fl.info, fl.offset = info, fl.offset+int64(n)
+	return nil
+}
+
+// parse parses the documents of the lines, returning the bytes consumed. A last line without a newline
+// is only consumed if it is a whole document, otherwise it is still being written, unless the data is complete.
+func (fl *file) parse(data []byte, complete bool, indexFormat string) (int, error) {
+	consumed := 0
+	for consumed < len(data) {
+		line := data[consumed:]
+		end := bytes.IndexByte(line, '\n')
+		last := end < 0
+		if last {
+			end = len(line)
+		} else {
+			line = line[:end]
+		}
+		line = bytes.TrimSpace(line)
+
+		// the newline ending a document read before is not another line
+		if consumed == 0 && end == 0 && !last && fl.open {
+			fl.open = false
+			consumed++
+			continue
+		}
+		if len(line) > 0 {
+			d, err := parseDocument(line)
+			if err != nil && last && !complete {
+				break
+			}
+			if err != nil {
+				return consumed, fmt.Errorf("%s:%d: %s", fl.name, fl.lines+1, err)
+			}
+			if d.id == "" {
+				d.id = filepath.Base(fl.name) + ":" + strconv.Itoa(fl.lines+1)
+			}
+			// documents without a timestamp are in the index of year 1
+			if d.index == "" {
+				d.index = d.timestampOf("@timestamp").UTC().Format(indexFormat)
+			}
+			fl.docs = append(fl.docs, d)
+		}
+		fl.lines++
+		fl.open = last
+		consumed += end
+		if !last {
+			consumed++
+		}
+	}
+	return consumed, nil
+}
+
+// parseDocument parses a line holding a log document, or a search hit with its metadata
+func parseDocument(line []byte) (*document, error) {
+	d := &document{raw: json.RawMessage(line)}
+	if err := decode(line, &d.source); err != nil {
+		return nil, err
+	}
+	if d.source == nil {
+		return nil, fmt.Errorf("not a json object")
+	}
+	if _, ok := d.source["_source"].(map[string]interface{}); !ok {
+		return d, nil
+	}
+
+	var h hit
+	if err := json.Unmarshal(line, &h); err != nil {
+		return nil, err
+	}
+	d = &document{id: h.ID, index: h.Index, raw: h.Source}
+	if err := decode(h.Source, &d.source); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// decode decodes the json, keeping the numbers as they were written
+func decode(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after the document")
+	}
+	return nil
+}
+
+// timestampOf returns the time of the document in the field, zero if missing
+func (d *document) timestampOf(field string) time.Time {
+	if d.timestampField == field {
+		return d.timestamp
+	}
+	d.timestampField, d.timestamp = field, time.Time{}
+	for _, v := range values(d.source, field) {
+		if t, ok := parseTime(text(v)); ok {
+			d.timestamp = t
+			break
+		}
+	}
+	return d.timestamp
+}
+
+// layouts of the dates in the documents and queries, besides epoch milliseconds
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000Z0700",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseTime parses a date or epoch milliseconds, the dates without a zone being UTC
+func parseTime(s string) (time.Time, bool) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)).UTC(), true
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// latest returns the latest of the times, nil if both are
+func latest(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.After(*a)) {
+		return b
+	}
+	return a
+}
+
+// earliest returns the earliest of the times, nil if both are
+func earliest(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.Before(*a)) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,336 @@
+package fileconn
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// the connector is used by the tail engine and the counts
+var _ tail.CountConnector = &Files{}
+
+const exported = `{"@timestamp":"2018-11-29T10:00:02.000Z","level":"info","message":"third"}
+{"@timestamp":"2018-11-28T23:00:00.000Z","level":"error","message":"first"}
+
+{"@timestamp":"2018-11-29T10:00:01.000Z","level":"error","message":"second"}
+`
+
+const hits = `{"_index":"app-2018.11.29","_type":"doc","_id":"a","_score":1,"_source":{"@timestamp":"2018-11-29T10:00:00.500Z","message":"hit a"}}
+{"_index":"app-2018.11.30","_type":"doc","_id":"b","_score":1,"_source":{"@timestamp":1543536000000,"message":"hit b"}}
+`
+
+// tempDir creates a directory with the files
+func tempDir(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "fileconn")
+	assert.Nil(t, err)
+	for name, content := range files {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+	return dir
+}
+
+func writeFile(t *testing.T, name string, content string) {
+	assert.Nil(t, ioutil.WriteFile(name, []byte(content), 0644))
+}
+
+func appendFile(t *testing.T, name string, content string) {
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString(content)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+func gzipped(t *testing.T, content string) string {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(content))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	return buf.String()
+}
+
+// messages returns the messages of the logs
+func messages(t *testing.T, logs []*domain.LogEntry) []string {
+	result := make([]string, 0, len(logs))
+	for _, l := range logs {
+		v, err := tail.FieldValue(l.Message, "message")
+		assert.Nil(t, err)
+		result = append(result, v)
+	}
+	return result
+}
+
+func TestFiles_ExecuteQuery(t *testing.T) {
+	dir := tempDir(t, map[string]string{"logs.ndjson": exported})
+	defer os.RemoveAll(dir)
+	f, err := New(filepath.Join(dir, "*.ndjson"), Config{})
+	assert.Nil(t, err)
+	defer f.Close()
+	ctx := context.Background()
+
+	indices, err := f.GetIndexNames(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"logstash-2018.11.28", "logstash-2018.11.29"}, indices)
+
+	logs, err := f.ExecuteQuery(ctx, nil, "@timestamp", false, "", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"third", "second", "first"}, messages(t, logs))
+	assert.Equal(t, "logs.ndjson:1", logs[0].ID)
+	assert.Equal(t, "logs.ndjson:4", logs[1].ID)
+	assert.Equal(t, "logstash-2018.11.29", logs[0].Index)
+	assert.Equal(t, time.Date(2018, 11, 29, 10, 0, 2, 0, time.UTC), logs[0].Timestamp)
+
+	logs, err = f.ExecuteQuery(ctx, nil, "@timestamp", true, "", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first", "second"}, messages(t, logs))
+
+	logs, err = f.ExecuteQuery(ctx, []string{"logstash-2018.11.29"}, "@timestamp", false, "level:error", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"second"}, messages(t, logs))
+
+	logs, err = f.ExecuteQuery(ctx, nil, "@timestamp", true, `@timestamp:["2018-11-29T00:00:00.000Z" TO "2018-11-29T10:00:01.000Z"]`, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"second"}, messages(t, logs))
+
+	_, err = f.ExecuteQuery(ctx, nil, "@timestamp", true, "level:(error", 10)
+	assert.NotNil(t, err)
+}
+
+func TestFiles_formats(t *testing.T) {
+	dir := tempDir(t, map[string]string{
+		"logs-1.ndjson.gz": gzipped(t, exported),
+		"hits.json":        hits,
+	})
+	defer os.RemoveAll(dir)
+	f, err := New(filepath.Join(dir, "*"), Config{})
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	indices, err := f.GetIndexNames(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app-2018.11.29", "app-2018.11.30", "logstash-2018.11.28", "logstash-2018.11.29"}, indices)
+
+	logs, err := f.ExecuteQuery(ctx, nil, "@timestamp", true, "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"first", "hit a", "second", "third", "hit b"}, messages(t, logs))
+	assert.Equal(t, "a", logs[1].ID)
+	assert.Equal(t, "app-2018.11.29", logs[1].Index)
+	assert.Equal(t, `{"@timestamp":"2018-11-29T10:00:00.500Z","message":"hit a"}`, string(*logs[1].Message))
+	assert.Equal(t, "logs-1.ndjson.gz:2", logs[0].ID)
+}
+
+func TestFiles_timeRange(t *testing.T) {
+	dir := tempDir(t, map[string]string{"logs.ndjson": exported + `{"message":"no time"}` + "\n"})
+	defer os.RemoveAll(dir)
+	after := time.Date(2018, 11, 29, 0, 0, 0, 0, time.UTC)
+	f, err := New(filepath.Join(dir, "logs.ndjson"), Config{After: &after})
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	logs, err := f.ExecuteQuery(ctx, nil, "@timestamp", true, "", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"second", "third"}, messages(t, logs))
+
+	before := time.Date(2018, 11, 29, 10, 0, 1, 0, time.UTC)
+	n, err := f.Count(ctx, nil, "@timestamp", "", nil, &before)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = f.Count(ctx, nil, "@timestamp", "level:info", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// documents without a timestamp are only found without a time range
+	f, err = New(filepath.Join(dir, "logs.ndjson"), Config{})
+	assert.Nil(t, err)
+	logs, err = f.ExecuteQuery(ctx, []string{"logstash-0001.01.01"}, "@timestamp", true, "", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"no time"}, messages(t, logs))
+}
+
+func TestFiles_follow(t *testing.T) {
+	dir := tempDir(t, map[string]string{"logs.ndjson": exported})
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "logs.ndjson")
+	f, err := New(filepath.Join(dir, "*.ndjson"), Config{})
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	// a line being written is read once it is a whole document
+	appendFile(t, name, `{"@timestamp":"2018-11-29T10:00:03.000Z",`)
+	logs, err := f.ExecuteQuery(ctx, nil, "@timestamp", false, "", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"third"}, messages(t, logs))
+
+	appendFile(t, name, `"message":"fourth"}`)
+	logs, err = f.ExecuteQuery(ctx, nil, "@timestamp", false, "", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"fourth"}, messages(t, logs))
+	assert.Equal(t, "logs.ndjson:5", logs[0].ID)
+
+	appendFile(t, name, "\n"+`{"@timestamp":"2018-11-29T10:00:04.000Z","message":"fifth"}`+"\n")
+	logs, err = f.ExecuteQuery(ctx, nil, "@timestamp", false, "", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"fifth", "fourth"}, messages(t, logs))
+	assert.Equal(t, "logs.ndjson:6", logs[0].ID)
+
+	// new files are found, and truncated files are read again
+	writeFile(t, filepath.Join(dir, "more.ndjson"), `{"@timestamp":"2018-11-29T10:00:05.000Z","message":"sixth"}`+"\n")
+	writeFile(t, name, `{"@timestamp":"2018-11-29T09:00:00.000Z","message":"rotated"}`+"\n")
+	logs, err = f.ExecuteQuery(ctx, nil, "@timestamp", false, "", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"sixth", "rotated"}, messages(t, logs))
+
+	// an invalid line fails the query
+	appendFile(t, name, "not json\n")
+	_, err = f.ExecuteQuery(ctx, nil, "@timestamp", false, "", 10)
+	assert.NotNil(t, err)
+}
+
+func TestFiles_tail(t *testing.T) {
+	dir := tempDir(t, map[string]string{"logs.ndjson": exported})
+	defer os.RemoveAll(dir)
+	f, err := New(filepath.Join(dir, "logs.ndjson"), Config{})
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	tl := tail.New(logrus.WithFields(nil), f, tail.WithSinks(tail.NewFormattedSink(&buf, tail.NewFormatter(false, "%level %message", tail.GetFields("%level %message")))))
+	after := time.Date(2018, 11, 28, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2018, 11, 30, 0, 0, 0, 0, time.UTC)
+	err = tl.Start(&domain.Query{IndexPattern: "logstash-[0-9].*", Query: "level:error", Entries: 10, AfterDateTime: &after, BeforeDateTime: &before})
+	assert.Nil(t, err)
+	assert.Equal(t, "error first\nerror second\n", buf.String())
+}
+
+func TestNew_noFiles(t *testing.T) {
+	dir := tempDir(t, nil)
+	defer os.RemoveAll(dir)
+	_, err := New(filepath.Join(dir, "*.ndjson"), Config{})
+	assert.NotNil(t, err)
+}
+
+func TestFiles_dateMath(t *testing.T) {
+	dir := tempDir(t, map[string]string{"logs.ndjson": exported})
+	defer os.RemoveAll(dir)
+	f, err := New(filepath.Join(dir, "logs.ndjson"), Config{})
+	assert.Nil(t, err)
+	now := time.Date(2018, 11, 29, 10, 4, 0, 0, time.UTC)
+	f.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	n, err := f.Count(ctx, nil, "@timestamp", "@timestamp:>now-5m", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// the same query follows the clock
+	now = time.Date(2018, 11, 29, 10, 5, 1, 500000000, time.UTC)
+	n, err = f.Count(ctx, nil, "@timestamp", "@timestamp:>now-5m", nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestFiles_Histogram(t *testing.T) {
+	dir := tempDir(t, map[string]string{"logs.ndjson": exported})
+	defer os.RemoveAll(dir)
+	f, err := New(filepath.Join(dir, "logs.ndjson"), Config{})
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	buckets, err := f.Histogram(ctx, nil, "@timestamp", "", nil, nil, "1h", "level", 1)
+	assert.Nil(t, err)
+	assert.Len(t, buckets, 12)
+	assert.Equal(t, &domain.Bucket{Time: time.Date(2018, 11, 28, 23, 0, 0, 0, time.UTC), Count: 1, Series: map[string]int64{"error": 1}}, buckets[0])
+	assert.Equal(t, &domain.Bucket{Time: time.Date(2018, 11, 29, 0, 0, 0, 0, time.UTC), Count: 0, Series: map[string]int64{}}, buckets[1])
+	assert.Equal(t, &domain.Bucket{Time: time.Date(2018, 11, 29, 10, 0, 0, 0, time.UTC), Count: 2, Series: map[string]int64{"error": 1}}, buckets[11])
+
+	// the buckets span the time range
+	after := time.Date(2018, 11, 29, 8, 30, 0, 0, time.UTC)
+	before := time.Date(2018, 11, 29, 12, 0, 0, 0, time.UTC)
+	buckets, err = f.Histogram(ctx, nil, "@timestamp", "level:error", &after, &before, "hour", "", 0)
+	assert.Nil(t, err)
+	var counts []int64
+	for _, b := range buckets {
+		counts = append(counts, b.Count)
+	}
+	assert.Equal(t, []int64{0, 0, 1, 0, 0}, counts)
+	assert.Equal(t, time.Date(2018, 11, 29, 8, 0, 0, 0, time.UTC), buckets[0].Time)
+
+	// weeks start on monday
+	buckets, err = f.Histogram(ctx, nil, "@timestamp", "", nil, nil, "1w", "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []*domain.Bucket{{Time: time.Date(2018, 11, 26, 0, 0, 0, 0, time.UTC), Count: 3}}, buckets)
+
+	_, err = f.Histogram(ctx, nil, "@timestamp", "", nil, nil, "2M", "", 0)
+	assert.NotNil(t, err)
+	_, err = f.Histogram(ctx, nil, "@timestamp", "", nil, nil, "1ms", "", 0)
+	assert.NotNil(t, err)
+}
+
+func TestFiles_Terms(t *testing.T) {
+	dir := tempDir(t, map[string]string{"logs.ndjson": exported})
+	defer os.RemoveAll(dir)
+	f, err := New(filepath.Join(dir, "logs.ndjson"), Config{})
+	assert.Nil(t, err)
+
+	terms, total, err := f.Terms(context.Background(), nil, "@timestamp", "", nil, nil, "level", 10, "message", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, []*domain.Term{
+		{Value: "error", Count: 2, Terms: []*domain.Term{{Value: "first", Count: 1}}},
+		{Value: "info", Count: 1, Terms: []*domain.Term{{Value: "third", Count: 1}}},
+	}, terms)
+}
+
+func TestFiles_documents(t *testing.T) {
+	dir := tempDir(t, map[string]string{
+		"hits.json":   hits,
+		"logs.ndjson": `{"@timestamp":"2018-11-29T10:00:00.000Z","http":{"status":200,"took":1},"tags":["a"]}` + "\n" + `{"http":{"took":1.5}}` + "\n",
+	})
+	defer os.RemoveAll(dir)
+	f, err := New(filepath.Join(dir, "*"), Config{})
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	indices, err := f.GetIndices(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, indices, 4)
+	assert.Equal(t, &domain.Index{Name: "app-2018.11.29", DocsCount: 1, StoreSize: 59}, indices[0])
+
+	mappings, err := f.GetMappings(ctx, []string{"app-2018.11.30", "logstash-2018.11.29", "logstash-0001.01.01"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*domain.Field{{Name: "@timestamp", Type: "long"}, {Name: "message", Type: "text"}}, mappings["app-2018.11.30"])
+	assert.Equal(t, []*domain.Field{
+		{Name: "@timestamp", Type: "date"},
+		{Name: "http", Type: "object"},
+		{Name: "http.status", Type: "long"},
+		{Name: "http.took", Type: "long"},
+		{Name: "tags", Type: "text"},
+	}, mappings["logstash-2018.11.29"])
+	assert.Equal(t, []*domain.Field{{Name: "http", Type: "object"}, {Name: "http.took", Type: "float"}}, mappings["logstash-0001.01.01"])
+
+	found, err := f.FindDocument(ctx, nil, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app-2018.11.30"}, found)
+
+	doc, err := f.GetDocument(ctx, "logstash-2018.11.29", "logs.ndjson:1", []string{"http.st*", "tags"})
+	assert.Nil(t, err)
+	assert.Equal(t, "logs.ndjson:1", doc.ID)
+	assert.Equal(t, `{"http":{"status":200},"tags":["a"]}`, string(*doc.Source))
+
+	doc, err = f.GetDocument(ctx, "app-2018.11.29", "a", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"@timestamp":"2018-11-29T10:00:00.500Z","message":"hit a"}`, string(*doc.Source))
+
+	_, err = f.GetDocument(ctx, "app-2018.11.30", "a", nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,653 @@
+package fileconn
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// occurrences of the clauses of a boolean query
+const (
+	should = iota
+	must
+	mustNot
+)
+
+// matcher matches the documents of a query
+type matcher interface {
+	match(source map[string]interface{}) bool
+}
+
+// clause is a matcher of a boolean query and whether it is required, optional or prohibited
+type clause struct {
+	occur   int
+	matcher matcher
+}
+
+// boolQuery matches the documents matching all its required clauses, none of its prohibited ones and,
+// when it has no required clauses, one of its optional ones
+type boolQuery []clause
+
+func (q boolQuery) match(source map[string]interface{}) bool {
+	required, optional, matched := false, false, false
+	for _, c := range q {
+		switch c.occur {
+		case must:
+			if !c.matcher.match(source) {
+				return false
+			}
+			required = true
+		case mustNot:
+			if c.matcher.match(source) {
+				return false
+			}
+		default:
+			optional = true
+			matched = matched || c.matcher.match(source)
+		}
+	}
+	return required || !optional || matched
+}
+
+// fieldQuery matches the documents with a value of the field matching the value query.
+// An empty field matches the values of any field.
+type fieldQuery struct {
+	field string
+	value valueQuery
+}
+
+func (q fieldQuery) match(source map[string]interface{}) bool {
+	for _, v := range values(source, q.field) {
+		if q.value.match(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// existsQuery matches the documents with a value of the field
+type existsQuery string
+
+func (q existsQuery) match(source map[string]interface{}) bool {
+	return len(values(source, string(q))) > 0
+}
+
+// valueQuery matches the values of a field
+type valueQuery interface {
+	match(v interface{}) bool
+}
+
+// termQuery matches the values containing the words of the term in sequence, ignoring case
+type termQuery []string
+
+func (q termQuery) match(v interface{}) bool {
+	if len(q) == 0 {
+		return false
+	}
+	tokens := tokenize(text(v))
+	for i := 0; i+len(q) <= len(tokens); i++ {
+		found := true
+		for j, t := range q {
+			if tokens[i+j] != t {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// patternQuery matches the values, or one of their words, with a wildcard or regexp pattern
+type patternQuery struct {
+	*regexp.Regexp
+}
+
+func (q patternQuery) match(v interface{}) bool {
+	s := text(v)
+	if q.MatchString(s) {
+		return true
+	}
+	for _, t := range tokenize(s) {
+		if q.MatchString(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeQuery matches the values between its bounds, compared as numbers, dates or strings
+type rangeQuery struct {
+	lower, upper               string // empty when unbounded
+	includeLower, includeUpper bool
+	lowerNumber, upperNumber   *float64
+	lowerTime, upperTime       *time.Time
+}
+
+func (q rangeQuery) match(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	s := text(v)
+	if q.lower != "" && !inBound(compare(s, q.lower, q.lowerNumber, q.lowerTime), 1, q.includeLower) {
+		return false
+	}
+	if q.upper != "" && !inBound(compare(s, q.upper, q.upperNumber, q.upperTime), -1, q.includeUpper) {
+		return false
+	}
+	return true
+}
+
+// inBound checks the comparison of the value with a bound, on the side of the sign
+func inBound(cmp int, sign int, inclusive bool) bool {
+	return cmp == sign || (cmp == 0 && inclusive)
+}
+
+// compare compares the value with a bound, as numbers or dates when both parse as such
+func compare(v string, bound string, number *float64, t *time.Time) int {
+	if number != nil {
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return compareFloats(n, *number)
+		}
+	}
+	if t != nil {
+		if d, ok := parseTime(v); ok {
+			switch {
+			case d.Before(*t):
+				return -1
+			case d.After(*t):
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(v, bound)
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// newRangeQuery creates a range query, parsing the bounds that are numbers or dates
+func newRangeQuery(lower, upper string, includeLower, includeUpper bool, now time.Time) rangeQuery {
+	q := rangeQuery{lower: lower, upper: upper, includeLower: includeLower, includeUpper: includeUpper}
+	parse := func(bound string) (*float64, *time.Time) {
+		if bound == "" {
+			return nil, nil
+		}
+		var number *float64
+		if n, err := strconv.ParseFloat(bound, 64); err == nil {
+			number = &n
+		}
+		if t, ok := parseDateMath(bound, now); ok {
+			return number, &t
+		}
+		return number, nil
+	}
+	q.lowerNumber, q.lowerTime = parse(lower)
+	q.upperNumber, q.upperTime = parse(upper)
+	return q
+}
+
+// parseDateMath parses a date, or now with an optional offset such as now-1h
+func parseDateMath(s string, now time.Time) (time.Time, bool) {
+	if !strings.HasPrefix(s, "now") {
+		return parseTime(s)
+	}
+	offset := s[len("now"):]
+	if offset == "" {
+		return now, true
+	}
+	units := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'H': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	unit, ok := units[offset[len(offset)-1]]
+	if !ok || len(offset) < 3 || (offset[0] != '-' && offset[0] != '+') {
+		return time.Time{}, false
+	}
+	n, err := strconv.Atoi(offset[1 : len(offset)-1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	if offset[0] == '-' {
+		n = -n
+	}
+	return now.Add(time.Duration(n) * unit), true
+}
+
+// parseQuery parses a query string. The supported syntax is a subset of the elasticsearch one:
+// terms and "phrases", optionally prefixed with a field (field:term), wildcards (* and ?), /regexps/,
+// ranges (field:[a TO b], field:{a TO *}, field:>=a), _exists_:field, grouping with parentheses, field:(a OR b),
+// and the AND, OR, NOT, &&, ||, !, + and - operators. Terms without an operator are optional, as in elasticsearch.
+// Boosts (^2) and fuzziness (~) are accepted and ignored.
+func parseQuery(query string, now time.Time) (matcher, error) {
+	p := &parser{input: []rune(query), now: now}
+	q, err := p.parseClauses("")
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", string(p.input[p.pos]))
+	}
+	return q, nil
+}
+
+// parser is a recursive descent parser of query strings
+type parser struct {
+	input []rune
+	pos   int
+	now   time.Time
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) peek() rune {
+	if p.done() {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *parser) skipSpaces() {
+	for !p.done() && unicode.IsSpace(p.peek()) {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid query at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// operator consumes the operator if it is next, followed by a space or a parenthesis for the words
+func (p *parser) operator(ops ...string) bool {
+	for _, op := range ops {
+		end := p.pos + len(op)
+		if end > len(p.input) || string(p.input[p.pos:end]) != op {
+			continue
+		}
+		if unicode.IsLetter(rune(op[0])) && end < len(p.input) && !unicode.IsSpace(p.input[end]) && p.input[end] != '(' {
+			continue
+		}
+		p.pos = end
+		return true
+	}
+	return false
+}
+
+// parseClauses parses the clauses until the end of the query or group, applying the field to the ones without one
+func (p *parser) parseClauses(field string) (boolQuery, error) {
+	var q boolQuery
+	conjunction := false
+	for {
+		p.skipSpaces()
+		if p.done() || p.peek() == ')' {
+			break
+		}
+		if p.operator("AND", "&&") {
+			if len(q) == 0 {
+				return nil, p.errorf("missing clause before AND")
+			}
+			if last := &q[len(q)-1]; last.occur == should {
+				last.occur = must
+			}
+			conjunction = true
+			continue
+		}
+		if p.operator("OR", "||") {
+			if len(q) == 0 {
+				return nil, p.errorf("missing clause before OR")
+			}
+			continue
+		}
+
+		occur := should
+		switch {
+		case p.operator("NOT", "!", "-"):
+			occur = mustNot
+		case p.operator("+"):
+			occur = must
+		case conjunction:
+			occur = must
+		}
+		conjunction = false
+
+		m, err := p.parseClause(field)
+		if err != nil {
+			return nil, err
+		}
+		q = append(q, clause{occur: occur, matcher: m})
+	}
+	if conjunction {
+		return nil, p.errorf("missing clause after AND")
+	}
+	return q, nil
+}
+
+// parseClause parses a group or a field query
+func (p *parser) parseClause(field string) (matcher, error) {
+	p.skipSpaces()
+	if p.peek() == '(' {
+		return p.parseGroup(field)
+	}
+
+	// a term followed by a colon is a field name
+	start := p.pos
+	if p.peek() != '"' && p.peek() != '/' {
+		name := p.readTerm(true)
+		if name != "" && p.peek() == ':' {
+			p.pos++
+			if name == "_exists_" {
+				value := p.readTerm(false)
+				if value == "" {
+					return nil, p.errorf("missing field of _exists_")
+				}
+				return existsQuery(value), nil
+			}
+			if name == "*" {
+				name = ""
+			}
+			if p.peek() == '(' {
+				return p.parseGroup(name)
+			}
+			return p.parseValue(name)
+		}
+		p.pos = start
+	}
+	return p.parseValue(field)
+}
+
+// parseGroup parses the clauses in parentheses
+func (p *parser) parseGroup(field string) (matcher, error) {
+	p.pos++
+	q, err := p.parseClauses(field)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != ')' {
+		return nil, p.errorf("missing )")
+	}
+	p.pos++
+	p.skipModifiers()
+	return q, nil
+}
+
+// parseValue parses the value query of the field
+func (p *parser) parseValue(field string) (matcher, error) {
+	var value valueQuery
+	switch c := p.peek(); {
+	case c == '"':
+		s, err := p.readQuoted()
+		if err != nil {
+			return nil, err
+		}
+		value = termQuery(tokenize(s))
+	case c == '/':
+		r, err := p.readRegexp()
+		if err != nil {
+			return nil, err
+		}
+		value = r
+	case c == '[' || c == '{':
+		r, err := p.readRange()
+		if err != nil {
+			return nil, err
+		}
+		value = r
+	case c == '>' || c == '<':
+		value = p.readComparison()
+	default:
+		term := p.readTerm(false)
+		if term == "" {
+			return nil, p.errorf("missing term")
+		}
+		if field != "" && term == "*" {
+			p.skipModifiers()
+			return existsQuery(field), nil
+		}
+		if strings.ContainsAny(term, "*?") {
+			value = patternQuery{wildcardRegexp(term)}
+		} else {
+			value = termQuery(tokenize(term))
+		}
+	}
+	p.skipModifiers()
+	return fieldQuery{field: field, value: value}, nil
+}
+
+// skipModifiers skips the boosts and fuzziness of the last clause
+func (p *parser) skipModifiers() {
+	for !p.done() && (p.peek() == '^' || p.peek() == '~') {
+		p.pos++
+		for !p.done() && (unicode.IsDigit(p.peek()) || p.peek() == '.') {
+			p.pos++
+		}
+	}
+}
+
+// readTerm reads an unquoted term, stopping at a colon when reading a field name
+func (p *parser) readTerm(field bool) string {
+	var b strings.Builder
+	for !p.done() {
+		c := p.peek()
+		if unicode.IsSpace(c) || c == '(' || c == ')' || c == '^' || c == '~' || (field && c == ':') {
+			break
+		}
+		if c == '\\' && p.pos+1 < len(p.input) {
+			p.pos++
+			c = p.peek()
+		}
+		b.WriteRune(c)
+		p.pos++
+	}
+	return b.String()
+}
+
+// readQuoted reads a quoted string, unescaping it
+func (p *parser) readQuoted() (string, error) {
+	p.pos++
+	var b strings.Builder
+	for !p.done() {
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == '"':
+			return b.String(), nil
+		case c == '\\' && !p.done():
+			c = p.peek()
+			p.pos++
+		}
+		b.WriteRune(c)
+	}
+	return "", p.errorf("missing closing quote")
+}
+
+// readRegexp reads a /regexp/, which matches whole values or words
+func (p *parser) readRegexp() (patternQuery, error) {
+	p.pos++
+	var b strings.Builder
+	for !p.done() {
+		c := p.peek()
+		p.pos++
+		if c == '/' {
+			r, err := regexp.Compile("^(?:" + b.String() + ")$")
+			if err != nil {
+				return patternQuery{}, p.errorf("%s", err)
+			}
+			return patternQuery{r}, nil
+		}
+		if c == '\\' && p.peek() == '/' {
+			c = p.peek()
+			p.pos++
+		}
+		b.WriteRune(c)
+	}
+	return patternQuery{}, p.errorf("missing closing /")
+}
+
+// readRange reads a [a TO b] range, curly brackets excluding the bound
+func (p *parser) readRange() (rangeQuery, error) {
+	includeLower := p.peek() == '['
+	p.pos++
+	p.skipSpaces()
+	lower, err := p.readBound()
+	if err != nil {
+		return rangeQuery{}, err
+	}
+	p.skipSpaces()
+	if !p.operator("TO") {
+		return rangeQuery{}, p.errorf("missing TO in range")
+	}
+	p.skipSpaces()
+	upper, err := p.readBound()
+	if err != nil {
+		return rangeQuery{}, err
+	}
+	p.skipSpaces()
+	c := p.peek()
+	if c != ']' && c != '}' {
+		return rangeQuery{}, p.errorf("missing end of range")
+	}
+	p.pos++
+	return newRangeQuery(lower, upper, includeLower, c == ']', p.now), nil
+}
+
+// readBound reads a bound of a range, empty if unbounded
+func (p *parser) readBound() (string, error) {
+	if p.peek() == '"' {
+		return p.readQuoted()
+	}
+	var b strings.Builder
+	for !p.done() {
+		c := p.peek()
+		if unicode.IsSpace(c) || c == ']' || c == '}' {
+			break
+		}
+		b.WriteRune(c)
+		p.pos++
+	}
+	if b.String() == "*" {
+		return "", nil
+	}
+	return b.String(), nil
+}
+
+// readComparison reads a >, >=, < or <= comparison as a range
+func (p *parser) readComparison() rangeQuery {
+	greater := p.peek() == '>'
+	p.pos++
+	inclusive := p.peek() == '='
+	if inclusive {
+		p.pos++
+	}
+	var bound string
+	if p.peek() == '"' {
+		bound, _ = p.readQuoted()
+	} else {
+		bound = p.readTerm(false)
+	}
+	if greater {
+		return newRangeQuery(bound, "", inclusive, false, p.now)
+	}
+	return newRangeQuery("", bound, false, inclusive, p.now)
+}
+
+// wildcardRegexp converts a wildcard pattern to a case insensitive regexp
+func wildcardRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// tokenize splits the text in lowercase words, as the standard analyzer of elasticsearch roughly does
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_'
+	})
+}
+
+// text returns the value as a string
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// values returns the values of the field in the source, flattening arrays and using dot syntax for nested fields.
+// Fields whose name contains dots are found too. An empty field returns the values of every field.
+func values(source map[string]interface{}, field string) []interface{} {
+	var result []interface{}
+	if field == "" {
+		for _, v := range source {
+			result = appendValues(result, v, true)
+		}
+		return result
+	}
+	if v, ok := source[field]; ok {
+		result = appendValues(result, v, false)
+	}
+	parts := strings.Split(field, ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		switch nested := source[strings.Join(parts[:i], ".")].(type) {
+		case map[string]interface{}:
+			result = append(result, values(nested, strings.Join(parts[i:], "."))...)
+		case []interface{}:
+			for _, n := range nested {
+				if m, ok := n.(map[string]interface{}); ok {
+					result = append(result, values(m, strings.Join(parts[i:], "."))...)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// appendValues appends the value, or the elements of arrays, skipping nulls.
+// Objects are only flattened when searching every field.
+func appendValues(result []interface{}, v interface{}, all bool) []interface{} {
+	switch v := v.(type) {
+	case nil:
+	case []interface{}:
+		for _, e := range v {
+			result = appendValues(result, e, all)
+		}
+	case map[string]interface{}:
+		if all {
+			for _, e := range v {
+				result = appendValues(result, e, all)
+			}
+		}
+	default:
+		result = append(result, v)
+	}
+	return result
+}
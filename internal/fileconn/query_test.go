@@ -0,0 +1,118 @@
+package fileconn
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var queryNow = time.Date(2018, 11, 29, 12, 0, 0, 0, time.UTC)
+
+// source decodes the json document as the connector does
+func source(t *testing.T, doc string) map[string]interface{} {
+	var s map[string]interface{}
+	assert.Nil(t, decode([]byte(doc), &s))
+	return s
+}
+
+func TestParseQuery_match(t *testing.T) {
+	doc := `{"@timestamp":"2018-11-29T10:00:00.000Z","level":"ERROR","message":"GET /api/users failed: connection timeout",` +
+		`"status":503,"took":12.5,"host":{"name":"web-1"},"service.name":"api","tags":["prod","eu"],"empty":null}`
+	tests := []struct {
+		query   string
+		matched bool
+	}{
+		{"", true},
+		{"*", true},
+		{"level:error", true},
+		{"level:warn", false},
+		{"timeout", true},
+		{"missing", false},
+		{`message:"connection timeout"`, true},
+		{`message:"timeout connection"`, false},
+		{"message:conn*", true},
+		{"message:time?ut", true},
+		{"message:/time.*/", true},
+		{"message:/imeout/", false},
+		{"status:503", true},
+		{"status:[500 TO 599]", true},
+		{"status:{503 TO 599]", false},
+		{"status:>=503", true},
+		{"status:<503", false},
+		{"took:>12", true},
+		{"host.name:web-1", true},
+		{"host.name:web-2", false},
+		{"service.name:api", true},
+		{"tags:eu", true},
+		{"tags:(us OR eu)", true},
+		{"tags:(us AND eu)", false},
+		{"_exists_:host.name", true},
+		{"_exists_:empty", false},
+		{"host.name:*", true},
+		{"missing:*", false},
+		{"level:error AND status:503", true},
+		{"level:error AND status:200", false},
+		{"level:error && NOT status:200", true},
+		{"level:error -status:503", false},
+		{"+level:error status:200", true},
+		{"level:warn OR status:503", true},
+		{"level:warn || status:200", false},
+		{"level:warn status:503", true},
+		{"!level:warn", true},
+		{"NOT level:error", false},
+		{"(level:warn OR level:error) AND (host.name:web-1 OR host.name:web-2)", true},
+		{"(level:warn OR level:info) AND host.name:web-1", false},
+		{`@timestamp:["2018-11-29T09:00:00.000Z" TO "2018-11-29T11:00:00.000Z"]`, true},
+		{`@timestamp:["2018-11-29T10:00:00.000Z" TO *]`, true},
+		{`@timestamp:{"2018-11-29T10:00:00.000Z" TO *]`, false},
+		{`@timestamp:[* TO 2018-11-29]`, false},
+		{`@timestamp:[now-3h TO now]`, true},
+		{`@timestamp:>now-1h`, false},
+		{"level:error^2", true},
+		{"level:erorr~1", false},
+		{`message:GET\ \/api*`, true},
+	}
+	s := source(t, doc)
+	for _, test := range tests {
+		m, err := parseQuery(test.query, queryNow)
+		if !assert.Nil(t, err, test.query) {
+			continue
+		}
+		assert.Equal(t, test.matched, m.match(s), test.query)
+	}
+}
+
+func TestParseQuery_invalid(t *testing.T) {
+	for _, q := range []string{
+		"(level:error",
+		"level:error)",
+		`message:"timeout`,
+		"message:/time",
+		"status:[500 599]",
+		"status:[500 TO 599",
+		"AND level:error",
+		"level:error AND",
+		"_exists_:",
+		"message:/(/",
+	} {
+		_, err := parseQuery(q, queryNow)
+		assert.NotNil(t, err, q)
+	}
+}
+
+func TestValues(t *testing.T) {
+	s := source(t, `{"a":{"b":[1,{"c":"x"}],"d.e":"y"},"a.f":"z","n":null}`)
+	assert.Equal(t, []interface{}{json.Number("1")}, values(s, "a.b"))
+	assert.Equal(t, []interface{}{"x"}, values(s, "a.b.c"))
+	assert.Equal(t, []interface{}{"y"}, values(s, "a.d.e"))
+	assert.Equal(t, []interface{}{"z"}, values(s, "a.f"))
+	assert.Empty(t, values(s, "n"))
+	assert.Len(t, values(s, ""), 4)
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"get", "api", "users_1", "failed"}, tokenize("GET /api/users_1 failed!"))
+	assert.Empty(t, tokenize(" -- "))
+}
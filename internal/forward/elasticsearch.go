@@ -0,0 +1,167 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultIndex is the index of the logs sent to elasticsearch
+const DefaultIndex = "elklogs-{date}"
+
+// ElasticsearchConfig configures an Elasticsearch sink
+type ElasticsearchConfig struct {
+	URL      string
+	User     string
+	Password string
+	Index    string  // index of the logs, {date} is replaced with their day (2006.01.02)
+	Type     string  // document type, required before elasticsearch 7
+	Fields   Mapping // fields of the documents to fields of the logs, the log documents are copied if empty
+}
+
+// elasticsearchSender indexes the logs with the bulk api
+type elasticsearchSender struct {
+	logger *logrus.Entry
+	config ElasticsearchConfig
+	url    string
+	client *http.Client
+}
+
+// bulkResponse holds the results of the bulk items
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// NewElasticsearchSink creates a sink indexing the logs in an Elasticsearch cluster.
+// The logs keep their id, so the batches retried do not duplicate them.
+// The documents rejected by the cluster, such as the ones not matching its mapping, are logged and dropped.
+func NewElasticsearchSink(logger *logrus.Entry, config ElasticsearchConfig, batch Config) (tail.Sink, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid elasticsearch url: %s", config.URL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/_bulk"
+	if config.Index == "" {
+		config.Index = DefaultIndex
+	}
+	logger = logger.WithFields(logrus.Fields{"sink": "elasticsearch", "url": config.URL})
+	s := &elasticsearchSender{logger: logger, config: config, url: u.String(), client: &http.Client{Timeout: httpTimeout}}
+	return newBatchSink(logger, batch, s), nil
+}
+
+func (s *elasticsearchSender) send(ctx context.Context, batch []*domain.Entry) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range batch {
+		meta := map[string]string{"_index": strings.Replace(s.config.Index, "{date}", timestamp(e).UTC().Format("2006.01.02"), -1)}
+		if e.ID != "" {
+			meta["_id"] = e.ID
+		}
+		if s.config.Type != "" {
+			meta["_type"] = s.config.Type
+		}
+		if err := enc.Encode(map[string]interface{}{"index": meta}); err != nil {
+			return permanentError{err}
+		}
+		if err := enc.Encode(s.document(e)); err != nil {
+			return permanentError{err}
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, &body)
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.config.User != "" {
+		req.SetBasicAuth(s.config.User, s.config.Password)
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return statusError(resp)
+	}
+
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid bulk response: %s", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	return s.failures(batch, result)
+}
+
+func (s *elasticsearchSender) close() error {
+	return nil
+}
+
+// document returns the document of the log, with the mapped fields if any
+func (s *elasticsearchSender) document(e *domain.Entry) interface{} {
+	if len(s.config.Fields) == 0 {
+		if e.Raw != nil {
+			return e.Raw
+		}
+		return e.Source
+	}
+	doc := make(map[string]interface{})
+	for _, f := range s.config.Fields {
+		if v, ok := f.value(e); ok {
+			doc[f.Target] = v
+		}
+	}
+	return doc
+}
+
+// failures handles the failed items of a bulk request: only the documents that may succeed on a retry
+// are sent again, and the ones rejected by the cluster are logged and dropped.
+func (s *elasticsearchSender) failures(batch []*domain.Entry, result bulkResponse) error {
+	// the items are in the order of the documents, otherwise the whole batch is retried
+	if len(result.Items) != len(batch) {
+		return fmt.Errorf("%d results for %d documents", len(result.Items), len(batch))
+	}
+
+	var retry []*domain.Entry
+	var reason string
+	for i, item := range result.Items {
+		for _, r := range item {
+			if r.Status < 300 {
+				continue
+			}
+			var cause string
+			if r.Error != nil {
+				cause = fmt.Sprintf("%s: %s", r.Error.Type, r.Error.Reason)
+			}
+			if r.Status == http.StatusTooManyRequests || r.Status >= 500 {
+				retry = append(retry, batch[i])
+				if reason == "" {
+					reason = cause
+				}
+				continue
+			}
+			s.logger.WithFields(logrus.Fields{"id": batch[i].ID, "index": batch[i].Index, "status": r.Status, "err": cause}).Warn("document rejected, dropping it")
+		}
+	}
+	if len(retry) == 0 {
+		return nil
+	}
+	return partialError{fmt.Errorf("%d of %d documents failed: %s", len(retry), len(batch), reason), retry}
+}
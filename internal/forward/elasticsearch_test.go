@@ -0,0 +1,111 @@
+package forward
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// bulkLines decodes the lines of a bulk request
+func bulkLines(t *testing.T, body []byte) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, l := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		var v map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(l), &v), l)
+		lines = append(lines, v)
+	}
+	return lines
+}
+
+func TestElasticsearchSink(t *testing.T) {
+	stub := newStubServer()
+	defer stub.Close()
+	stub.response = `{"errors":false,"items":[]}`
+	sink, err := NewElasticsearchSink(logrus.WithFields(nil), ElasticsearchConfig{URL: stub.URL, User: "elastic", Password: "secret", Type: "doc"}, Config{BatchSize: 2})
+	assert.Nil(t, err)
+
+	ts := time.Date(2018, 10, 10, 10, 0, 0, 0, time.UTC)
+	assert.Nil(t, sink.Write(entry("a", ts, `{"message":"one","host":{"name":"web-1"}}`)))
+	assert.Nil(t, sink.Write(entry("b", ts.Add(24*time.Hour), `{"message":"two"}`)))
+	assert.Nil(t, sink.Close())
+
+	requests, bodies := stub.received()
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "/_bulk", requests[0].URL.Path)
+	assert.Equal(t, "application/x-ndjson", requests[0].Header.Get("Content-Type"))
+	user, password, _ := requests[0].BasicAuth()
+	assert.Equal(t, "elastic:secret", user+":"+password)
+	assert.Equal(t, []map[string]interface{}{
+		{"index": map[string]interface{}{"_index": "elklogs-2018.10.10", "_id": "a", "_type": "doc"}},
+		{"message": "one", "host": map[string]interface{}{"name": "web-1"}},
+		{"index": map[string]interface{}{"_index": "elklogs-2018.10.11", "_id": "b", "_type": "doc"}},
+		{"message": "two"},
+	}, bulkLines(t, bodies[0]))
+}
+
+func TestElasticsearchSink_fields(t *testing.T) {
+	stub := newStubServer()
+	defer stub.Close()
+	stub.response = `{"errors":false,"items":[]}`
+	fields, err := ParseMapping(`@timestamp=@timestamp,msg=message,host=host.name,source="elklogs"`)
+	assert.Nil(t, err)
+	sink, err := NewElasticsearchSink(logrus.WithFields(nil), ElasticsearchConfig{URL: stub.URL + "/", Index: "copy", Fields: fields}, Config{BatchSize: 1})
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Write(entry("a", time.Time{}, `{"@timestamp":"2018-10-10T10:00:00Z","message":"one","host":{"name":"web-1"},"level":"info","count":3}`)))
+
+	_, bodies := stub.received()
+	assert.Equal(t, []map[string]interface{}{
+		{"index": map[string]interface{}{"_index": "copy", "_id": "a"}},
+		{"@timestamp": "2018-10-10T10:00:00Z", "msg": "one", "host": "web-1", "source": "elklogs"},
+	}, bulkLines(t, bodies[0]))
+}
+
+func TestElasticsearchSink_itemErrors(t *testing.T) {
+	stub := newStubServer()
+	defer stub.Close()
+	sink, err := NewElasticsearchSink(logrus.WithFields(nil), ElasticsearchConfig{URL: stub.URL}, Config{BatchSize: 1, Retries: 1, RetryBackoff: time.Millisecond})
+	assert.Nil(t, err)
+
+	// rejected items are retried
+	stub.response = `{"errors":true,"items":[{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}}]}`
+	err = sink.Write(entry("a", time.Time{}, `{}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "es_rejected_execution_exception")
+	requests, _ := stub.received()
+	assert.Len(t, requests, 2)
+}
+
+func TestElasticsearchSink_invalidDocuments(t *testing.T) {
+	stub := newStubServer()
+	defer stub.Close()
+	stub.response = `{"errors":false,"items":[]}`
+	sink, err := NewElasticsearchSink(logrus.WithFields(nil), ElasticsearchConfig{URL: stub.URL}, Config{BatchSize: 3, Retries: 3, RetryBackoff: time.Millisecond})
+	assert.Nil(t, err)
+	ts := time.Date(2018, 10, 10, 10, 0, 0, 0, time.UTC)
+
+	// rejected documents are dropped, only the rejected executions are retried
+	stub.responses = []string{
+		`{"errors":true,"items":[` +
+			`{"index":{"status":201}},` +
+			`{"index":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}},` +
+			`{"index":{"status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}}]}`,
+		`{"errors":false,"items":[{"index":{"status":201}}]}`,
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		assert.Nil(t, sink.Write(entry(id, ts, `{}`)))
+	}
+
+	// the sink keeps working after dropping documents
+	assert.Nil(t, sink.Write(entry("d", ts, `{}`)))
+	assert.Nil(t, sink.Close())
+
+	requests, bodies := stub.received()
+	if assert.Len(t, requests, 3) {
+		assert.Equal(t, []map[string]interface{}{{"index": map[string]interface{}{"_index": "elklogs-2018.10.10", "_id": "c"}}, {}}, bulkLines(t, bodies[1]))
+		assert.Equal(t, []map[string]interface{}{{"index": map[string]interface{}{"_index": "elklogs-2018.10.10", "_id": "d"}}, {}}, bulkLines(t, bodies[2]))
+	}
+}
@@ -0,0 +1,256 @@
+// Package forward provides the sinks copying the logs to other systems: syslog servers,
+// the Loki push API and Elasticsearch clusters. The sinks send the logs in batches,
+// retrying the batches that fail with a backoff.
+package forward
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+)
+
+// Config configures the batching and retries of a sink
+type Config struct {
+	BatchSize     int           // logs sent together
+	FlushInterval time.Duration // maximum time a log waits for its batch to fill, 0 waits until it is full
+	Retries       int           // retries of a failed batch before the sink fails
+	RetryBackoff  time.Duration // wait before the first retry, doubled on each one
+}
+
+// timeout of the requests to the http destinations
+const httpTimeout = 30 * time.Second
+
+// sender sends the batches of a sink to its destination
+type sender interface {
+	send(ctx context.Context, batch []*domain.Entry) error
+	close() error
+}
+
+// permanentError is returned by the senders when retrying the batch cannot succeed
+type permanentError struct {
+	error
+}
+
+// partialError is returned by the senders when only some logs of the batch failed, the ones to retry
+type partialError struct {
+	error
+	retry []*domain.Entry
+}
+
+// batchSink collects the logs written to it in batches for its sender
+type batchSink struct {
+	logger *logrus.Entry
+	config Config
+	sender sender
+
+	mu    sync.Mutex
+	batch []*domain.Entry
+	timer *time.Timer
+	err   error // failure of a batch flushed by the timer, returned on the next write
+}
+
+// newBatchSink creates a sink batching the logs for the sender
+func newBatchSink(logger *logrus.Entry, config Config, s sender) *batchSink {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1
+	}
+	return &batchSink{logger: logger, config: config, sender: s}
+}
+
+// Write adds the log to the batch, sending it when it is full.
+// Entries without a log, such as separators, are skipped.
+func (s *batchSink) Write(e *domain.Entry) error {
+	if e.Source == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+
+	s.batch = append(s.batch, e)
+	if len(s.batch) >= s.config.BatchSize {
+		return s.flush()
+	}
+	if len(s.batch) == 1 && s.config.FlushInterval > 0 {
+		s.timer = time.AfterFunc(s.config.FlushInterval, s.flushPending)
+	}
+	return nil
+}
+
+// flushPending sends the batch that did not fill within the flush interval
+func (s *batchSink) flushPending() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = s.flush()
+	}
+}
+
+// Close sends the pending logs and closes the sender
+func (s *batchSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.err
+	if err == nil {
+		err = s.flush()
+	}
+	if cerr := s.sender.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// flush sends the batch, retrying it with a backoff. The sink must be locked.
+func (s *batchSink) flush() error {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if len(s.batch) == 0 {
+		return nil
+	}
+	batch := s.batch
+	s.batch = nil
+
+	backoff := s.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.sender.send(context.Background(), batch)
+		if err == nil {
+			return nil
+		}
+		if p, ok := err.(partialError); ok {
+			batch = p.retry
+		}
+		if _, ok := err.(permanentError); ok || attempt >= s.config.Retries {
+			return fmt.Errorf("could not send %d logs: %s", len(batch), err)
+		}
+		s.logger.WithFields(logrus.Fields{"attempt": attempt + 1, "logs": len(batch), "err": err}).Debug("retrying batch")
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Field maps a field of a destination to a field of the logs, or to a constant
+type Field struct {
+	Target   string
+	Source   string
+	Constant bool
+}
+
+// Mapping maps the fields of a destination to the fields of the logs
+type Mapping []Field
+
+// ParseMapping parses comma separated target=field pairs, such as app=service.name,level=log.level.
+// Quoted values are constants, such as job="elklogs".
+func ParseMapping(s string) (Mapping, error) {
+	var m Mapping
+	if strings.TrimSpace(s) == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("invalid field mapping: %s", pair)
+		}
+		f := Field{Target: strings.TrimSpace(kv[0]), Source: strings.TrimSpace(kv[1])}
+		if v, err := strconv.Unquote(f.Source); err == nil {
+			f.Source, f.Constant = v, true
+		}
+		m = append(m, f)
+	}
+	return m, nil
+}
+
+// check fails if the mapping has targets other than the ones given
+func (m Mapping) check(targets ...string) error {
+	for _, f := range m {
+		found := false
+		for _, t := range targets {
+			found = found || f.Target == t
+		}
+		if !found {
+			return fmt.Errorf("unknown field %s, expected one of %s", f.Target, strings.Join(targets, ", "))
+		}
+	}
+	return nil
+}
+
+// get returns the mapping of the target field
+func (m Mapping) get(target string) (Field, bool) {
+	for _, f := range m {
+		if f.Target == target {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// value returns the value of the field in the log
+func (f Field) value(e *domain.Entry) (interface{}, bool) {
+	if f.Constant {
+		return f.Source, true
+	}
+	return lookup(e.Source, f.Source)
+}
+
+// text returns the value of the field in the log as a string, empty if missing
+func (f Field) text(e *domain.Entry) string {
+	v, ok := f.value(e)
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// lookup returns the value of the field in the source, using dot syntax for nested fields.
+// Fields whose name contains dots are found too.
+func lookup(source map[string]interface{}, field string) (interface{}, bool) {
+	if v, ok := source[field]; ok {
+		return v, true
+	}
+	parts := strings.Split(field, ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		nested, ok := source[strings.Join(parts[:i], ".")].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if v, ok := lookup(nested, strings.Join(parts[i:], ".")); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// timestamp returns the time of the log, now if it is unknown
+func timestamp(e *domain.Entry) time.Time {
+	if e.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return e.Timestamp
+}
+
+// statusError reads the error of a failed response.
+// Client errors other than too many requests are permanent, retrying them would fail again.
+func statusError(resp *http.Response) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err := fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return permanentError{err}
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+package forward
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// entry creates a log entry with the source
+func entry(id string, ts time.Time, source string) *domain.Entry {
+	raw := json.RawMessage(source)
+	e := &domain.Entry{ID: id, Index: "logstash-2018.10.10", Timestamp: ts, Raw: &raw, Line: id + " line"}
+	if err := json.Unmarshal(raw, &e.Source); err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// fakeSender records the batches sent, failing with the errors queued
+type fakeSender struct {
+	mu      sync.Mutex
+	batches [][]string
+	errs    []error
+	closed  bool
+}
+
+func (s *fakeSender) send(ctx context.Context, batch []*domain.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	var ids []string
+	for _, e := range batch {
+		ids = append(ids, e.ID)
+	}
+	s.batches = append(s.batches, ids)
+	return nil
+}
+
+func (s *fakeSender) close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *fakeSender) sent() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.batches...)
+}
+
+func TestBatchSink_batches(t *testing.T) {
+	s := &fakeSender{}
+	sink := newBatchSink(logrus.WithFields(nil), Config{BatchSize: 2}, s)
+	for _, id := range []string{"a", "b", "c"} {
+		assert.Nil(t, sink.Write(entry(id, time.Time{}, `{}`)))
+	}
+	// entries without a log are skipped
+	assert.Nil(t, sink.Write(&domain.Entry{Kind: domain.EntrySeparator, Line: "--"}))
+	assert.Equal(t, [][]string{{"a", "b"}}, s.sent())
+
+	assert.Nil(t, sink.Close())
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, s.sent())
+	assert.True(t, s.closed)
+}
+
+func TestBatchSink_flushInterval(t *testing.T) {
+	s := &fakeSender{}
+	sink := newBatchSink(logrus.WithFields(nil), Config{BatchSize: 10, FlushInterval: 10 * time.Millisecond}, s)
+	assert.Nil(t, sink.Write(entry("a", time.Time{}, `{}`)))
+	for i := 0; i < 100 && len(s.sent()) == 0; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, [][]string{{"a"}}, s.sent())
+	assert.Nil(t, sink.Close())
+}
+
+func TestBatchSink_retries(t *testing.T) {
+	s := &fakeSender{errs: []error{errors.New("unavailable"), errors.New("unavailable")}}
+	sink := newBatchSink(logrus.WithFields(nil), Config{BatchSize: 1, Retries: 2, RetryBackoff: time.Millisecond}, s)
+	assert.Nil(t, sink.Write(entry("a", time.Time{}, `{}`)))
+	assert.Equal(t, [][]string{{"a"}}, s.sent())
+
+	// permanent errors are not retried
+	s.errs = []error{permanentError{errors.New("bad request")}, nil}
+	assert.NotNil(t, sink.Write(entry("b", time.Time{}, `{}`)))
+	assert.Equal(t, [][]string{{"a"}}, s.sent())
+
+	s.errs = []error{errors.New("1"), errors.New("2"), errors.New("3")}
+	assert.NotNil(t, sink.Write(entry("c", time.Time{}, `{}`)))
+	assert.Empty(t, s.errs)
+}
+
+func TestBatchSink_flushFailure(t *testing.T) {
+	s := &fakeSender{errs: []error{permanentError{errors.New("bad request")}}}
+	sink := newBatchSink(logrus.WithFields(nil), Config{BatchSize: 10, FlushInterval: time.Millisecond}, s)
+	assert.Nil(t, sink.Write(entry("a", time.Time{}, `{}`)))
+	time.Sleep(50 * time.Millisecond)
+
+	// the failure of the timer flush is returned by the next write
+	assert.NotNil(t, sink.Write(entry("b", time.Time{}, `{}`)))
+	assert.NotNil(t, sink.Close())
+}
+
+func TestParseMapping(t *testing.T) {
+	m, err := ParseMapping(`app=service.name, level=level,job="elklogs"`)
+	assert.Nil(t, err)
+	assert.Equal(t, Mapping{{Target: "app", Source: "service.name"}, {Target: "level", Source: "level"}, {Target: "job", Source: "elklogs", Constant: true}}, m)
+	assert.Nil(t, m.check("app", "level", "job"))
+	assert.NotNil(t, m.check("app"))
+
+	for _, s := range []string{"app", "=x", "app="} {
+		_, err := ParseMapping(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestField_text(t *testing.T) {
+	e := entry("a", time.Time{}, `{"service":{"name":"api"},"kubernetes.pod":{"name":"api-1"},"status":500,"empty":null}`)
+	assert.Equal(t, "api", Field{Source: "service.name"}.text(e))
+	assert.Equal(t, "api-1", Field{Source: "kubernetes.pod.name"}.text(e))
+	assert.Equal(t, "500", Field{Source: "status"}.text(e))
+	assert.Equal(t, "", Field{Source: "empty"}.text(e))
+	assert.Equal(t, "", Field{Source: "missing.field"}.text(e))
+	assert.Equal(t, "status", Field{Source: "status", Constant: true}.text(e))
+}
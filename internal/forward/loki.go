@@ -0,0 +1,161 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+)
+
+// path of the push api, added to the loki urls without a path
+const lokiPushPath = "/loki/api/v1/push"
+
+// label set to the streams without any label, which loki rejects
+var defaultLokiLabels = map[string]string{"job": "elklogs"}
+
+// labelRegexp matches the valid label names
+var labelRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// LokiConfig configures a Loki sink
+type LokiConfig struct {
+	URL    string
+	Tenant string  // sent as X-Scope-OrgID when set
+	Labels Mapping // label names to fields of the logs, or constants
+	JSON   bool    // send the log documents instead of the log lines
+}
+
+// lokiSender pushes the logs grouped in streams by their labels
+type lokiSender struct {
+	config LokiConfig
+	url    string
+	client *http.Client
+}
+
+// lokiStream is a stream of the push request
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+
+	times []int64
+}
+
+func (s *lokiStream) Len() int           { return len(s.Values) }
+func (s *lokiStream) Less(i, j int) bool { return s.times[i] < s.times[j] }
+func (s *lokiStream) Swap(i, j int) {
+	s.Values[i], s.Values[j] = s.Values[j], s.Values[i]
+	s.times[i], s.times[j] = s.times[j], s.times[i]
+}
+
+// NewLokiSink creates a sink pushing the logs to Loki
+func NewLokiSink(logger *logrus.Entry, config LokiConfig, batch Config) (tail.Sink, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid loki url: %s", config.URL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = lokiPushPath
+	}
+	for _, f := range config.Labels {
+		if !labelRegexp.MatchString(f.Target) {
+			return nil, fmt.Errorf("invalid loki label: %s", f.Target)
+		}
+	}
+	s := &lokiSender{config: config, url: u.String(), client: &http.Client{Timeout: httpTimeout}}
+	return newBatchSink(logger.WithFields(logrus.Fields{"sink": "loki", "url": s.url}), batch, s), nil
+}
+
+func (s *lokiSender) send(ctx context.Context, batch []*domain.Entry) error {
+	streams := make(map[string]*lokiStream)
+	var keys []string
+	for _, e := range batch {
+		labels := s.labels(e)
+		key := labelsKey(labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			streams[key] = stream
+			keys = append(keys, key)
+		}
+
+		line := e.Line
+		if s.config.JSON && e.Raw != nil {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, *e.Raw); err != nil {
+				return permanentError{err}
+			}
+			line = buf.String()
+		}
+		ts := timestamp(e).UnixNano()
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(ts, 10), line})
+		stream.times = append(stream.times, ts)
+	}
+
+	// loki expects the entries of each stream in order
+	request := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, k := range keys {
+		sort.Stable(streams[k])
+		request.Streams = append(request.Streams, streams[k])
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return permanentError{err}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.Tenant != "" {
+		req.Header.Set("X-Scope-OrgID", s.config.Tenant)
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return statusError(resp)
+	}
+	return nil
+}
+
+func (s *lokiSender) close() error {
+	return nil
+}
+
+// labels returns the labels of the log, skipping the empty ones
+func (s *lokiSender) labels(e *domain.Entry) map[string]string {
+	labels := make(map[string]string)
+	for _, f := range s.config.Labels {
+		if v := f.text(e); v != "" {
+			labels[f.Target] = v
+		}
+	}
+	if len(labels) == 0 {
+		return defaultLokiLabels
+	}
+	return labels
+}
+
+// labelsKey identifies a label set
+func labelsKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+strconv.Quote(v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
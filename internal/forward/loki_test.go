@@ -0,0 +1,124 @@
+package forward
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// pushRequest is the body of the loki push requests
+type pushRequest struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+// stubServer records the requests it receives, answering with the statuses queued and 200 afterwards
+type stubServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	requests  []*http.Request
+	bodies    [][]byte
+	statuses  []int
+	responses []string // responses of the next requests, then response
+	response  string
+}
+
+func newStubServer() *stubServer {
+	s := &stubServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, body)
+		status := http.StatusOK
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		response := s.response
+		if len(s.responses) > 0 {
+			response, s.responses = s.responses[0], s.responses[1:]
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	return s
+}
+
+func (s *stubServer) received() ([]*http.Request, [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*http.Request(nil), s.requests...), append([][]byte(nil), s.bodies...)
+}
+
+func TestLokiSink(t *testing.T) {
+	stub := newStubServer()
+	defer stub.Close()
+	labels, err := ParseMapping(`app=service,level=level,env="prod"`)
+	assert.Nil(t, err)
+	sink, err := NewLokiSink(logrus.WithFields(nil), LokiConfig{URL: stub.URL, Tenant: "team", Labels: labels}, Config{BatchSize: 3})
+	assert.Nil(t, err)
+
+	ts := time.Date(2018, 10, 10, 10, 0, 0, 0, time.UTC)
+	assert.Nil(t, sink.Write(entry("a", ts.Add(time.Second), `{"service":"api","level":"error"}`)))
+	assert.Nil(t, sink.Write(entry("b", ts, `{"service":"api","level":"error"}`)))
+	assert.Nil(t, sink.Write(entry("c", ts, `{"service":"db","level":"info"}`)))
+	assert.Nil(t, sink.Close())
+
+	requests, bodies := stub.received()
+	assert.Len(t, requests, 1)
+	assert.Equal(t, lokiPushPath, requests[0].URL.Path)
+	assert.Equal(t, "team", requests[0].Header.Get("X-Scope-OrgID"))
+	var push pushRequest
+	assert.Nil(t, json.Unmarshal(bodies[0], &push))
+	assert.Len(t, push.Streams, 2)
+	assert.Equal(t, map[string]string{"app": "api", "level": "error", "env": "prod"}, push.Streams[0].Stream)
+	assert.Equal(t, [][2]string{{"1539165600000000000", "b line"}, {"1539165601000000000", "a line"}}, push.Streams[0].Values)
+	assert.Equal(t, map[string]string{"app": "db", "level": "info", "env": "prod"}, push.Streams[1].Stream)
+}
+
+func TestLokiSink_json(t *testing.T) {
+	stub := newStubServer()
+	defer stub.Close()
+	sink, err := NewLokiSink(logrus.WithFields(nil), LokiConfig{URL: stub.URL + "/custom/push", JSON: true}, Config{BatchSize: 1})
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Write(entry("a", time.Time{}, "{\n  \"message\": \"one\"\n}")))
+
+	requests, bodies := stub.received()
+	assert.Equal(t, "/custom/push", requests[0].URL.Path)
+	var push pushRequest
+	assert.Nil(t, json.Unmarshal(bodies[0], &push))
+	assert.Equal(t, defaultLokiLabels, push.Streams[0].Stream)
+	assert.Equal(t, `{"message":"one"}`, push.Streams[0].Values[0][1])
+}
+
+func TestLokiSink_errors(t *testing.T) {
+	stub := newStubServer()
+	defer stub.Close()
+	sink, err := NewLokiSink(logrus.WithFields(nil), LokiConfig{URL: stub.URL}, Config{BatchSize: 1, Retries: 2, RetryBackoff: time.Millisecond})
+	assert.Nil(t, err)
+
+	// server errors are retried
+	stub.statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+	assert.Nil(t, sink.Write(entry("a", time.Time{}, `{}`)))
+	requests, _ := stub.received()
+	assert.Len(t, requests, 3)
+
+	// client errors are not
+	stub.statuses = []int{http.StatusBadRequest}
+	assert.NotNil(t, sink.Write(entry("b", time.Time{}, `{}`)))
+	requests, _ = stub.received()
+	assert.Len(t, requests, 4)
+
+	_, err = NewLokiSink(logrus.WithFields(nil), LokiConfig{URL: stub.URL, Labels: Mapping{{Target: "bad-label", Source: "x"}}}, Config{})
+	assert.NotNil(t, err)
+}
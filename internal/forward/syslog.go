@@ -0,0 +1,204 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+)
+
+// syslog networks
+const (
+	NetworkUDP = "udp"
+	NetworkTCP = "tcp"
+	NetworkTLS = "tls"
+)
+
+// timeout of the connections and writes to the syslog server
+const syslogTimeout = 10 * time.Second
+
+// maximum size of the udp messages, the longer ones are truncated
+const maxDatagram = 65000
+
+// facility of the messages, user-level
+const syslogFacility = 1
+
+// names of the log levels of each severity, by severity
+var severityNames = [][]string{
+	{"emerg", "emergency", "panic"},
+	{"alert"},
+	{"crit", "critical", "fatal"},
+	{"err", "error"},
+	{"warn", "warning"},
+	{"notice"},
+	{"info", "information", "informational"},
+	{"debug", "trace"},
+}
+
+// default severity of the logs without a known level
+const defaultSeverity = 6
+
+// SyslogConfig configures a syslog sink
+type SyslogConfig struct {
+	Network string // udp, tcp or tls
+	Address string
+	TLS     *tls.Config // configuration of the tls connections, the defaults if nil
+
+	// Fields maps the header fields and the message to fields of the logs:
+	// hostname, app, procid, msgid, severity (a level name or number) and message.
+	// The message is the field "message" by default, or the log line if it is missing.
+	Fields Mapping
+}
+
+// syslogSender writes RFC 5424 messages, one per datagram over udp and octet counted over tcp and tls
+type syslogSender struct {
+	config   SyslogConfig
+	hostname string
+	conn     net.Conn
+}
+
+// NewSyslogSink creates a sink sending the logs to a syslog server
+func NewSyslogSink(logger *logrus.Entry, config SyslogConfig, batch Config) (tail.Sink, error) {
+	switch config.Network {
+	case NetworkUDP, NetworkTCP, NetworkTLS:
+	default:
+		return nil, fmt.Errorf("invalid syslog network: %s", config.Network)
+	}
+	if err := config.Fields.check("hostname", "app", "procid", "msgid", "severity", "message"); err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	s := &syslogSender{config: config, hostname: hostname}
+	return newBatchSink(logger.WithFields(logrus.Fields{"sink": "syslog", "address": config.Address}), batch, s), nil
+}
+
+func (s *syslogSender) send(ctx context.Context, batch []*domain.Entry) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+
+	var err error
+	if s.config.Network == NetworkUDP {
+		for _, e := range batch {
+			msg := s.format(e)
+			if len(msg) > maxDatagram {
+				msg = msg[:maxDatagram]
+			}
+			if _, err = s.conn.Write(msg); err != nil {
+				break
+			}
+		}
+	} else {
+		var buf bytes.Buffer
+		for _, e := range batch {
+			msg := s.format(e)
+			buf.WriteString(strconv.Itoa(len(msg)))
+			buf.WriteByte(' ')
+			buf.Write(msg)
+		}
+		_, err = s.conn.Write(buf.Bytes())
+	}
+
+	// the connection is opened again on the retries
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// dial connects to the syslog server
+func (s *syslogSender) dial() (net.Conn, error) {
+	d := &net.Dialer{Timeout: syslogTimeout}
+	if s.config.Network != NetworkTLS {
+		return d.Dial(s.config.Network, s.config.Address)
+	}
+	config := s.config.TLS
+	if config == nil {
+		config = &tls.Config{}
+	}
+	return tls.DialWithDialer(d, "tcp", s.config.Address, config)
+}
+
+func (s *syslogSender) close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// format formats the log as a RFC 5424 message
+func (s *syslogSender) format(e *domain.Entry) []byte {
+	header := func(name string, fallback string, max int) string {
+		v := fallback
+		if f, ok := s.config.Fields.get(name); ok {
+			v = f.text(e)
+		}
+		return headerField(v, max)
+	}
+
+	message := e.Line
+	f, ok := s.config.Fields.get("message")
+	if !ok {
+		f = Field{Target: "message", Source: "message"}
+	}
+	if v := f.text(e); v != "" {
+		message = v
+	}
+
+	severity := defaultSeverity
+	if f, ok := s.config.Fields.get("severity"); ok {
+		severity = parseSeverity(f.text(e))
+	}
+
+	ts := timestamp(e).UTC().Format("2006-01-02T15:04:05.000000Z07:00")
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %s %s - %s",
+		syslogFacility*8+severity, ts,
+		header("hostname", s.hostname, 255), header("app", "elklogs", 48),
+		header("procid", "", 128), header("msgid", "", 32),
+		message))
+}
+
+// headerField converts the value to the printable ascii characters allowed in the header, - if empty
+func headerField(v string, max int) string {
+	b := make([]byte, 0, len(v))
+	for i := 0; i < len(v) && len(b) < max; i++ {
+		if v[i] > 32 && v[i] < 127 {
+			b = append(b, v[i])
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
+
+// parseSeverity parses a level name or a severity number
+func parseSeverity(level string) int {
+	if n, err := strconv.Atoi(level); err == nil && n >= 0 && n <= 7 {
+		return n
+	}
+	level = strings.ToLower(level)
+	for severity, names := range severityNames {
+		for _, name := range names {
+			if name == level {
+				return severity
+			}
+		}
+	}
+	return defaultSeverity
+}
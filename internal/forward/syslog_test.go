@@ -0,0 +1,160 @@
+package forward
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// readFrames reads the octet counted messages of the first connection accepted
+func readFrames(t *testing.T, l net.Listener, n int) <-chan []string {
+	frames := make(chan []string, 1)
+	go func() {
+		var messages []string
+		defer func() { frames <- messages }()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for len(messages) < n {
+			size, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			length, _ := strconv.Atoi(strings.TrimSpace(size))
+			b := make([]byte, length)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return
+			}
+			messages = append(messages, string(b))
+		}
+	}()
+	return frames
+}
+
+// selfSigned creates a certificate for the local address
+func selfSigned(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func TestSyslogSink_format(t *testing.T) {
+	fields, err := ParseMapping(`hostname=host.name,app=service,procid=pid,severity=level,msgid="audit"`)
+	assert.Nil(t, err)
+	s := &syslogSender{config: SyslogConfig{Fields: fields}, hostname: "local"}
+	ts := time.Date(2018, 10, 10, 10, 0, 0, 123456000, time.UTC)
+
+	e := entry("a", ts, `{"host":{"name":"web 1"},"service":"api","pid":42,"level":"ERROR","message":"failed"}`)
+	assert.Equal(t, "<11>1 2018-10-10T10:00:00.123456Z web1 api 42 audit - failed", string(s.format(e)))
+
+	// the defaults are used for the fields that are not mapped, and the line when there is no message
+	s.config.Fields = nil
+	e = entry("b", ts, `{"msg":"started"}`)
+	assert.Equal(t, "<14>1 2018-10-10T10:00:00.123456Z local elklogs - - - b line", string(s.format(e)))
+}
+
+func TestParseSeverity(t *testing.T) {
+	assert.Equal(t, 3, parseSeverity("error"))
+	assert.Equal(t, 4, parseSeverity("WARN"))
+	assert.Equal(t, 2, parseSeverity("fatal"))
+	assert.Equal(t, 5, parseSeverity("5"))
+	assert.Equal(t, defaultSeverity, parseSeverity("9"))
+	assert.Equal(t, defaultSeverity, parseSeverity("verbose"))
+}
+
+func TestSyslogSink_udp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	sink, err := NewSyslogSink(logrus.WithFields(nil), SyslogConfig{Network: NetworkUDP, Address: conn.LocalAddr().String()}, Config{BatchSize: 2})
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Write(entry("a", time.Time{}, `{"message":"one"}`)))
+	assert.Nil(t, sink.Write(entry("b", time.Time{}, `{"message":"two"}`)))
+	assert.Nil(t, sink.Close())
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for _, want := range []string{" - one", " - two"} {
+		b := make([]byte, 1024)
+		n, _, err := conn.ReadFrom(b)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasSuffix(string(b[:n]), want), string(b[:n]))
+	}
+}
+
+func TestSyslogSink_tcp(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer l.Close()
+	frames := readFrames(t, l, 3)
+
+	sink, err := NewSyslogSink(logrus.WithFields(nil), SyslogConfig{Network: NetworkTCP, Address: l.Addr().String()}, Config{BatchSize: 2})
+	assert.Nil(t, err)
+	for _, m := range []string{"one", "two", "three"} {
+		assert.Nil(t, sink.Write(entry(m, time.Time{}, `{"message":"`+m+`"}`)))
+	}
+	assert.Nil(t, sink.Close())
+
+	messages := <-frames
+	assert.Len(t, messages, 3)
+	for i, want := range []string{"one", "two", "three"} {
+		assert.True(t, strings.HasPrefix(messages[i], "<14>1 "))
+		assert.True(t, strings.HasSuffix(messages[i], " - "+want))
+	}
+}
+
+func TestSyslogSink_tls(t *testing.T) {
+	cert, pool := selfSigned(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	assert.Nil(t, err)
+	defer l.Close()
+	frames := readFrames(t, l, 1)
+
+	sink, err := NewSyslogSink(logrus.WithFields(nil), SyslogConfig{Network: NetworkTLS, Address: l.Addr().String(), TLS: &tls.Config{RootCAs: pool}}, Config{BatchSize: 1})
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Write(entry("a", time.Time{}, `{"message":"secure"}`)))
+	assert.Nil(t, sink.Close())
+
+	messages := <-frames
+	assert.Len(t, messages, 1)
+	assert.True(t, strings.HasSuffix(messages[0], " - secure"))
+}
+
+func TestNewSyslogSink_invalid(t *testing.T) {
+	_, err := NewSyslogSink(logrus.WithFields(nil), SyslogConfig{Network: "http", Address: "localhost:514"}, Config{})
+	assert.NotNil(t, err)
+	_, err = NewSyslogSink(logrus.WithFields(nil), SyslogConfig{Network: NetworkUDP, Address: "localhost:514", Fields: Mapping{{Target: "facility", Source: "x"}}}, Config{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,373 @@
+// Package metrics follows log queries with the tail engine and exposes what they match as Prometheus metrics,
+// along with metrics of the polling itself.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+)
+
+// Rule turns the logs matching a query into a metric: a counter of the logs named <name>_total,
+// or a gauge named <name> holding the latest value of a numeric field when Value is set.
+// The series are labelled with the values of the label fields.
+type Rule struct {
+	Name   string
+	Query  string
+	Labels []string // fields whose values label the series
+	Value  string   // numeric field of the gauge, the logs are counted if empty
+}
+
+// ParseRule parses a rule given as comma separated key=value pairs: name, query, labels and value.
+// Labels are separated by commas too, and the other commas are kept in the query,
+// such as in name=errors,query=level:error,labels=service,host.
+func ParseRule(s string) (Rule, error) {
+	var r Rule
+	key := ""
+	for _, part := range strings.Split(s, ",") {
+		value, continued := part, true
+		if i := strings.Index(part, "="); i > 0 {
+			switch part[:i] {
+			case "name", "query", "labels", "value":
+				key, value, continued = part[:i], part[i+1:], false
+			}
+		}
+
+		switch {
+		case key == "query" && continued:
+			r.Query += "," + value
+		case key == "query":
+			r.Query = value
+		case key == "labels" && value != "":
+			r.Labels = append(r.Labels, value)
+		case key == "name" && !continued:
+			r.Name = value
+		case key == "value" && !continued:
+			r.Value = value
+		default:
+			return Rule{}, fmt.Errorf("invalid rule %q: unexpected %q", s, part)
+		}
+	}
+	return r, r.validate()
+}
+
+// validate checks that the rule can be exposed
+func (r Rule) validate() error {
+	if !nameRegexp.MatchString(r.Name) {
+		return fmt.Errorf("invalid rule name: %q", r.Name)
+	}
+	names := make(map[string]bool)
+	for _, field := range r.Labels {
+		name := sanitizeName(field)
+		if names[name] {
+			return fmt.Errorf("duplicate label %s in rule %s", name, r.Name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// metricName is the name of the metric of the rule
+func (r Rule) metricName() string {
+	if r.Value != "" {
+		return r.Name
+	}
+	return r.Name + "_total"
+}
+
+// describe describes the logs of the rule in the help of its metric
+func (r Rule) describe() string {
+	if r.Query == "" {
+		return "logs"
+	}
+	return "logs matching " + r.Query
+}
+
+// Config configures the collector
+type Config struct {
+	IndexPattern string
+	Entries      int           // logs fetched per query, the polls page through the older logs until the previous one
+	Refresh      time.Duration // interval between polls of a rule
+	Retries      int           // retries of a failed poll before it is skipped
+	RetryBackoff time.Duration // wait before the first retry, doubled on each one
+}
+
+// Collector polls the rules and updates their metrics
+type Collector struct {
+	logger    *logrus.Entry
+	connector tail.Connector
+	config    Config
+	registry  *Registry
+	rules     []*follower
+	now       func() time.Time
+
+	pollDuration *metric
+	documents    *metric
+	rate         *metric
+	lag          *metric
+	retries      *metric
+	pollErrors   *metric
+	truncated    *metric
+}
+
+// follower follows the logs of a rule
+type follower struct {
+	rule   Rule
+	metric *metric
+	tail   *tail.Tail
+	query  *domain.Query
+	polled time.Time        // end of the previous successful poll
+	last   *domain.LogEntry // newest log counted
+}
+
+// New creates a collector of the rules, counting the logs newer than its creation
+func New(logger *logrus.Entry, connector tail.Connector, config Config, rules []Rule) (*Collector, error) {
+	r := NewRegistry()
+	c := &Collector{
+		logger:    logger,
+		connector: connector,
+		config:    config,
+		registry:  r,
+		now:       time.Now,
+
+		pollDuration: r.summary("elklogs_poll_duration_seconds", "Duration of the polls of the rules, retries included.", "rule"),
+		documents:    r.counter("elklogs_documents_total", "Logs fetched by the rules.", "rule"),
+		rate:         r.gauge("elklogs_documents_per_second", "Logs fetched per second by the rules between their last polls.", "rule"),
+		lag:          r.gauge("elklogs_lag_seconds", "Time between the newest log of the last poll fetching logs and the end of the poll.", "rule"),
+		retries:      r.counter("elklogs_retries_total", "Retries of the failed queries of the rules.", "rule"),
+		pollErrors:   r.counter("elklogs_poll_errors_total", "Polls of the rules skipped after all their retries failed.", "rule"),
+		truncated:    r.counter("elklogs_truncated_polls_total", "Polls of the rules that could not page back to the previous poll, missing logs.", "rule"),
+	}
+
+	// the metrics of the rules cannot take the names of the others
+	names := make(map[string]bool)
+	for _, m := range r.metrics {
+		names[m.name] = true
+	}
+
+	start := c.now()
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		if names[rule.metricName()] {
+			return nil, fmt.Errorf("duplicate metric name: %s", rule.metricName())
+		}
+		names[rule.metricName()] = true
+
+		labels := make([]string, len(rule.Labels))
+		for i, field := range rule.Labels {
+			labels[i] = sanitizeName(field)
+		}
+		f := &follower{
+			rule:  rule,
+			tail:  tail.New(logger.WithFields(logrus.Fields{"rule": rule.Name}), connector),
+			query: &domain.Query{IndexPattern: config.IndexPattern, Query: rule.Query, Entries: config.Entries, AfterDateTime: &start},
+		}
+		if rule.Value != "" {
+			f.metric = r.gauge(rule.metricName(), fmt.Sprintf("Latest %s of the %s.", rule.Value, rule.describe()), labels...)
+		} else {
+			f.metric = r.counter(rule.metricName(), fmt.Sprintf("Number of %s.", rule.describe()), labels...)
+			if len(labels) == 0 {
+				f.metric.add(0)
+			}
+		}
+		if err := f.tail.Reset(f.query); err != nil {
+			return nil, err
+		}
+
+		// the series of the rule are exposed before its first poll
+		for _, m := range []*metric{c.documents, c.retries, c.pollErrors, c.truncated} {
+			m.add(0, rule.Name)
+		}
+		c.rules = append(c.rules, f)
+	}
+	return c, nil
+}
+
+// Handler returns the http handler exposing the metrics on /metrics
+func (c *Collector) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c.registry)
+	return mux
+}
+
+// Run polls the rules on each refresh until the context is done.
+// Failed polls are counted and logged, they do not stop the collector.
+func (c *Collector) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, f := range c.rules {
+		wg.Add(1)
+		go func(f *follower) {
+			defer wg.Done()
+			ticker := time.NewTicker(c.config.Refresh)
+			defer ticker.Stop()
+			for {
+				if err := c.poll(ctx, f); err != nil && ctx.Err() == nil {
+					c.logger.WithFields(logrus.Fields{"rule": f.rule.Name, "err": err}).Warn("poll failed")
+				}
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(f)
+	}
+	wg.Wait()
+}
+
+// poll fetches the new logs of the rule and updates the metrics
+func (c *Collector) poll(ctx context.Context, f *follower) error {
+	name := f.rule.Name
+	start := c.now()
+	var logs []*domain.LogEntry
+	var truncated bool
+	err := c.retry(ctx, name, func() error {
+		// the indices are fetched again so the ones created meanwhile are followed
+		indices, err := f.tail.Indices(ctx, f.query)
+		if err != nil || len(indices) == 0 {
+			return err
+		}
+		logs, truncated, err = f.fetch(ctx, indices)
+		return err
+	})
+	end := c.now()
+	c.pollDuration.observe(end.Sub(start).Seconds(), name)
+	if err != nil {
+		c.pollErrors.add(1, name)
+		return err
+	}
+	if truncated {
+		c.truncated.add(1, name)
+		c.logger.WithFields(logrus.Fields{"rule": name, "logs": len(logs)}).Warn("poll truncated, more logs than a page share a timestamp")
+	}
+	if len(logs) > 0 {
+		f.last = logs[len(logs)-1]
+	}
+
+	c.documents.add(float64(len(logs)), name)
+	if !f.polled.IsZero() {
+		if elapsed := end.Sub(f.polled).Seconds(); elapsed > 0 {
+			c.rate.set(float64(len(logs))/elapsed, name)
+		}
+	}
+	f.polled = end
+	if len(logs) > 0 && !logs[len(logs)-1].Timestamp.IsZero() {
+		c.lag.set(end.Sub(logs[len(logs)-1].Timestamp).Seconds(), name)
+	}
+
+	for _, l := range logs {
+		c.record(f, l)
+	}
+	return nil
+}
+
+// fetch returns the logs newer than the last one counted, oldest first, paging through the older logs
+// when more than a page of logs arrived since. The poll is truncated when a page holds no new logs
+// before reaching the last one, as more logs than a page share a timestamp.
+func (f *follower) fetch(ctx context.Context, indices []string) ([]*domain.LogEntry, bool, error) {
+	// the newest page is fetched again on each poll, the logs already counted being skipped,
+	// so a failed attempt can be retried
+	if err := f.tail.Reset(f.query); err != nil {
+		return nil, false, err
+	}
+	page, err := f.tail.Fetch(ctx, f.query, indices)
+	if err != nil {
+		return nil, false, err
+	}
+	seen := make(map[string]bool)
+	logs, reached := f.newer(page, seen)
+	for !reached && len(logs) > 0 {
+		if page, err = f.tail.Older(ctx, f.query, indices, logs[0]); err != nil {
+			return nil, false, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		older, done := f.newer(page, seen)
+		if len(older) == 0 && !done {
+			return logs, true, nil
+		}
+		logs, reached = append(older, logs...), done
+	}
+	return logs, false, nil
+}
+
+// newer returns the logs of the page newer than the last one counted and not seen yet, oldest first,
+// and if the page reached the last one
+func (f *follower) newer(page []*domain.LogEntry, seen map[string]bool) ([]*domain.LogEntry, bool) {
+	var logs []*domain.LogEntry
+	reached := false
+	for i := len(page) - 1; i >= 0; i-- {
+		l := page[i]
+		if f.last != nil && (l.ID == f.last.ID || l.Timestamp.Before(f.last.Timestamp)) {
+			reached = true
+			break
+		}
+		if !seen[l.ID] {
+			seen[l.ID] = true
+			logs = append(logs, l)
+		}
+	}
+	for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+		logs[i], logs[j] = logs[j], logs[i]
+	}
+	return logs, reached
+}
+
+// record updates the metric of the rule with the log
+func (c *Collector) record(f *follower, l *domain.LogEntry) {
+	if l.Message == nil {
+		return
+	}
+	values := make([]string, len(f.rule.Labels))
+	for i, field := range f.rule.Labels {
+		// logs without the field are counted with an empty label
+		values[i], _ = tail.FieldValue(l.Message, field)
+	}
+	if f.rule.Value == "" {
+		f.metric.add(1, values...)
+		return
+	}
+
+	v, err := tail.FieldValue(l.Message, f.rule.Value)
+	if err != nil {
+		return
+	}
+	x, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		c.logger.WithFields(logrus.Fields{"rule": f.rule.Name, "field": f.rule.Value, "value": v}).Debug("log value is not a number")
+		return
+	}
+	f.metric.set(x, values...)
+}
+
+// retry runs the operation until it succeeds or the retries are exhausted, backing off between attempts
+func (c *Collector) retry(ctx context.Context, rule string, op func() error) error {
+	backoff := c.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= c.config.Retries || ctx.Err() != nil {
+			return err
+		}
+		c.retries.add(1, rule)
+		c.logger.WithFields(logrus.Fields{"rule": rule, "attempt": attempt + 1, "err": err}).Debug("retrying query")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "retry interrupted")
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/tail/tailtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// lines returns the exposed samples of the metric
+func lines(t *testing.T, c *Collector, name string) []string {
+	var buf bytes.Buffer
+	assert.Nil(t, c.registry.Write(&buf))
+	var result []string
+	for _, l := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(l, name+" ") || strings.HasPrefix(l, name+"{") {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("name=errors,query=level:error,labels=service,kubernetes.pod.name")
+	assert.Nil(t, err)
+	assert.Equal(t, Rule{Name: "errors", Query: "level:error", Labels: []string{"service", "kubernetes.pod.name"}}, r)
+
+	r, err = ParseRule("name=queue,query=tags:(a,b),value=queue.size")
+	assert.Nil(t, err)
+	assert.Equal(t, Rule{Name: "queue", Query: "tags:(a,b)", Value: "queue.size"}, r)
+
+	for _, s := range []string{"query=x", "name=bad-name", "name=x,labels=a,a", "other,name=x", "name=x,y"} {
+		_, err := ParseRule(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestCollector_poll(t *testing.T) {
+	conn := tailtest.New(t)
+	defer conn.Close()
+	c, err := New(logrus.WithFields(nil), conn, Config{IndexPattern: "logstash-[0-9].*", Entries: 10}, []Rule{
+		{Name: "errors", Query: "level:error", Labels: []string{"service"}},
+		{Name: "queue", Value: "queue.size", Labels: []string{"host.name"}},
+	})
+	assert.Nil(t, err)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	// the logs older than the collector are not counted
+	conn.Add("", now.Add(-time.Minute), map[string]interface{}{"level": "error", "service": "api"})
+	conn.Add("", now.Add(time.Second), map[string]interface{}{"level": "error", "service": "api", "queue": map[string]interface{}{"size": 3}, "host": map[string]string{"name": "h1"}})
+	conn.Add("", now.Add(2*time.Second), map[string]interface{}{"level": "error", "service": "api", "queue": map[string]interface{}{"size": 5}, "host": map[string]string{"name": "h1"}})
+	conn.Add("", now.Add(3*time.Second), map[string]interface{}{"level": "error", "service": "db"})
+	conn.Add("", now.Add(3*time.Second), map[string]interface{}{"level": "info", "service": "db"})
+	now = now.Add(4 * time.Second)
+	for _, f := range c.rules {
+		assert.Nil(t, c.poll(context.Background(), f))
+	}
+	assert.Equal(t, []string{`errors_total{service="api"} 2`, `errors_total{service="db"} 1`}, lines(t, c, "errors_total"))
+	assert.Equal(t, []string{`queue{host_name="h1"} 5`}, lines(t, c, "queue"))
+	assert.Equal(t, []string{`elklogs_lag_seconds{rule="errors"} 1`, `elklogs_lag_seconds{rule="queue"} 1`}, lines(t, c, "elklogs_lag_seconds"))
+
+	// only the new logs are counted, the rate is measured between polls
+	now = now.Add(2 * time.Second)
+	conn.Add("", now, map[string]interface{}{"level": "error", "service": "db"})
+	assert.Nil(t, c.poll(context.Background(), c.rules[0]))
+	assert.Equal(t, []string{`errors_total{service="api"} 2`, `errors_total{service="db"} 2`}, lines(t, c, "errors_total"))
+	assert.Equal(t, []string{`elklogs_documents_per_second{rule="errors"} 0.5`}, lines(t, c, "elklogs_documents_per_second"))
+	assert.Equal(t, []string{`elklogs_documents_total{rule="errors"} 4`, `elklogs_documents_total{rule="queue"} 4`}, lines(t, c, "elklogs_documents_total"))
+}
+
+func TestCollector_paging(t *testing.T) {
+	conn := tailtest.New(t)
+	defer conn.Close()
+	c, err := New(logrus.WithFields(nil), conn, Config{IndexPattern: "logstash-[0-9].*", Entries: 2}, []Rule{{Name: "all"}})
+	assert.Nil(t, err)
+	// elasticsearch keeps the milliseconds of the timestamps, which bound the pages
+	now := time.Now().Truncate(time.Millisecond)
+
+	// the logs beyond a page are counted by paging back to the previous poll,
+	// without reaching the logs older than the collector
+	for i := 0; i < 3; i++ {
+		conn.Add("", now.Add(-time.Duration(i+1)*time.Minute), map[string]interface{}{"message": "old"})
+	}
+	for i := 1; i <= 5; i++ {
+		conn.Add("", now.Add(time.Duration(i)*time.Second), map[string]interface{}{"message": i})
+	}
+	assert.Nil(t, c.poll(context.Background(), c.rules[0]))
+	assert.Equal(t, []string{`all_total 5`}, lines(t, c, "all_total"))
+	for i := 6; i <= 8; i++ {
+		conn.Add("", now.Add(time.Duration(i)*time.Second), map[string]interface{}{"message": i})
+	}
+	assert.Nil(t, c.poll(context.Background(), c.rules[0]))
+	assert.Nil(t, c.poll(context.Background(), c.rules[0]))
+	assert.Equal(t, []string{`all_total 8`}, lines(t, c, "all_total"))
+	assert.Equal(t, []string{`elklogs_truncated_polls_total{rule="all"} 0`}, lines(t, c, "elklogs_truncated_polls_total"))
+
+	// more logs than a page sharing a timestamp cannot be paged through
+	for i := 0; i < 4; i++ {
+		conn.Add("", now.Add(time.Hour), map[string]interface{}{"message": i})
+	}
+	assert.Nil(t, c.poll(context.Background(), c.rules[0]))
+	assert.Equal(t, []string{`all_total 10`}, lines(t, c, "all_total"))
+	assert.Equal(t, []string{`elklogs_truncated_polls_total{rule="all"} 1`}, lines(t, c, "elklogs_truncated_polls_total"))
+}
+
+func TestCollector_retries(t *testing.T) {
+	conn := tailtest.New(t)
+	defer conn.Close()
+	c, err := New(logrus.WithFields(nil), conn, Config{IndexPattern: "logstash-[0-9].*", Entries: 10, Retries: 2, RetryBackoff: time.Millisecond}, []Rule{{Name: "all"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`all_total 0`}, lines(t, c, "all_total"))
+
+	conn.Add("", time.Now(), map[string]interface{}{"message": "a"})
+	conn.Fail(2, errors.New("unavailable"))
+	assert.Nil(t, c.poll(context.Background(), c.rules[0]))
+	assert.Equal(t, []string{`all_total 1`}, lines(t, c, "all_total"))
+	assert.Equal(t, []string{`elklogs_retries_total{rule="all"} 2`}, lines(t, c, "elklogs_retries_total"))
+
+	conn.Fail(3, errors.New("unavailable"))
+	assert.NotNil(t, c.poll(context.Background(), c.rules[0]))
+	assert.Equal(t, []string{`elklogs_retries_total{rule="all"} 4`}, lines(t, c, "elklogs_retries_total"))
+	assert.Equal(t, []string{`elklogs_poll_errors_total{rule="all"} 1`}, lines(t, c, "elklogs_poll_errors_total"))
+	assert.Equal(t, []string{`elklogs_poll_duration_seconds_count{rule="all"} 2`}, lines(t, c, "elklogs_poll_duration_seconds_count"))
+}
+
+func TestNew_duplicateNames(t *testing.T) {
+	conn := tailtest.New(t)
+	defer conn.Close()
+	for _, rules := range [][]Rule{{{Name: "a"}, {Name: "a"}}, {{Name: "a"}, {Name: "a_total", Value: "x"}}, {{Name: "elklogs_documents"}}} {
+		_, err := New(logrus.WithFields(nil), conn, Config{}, rules)
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric types of the text exposition format
+const (
+	typeCounter = "counter"
+	typeGauge   = "gauge"
+	typeSummary = "summary"
+)
+
+// contentType of the text exposition format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// nameRegexp matches the valid metric and label names
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// invalidRegexp matches the characters not allowed in metric and label names
+var invalidRegexp = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// Registry holds the metrics exposed in the Prometheus text format
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*metric // in registration order
+}
+
+// metric is a family of series sharing a name and label names
+type metric struct {
+	registry *Registry
+	name     string
+	help     string
+	typ      string
+	labels   []string
+	series   map[string]*series
+}
+
+// series is the value of a metric for a set of label values
+type series struct {
+	values []string
+	value  float64
+	count  uint64 // number of observations of summaries
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// counter registers a counter
+func (r *Registry) counter(name string, help string, labels ...string) *metric {
+	return r.register(name, help, typeCounter, labels)
+}
+
+// gauge registers a gauge
+func (r *Registry) gauge(name string, help string, labels ...string) *metric {
+	return r.register(name, help, typeGauge, labels)
+}
+
+// summary registers a summary exposing the sum and count of its observations
+func (r *Registry) summary(name string, help string, labels ...string) *metric {
+	return r.register(name, help, typeSummary, labels)
+}
+
+func (r *Registry) register(name string, help string, typ string, labels []string) *metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := &metric{registry: r, name: name, help: help, typ: typ, labels: labels, series: make(map[string]*series)}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// get returns the series of the label values, creating it if needed. The registry must be locked.
+func (m *metric) get(values []string) *series {
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		m.series[key] = s
+	}
+	return s
+}
+
+// add increments the series of the label values
+func (m *metric) add(v float64, values ...string) {
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+	m.get(values).value += v
+}
+
+// set replaces the value of the series of the label values
+func (m *metric) set(v float64, values ...string) {
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+	m.get(values).value = v
+}
+
+// observe adds an observation to the series of the label values
+func (m *metric) observe(v float64, values ...string) {
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+	s := m.get(values)
+	s.value += v
+	s.count++
+}
+
+// Write writes the metrics in the Prometheus text format, with the series sorted by labels
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range r.metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.typ)
+
+		keys := make([]string, 0, len(m.series))
+		for k := range m.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := m.series[k]
+			labels := formatLabels(m.labels, s.values)
+			if m.typ == typeSummary {
+				fmt.Fprintf(bw, "%s_sum%s %s\n", m.name, labels, formatValue(s.value))
+				fmt.Fprintf(bw, "%s_count%s %d\n", m.name, labels, s.count)
+				continue
+			}
+			fmt.Fprintf(bw, "%s%s %s\n", m.name, labels, formatValue(s.value))
+		}
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP writes the metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.Write(w)
+}
+
+// formatLabels formats the label pairs of a series, empty if there are none
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, escapeValue(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatValue formats a sample value
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escapeHelp escapes the backslashes and line feeds of a help text
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+// escapeValue escapes the backslashes, quotes and line feeds of a label value
+func escapeValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// sanitizeName replaces the characters not allowed in metric and label names with underscores,
+// so fields such as kubernetes.pod.name can be used as labels
+func sanitizeName(name string) string {
+	name = invalidRegexp.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
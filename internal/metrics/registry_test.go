@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	c := r.counter("errors_total", "Logs matching level:error.", "service")
+	g := r.gauge("queue", "Latest size.")
+	s := r.summary("poll_seconds", "Duration of the polls.", "rule")
+	c.add(2, "b")
+	c.add(1, `a"\`)
+	c.add(1, "b")
+	g.set(1.5)
+	s.observe(0.5, "errors")
+	s.observe(0.25, "errors")
+
+	var buf bytes.Buffer
+	assert.Nil(t, r.Write(&buf))
+	assert.Equal(t, `# HELP errors_total Logs matching level:error.
+# TYPE errors_total counter
+errors_total{service="a\"\\"} 1
+errors_total{service="b"} 3
+# HELP queue Latest size.
+# TYPE queue gauge
+queue 1.5
+# HELP poll_seconds Duration of the polls.
+# TYPE poll_seconds summary
+poll_seconds_sum{rule="errors"} 0.75
+poll_seconds_count{rule="errors"} 2
+`, buf.String())
+}
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "kubernetes_pod_name", sanitizeName("kubernetes.pod.name"))
+	assert.Equal(t, "_1xx", sanitizeName("1xx"))
+	assert.Equal(t, "http_status", sanitizeName("http-status"))
+}
@@ -0,0 +1,193 @@
+// Package patterns groups log messages by their shape, following the Drain template mining algorithm:
+// messages are split in tokens, variable tokens are masked, and each message joins the most similar
+// template of the same length and leading tokens, generalizing the tokens that differ.
+package patterns
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Wildcard replaces the tokens that vary between the messages of a template
+const Wildcard = "<*>"
+
+// masks replace the variable tokens with placeholders before mining, in order
+var masks = []struct {
+	re          *regexp.Regexp
+	placeholder string
+}{
+	{regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`), "<UUID>"},
+	{regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}(:\d+)?$`), "<IP>"},
+	{regexp.MustCompile(`^[-+]?\d+([.,:]\d+)*(ms|s|m|h|%|b|kb|mb|gb)?$`), "<NUM>"},
+	{regexp.MustCompile(`^(0x)?[0-9a-f]*\d[0-9a-f]*$`), "<HEX>"},
+}
+
+// minimum length of the hexadecimal tokens that are masked, so short words with digits are kept
+const minHexLength = 8
+
+// punctuation trimmed around the tokens before masking them
+const punctuation = `"'()[]{},;=`
+
+// Template is a message shape along with the number of messages that matched it
+type Template struct {
+	ID       int      `json:"id"`
+	Tokens   []string `json:"-"`
+	Count    int64    `json:"count"`
+	Examples []string `json:"examples"`
+}
+
+// String returns the template tokens joined by spaces
+func (t *Template) String() string {
+	return strings.Join(t.Tokens, " ")
+}
+
+// node is a node of the prefix tree, its leaves hold the templates
+type node struct {
+	children  map[string]*node
+	templates []*Template
+}
+
+// Miner groups messages into templates
+type Miner struct {
+	depth       int     // number of leading tokens used to select the templates
+	similarity  float64 // minimum ratio of equal tokens to join a template
+	maxChildren int     // tokens of a tree level above it are grouped as a wildcard
+	maxExamples int
+
+	root      *node
+	templates []*Template
+}
+
+// NewMiner creates a miner joining messages with a ratio of equal tokens above the similarity,
+// and keeping a few example messages of each template
+func NewMiner(similarity float64, maxExamples int) *Miner {
+	return &Miner{
+		depth:       1,
+		similarity:  similarity,
+		maxChildren: 100,
+		maxExamples: maxExamples,
+		root:        &node{children: make(map[string]*node)},
+	}
+}
+
+// Add adds a message to its template, reporting if the template was created by it
+func (m *Miner) Add(message string) (*Template, bool) {
+	tokens := Tokenize(message)
+	leaf := m.leaf(tokens)
+
+	best, bestSim := (*Template)(nil), -1.0
+	for _, t := range leaf.templates {
+		if sim := similarity(t.Tokens, tokens); sim > bestSim {
+			best, bestSim = t, sim
+		}
+	}
+
+	if best == nil || bestSim < m.similarity {
+		t := &Template{ID: len(m.templates) + 1, Tokens: tokens, Count: 1, Examples: []string{message}}
+		if m.maxExamples == 0 {
+			t.Examples = nil
+		}
+		leaf.templates = append(leaf.templates, t)
+		m.templates = append(m.templates, t)
+		return t, true
+	}
+
+	for i, tok := range tokens {
+		if best.Tokens[i] != tok {
+			best.Tokens[i] = Wildcard
+		}
+	}
+	best.Count++
+	if len(best.Examples) < m.maxExamples {
+		best.Examples = append(best.Examples, message)
+	}
+	return best, false
+}
+
+// Templates returns the templates sorted by count, most frequent first
+func (m *Miner) Templates() []*Template {
+	result := make([]*Template, len(m.templates))
+	copy(result, m.templates)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Count > result[j].Count
+	})
+	return result
+}
+
+// leaf finds the leaf of the tokens, by their length and leading tokens
+func (m *Miner) leaf(tokens []string) *node {
+	n := m.child(m.root, strconv.Itoa(len(tokens)))
+	for i := 0; i < m.depth && i < len(tokens); i++ {
+		key := tokens[i]
+		// tokens with digits are likely variable
+		if strings.ContainsAny(key, "0123456789") {
+			key = Wildcard
+		}
+		if _, ok := n.children[key]; !ok && len(n.children) >= m.maxChildren {
+			key = Wildcard
+		}
+		n = m.child(n, key)
+	}
+	return n
+}
+
+// child returns the child of the node for the key, creating it when missing
+func (m *Miner) child(n *node, key string) *node {
+	c, ok := n.children[key]
+	if !ok {
+		c = &node{children: make(map[string]*node)}
+		n.children[key] = c
+	}
+	return c
+}
+
+// Tokenize splits the message in tokens, replacing the variable ones with placeholders
+func Tokenize(message string) []string {
+	tokens := strings.Fields(message)
+	for i, tok := range tokens {
+		tokens[i] = mask(tok)
+	}
+	return tokens
+}
+
+// mask replaces the token with the placeholder of its kind, keeping the surrounding punctuation
+func mask(token string) string {
+	start := strings.IndexFunc(token, func(r rune) bool { return !strings.ContainsRune(punctuation, r) })
+	if start < 0 {
+		return token
+	}
+	end := strings.LastIndexFunc(token, func(r rune) bool { return !strings.ContainsRune(punctuation, r) }) + 1
+	value := token[start:end]
+
+	lower := strings.ToLower(value)
+	for _, m := range masks {
+		if m.placeholder == "<HEX>" && len(value) < minHexLength {
+			continue
+		}
+		if m.re.MatchString(lower) {
+			return token[:start] + m.placeholder + token[end:]
+		}
+	}
+
+	// mask the value of key=value and key:value tokens
+	if i := strings.IndexAny(value, "=:"); i > 0 && i < len(value)-1 {
+		return token[:start] + value[:i+1] + mask(value[i+1:]) + token[end:]
+	}
+	return token
+}
+
+// similarity returns the ratio of equal tokens, wildcards are not counted as equal
+func similarity(template []string, tokens []string) float64 {
+	if len(tokens) == 0 {
+		return 1
+	}
+	equal := 0
+	for i, tok := range tokens {
+		if template[i] == tok && tok != Wildcard {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(tokens))
+}
@@ -0,0 +1,45 @@
+package patterns_test
+
+import (
+	"testing"
+
+	"github.com/pmdcosta/elklogs/internal/patterns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t,
+		[]string{"request", "<UUID>", "from", "<IP>", "took", "<NUM>", "(status=<NUM>)", "commit", "<HEX>", "v2"},
+		patterns.Tokenize("request 6f1c2a9e-8a0b-4f35-9d3e-2b7c1a0f9e11 from 10.0.0.12:8080 took 35ms (status=200) commit 3fa9c0e1b2 v2"),
+	)
+	assert.Equal(t, []string{"at", "<NUM>", "user:<NUM>"}, patterns.Tokenize("at 10:32:01 user:42"))
+}
+
+func TestMiner(t *testing.T) {
+	m := patterns.NewMiner(0.5, 2)
+	for _, l := range []string{
+		"connected to 10.0.0.1 in 12ms",
+		"user alice logged in",
+		"connected to 10.0.0.2 in 40ms",
+		"user bob logged in",
+		"user carol logged in",
+	} {
+		m.Add(l)
+	}
+
+	// a new shape creates a template
+	tpl, created := m.Add("disk full on /var")
+	assert.True(t, created)
+	assert.Equal(t, "disk full on /var", tpl.String())
+
+	r := m.Templates()
+	assert.Len(t, r, 3)
+	assert.Equal(t, "user <*> logged in", r[0].String())
+	assert.Equal(t, int64(3), r[0].Count)
+	assert.Equal(t, []string{"user alice logged in", "user bob logged in"}, r[0].Examples)
+	assert.Equal(t, "connected to <IP> in <NUM>", r[1].String())
+	assert.Equal(t, int64(2), r[1].Count)
+
+	_, created = m.Add("user dave logged in")
+	assert.False(t, created)
+}
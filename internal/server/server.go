@@ -0,0 +1,261 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pmdcosta/elklogs/pkg/elklogs"
+	"github.com/sirupsen/logrus"
+)
+
+// stream formats accepted by the format parameter
+const (
+	formatSSE    = "sse"
+	formatNDJSON = "ndjson"
+)
+
+// timeout of the upstream check of the health endpoint
+const healthTimeout = 5 * time.Second
+
+// Config configures the server
+type Config struct {
+	IndexPattern string
+	Entries      int           // entries fetched when a stream starts and on each refresh
+	Refresh      time.Duration // interval between polls of a stream
+	History      int           // latest entries sent to the clients joining a running stream
+	ClientBuffer int           // entries queued per client before it is disconnected as too slow
+	Heartbeat    time.Duration // interval of the keep alive comments of event streams, 0 disables them
+
+	// origins of the pages allowed to open websocket sessions besides the server itself, "*" allows any
+	AllowedOrigins []string
+}
+
+// Server streams logs to http clients, sharing one upstream poller per distinct query
+type Server struct {
+	logger    *logrus.Entry
+	connector elklogs.Connector
+	config    Config
+	hub       *hub
+}
+
+// New creates a server streaming the logs of the connector
+func New(logger *logrus.Entry, connector elklogs.Connector, config Config) *Server {
+	return &Server{
+		logger:    logger,
+		connector: connector,
+		config:    config,
+		hub: &hub{
+			logger:  logger,
+			client:  elklogs.New(connector, elklogs.WithLogger(logger)),
+			config:  config,
+			streams: make(map[string]*stream),
+		},
+	}
+}
+
+// Handler returns the http handler of the server endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", s.stream)
+	mux.HandleFunc("/ws", s.websocket)
+	mux.HandleFunc("/health", s.health)
+	return mux
+}
+
+// event is the json representation of an entry sent to the clients
+type event struct {
+	ID        string          `json:"id"`
+	Index     string          `json:"index"`
+	Timestamp *time.Time      `json:"timestamp,omitempty"`
+	Source    json.RawMessage `json:"source"`
+	Line      string          `json:"line,omitempty"`
+}
+
+// newEvent converts the entry, rendering its line with the formatter if set
+func newEvent(e *elklogs.Entry, f elklogs.Formatter) (*event, error) {
+	ev := &event{ID: e.ID, Index: e.Index, Source: e.Source}
+	if !e.Timestamp.IsZero() {
+		ts := e.Timestamp
+		ev.Timestamp = &ts
+	}
+	if f != nil {
+		line, err := f.Format(e)
+		if err != nil {
+			return nil, err
+		}
+		ev.Line = line
+	}
+	return ev, nil
+}
+
+// encoder writes the events of a stream in its format
+type encoder interface {
+	event(ev *event) error
+	error(err error) error
+	heartbeat() error
+}
+
+// sseEncoder writes server-sent events
+type sseEncoder struct {
+	w io.Writer
+}
+
+func (e sseEncoder) event(ev *event) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "id: %s\nevent: log\ndata: %s\n\n", ev.ID, b)
+	return err
+}
+
+func (e sseEncoder) error(err error) error {
+	b, _ := json.Marshal(map[string]string{"error": err.Error()})
+	_, werr := fmt.Fprintf(e.w, "event: error\ndata: %s\n\n", b)
+	return werr
+}
+
+func (e sseEncoder) heartbeat() error {
+	_, err := io.WriteString(e.w, ": keep-alive\n\n")
+	return err
+}
+
+// ndjsonEncoder writes an event per line
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e ndjsonEncoder) event(ev *event) error {
+	return e.enc.Encode(ev)
+}
+
+func (e ndjsonEncoder) error(err error) error {
+	return e.enc.Encode(map[string]string{"error": err.Error()})
+}
+
+func (e ndjsonEncoder) heartbeat() error {
+	return nil
+}
+
+// stream sends the logs of the query in the request until the client disconnects or the stream fails.
+// Parameters: q, after, before, grep, grep-v, grep-field, format (sse or ndjson) and output (line format).
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	q, err := ParseStreamQuery(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var f elklogs.Formatter
+	if output := values.Get("output"); output != "" {
+		if f, err = elklogs.TemplateFormatter(output); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var enc encoder
+	switch values.Get("format") {
+	case "", formatSSE:
+		w.Header().Set("Content-Type", "text/event-stream")
+		enc = sseEncoder{w}
+	case formatNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc = ndjsonEncoder{json.NewEncoder(w)}
+	default:
+		http.Error(w, fmt.Sprintf("invalid format: %s", values.Get("format")), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	c := s.hub.subscribe(q)
+	defer s.hub.unsubscribe(c)
+	logger := s.logger.WithFields(logrus.Fields{"remote": r.RemoteAddr, "stream": q.key()})
+	logger.Debug("client connected")
+
+	if err := s.send(r.Context(), c, enc, flusher, f); err != nil {
+		logger.WithFields(logrus.Fields{"err": err}).Debug("client disconnected")
+	}
+}
+
+// send writes the entries of the client until its context is done or its stream ends
+func (s *Server) send(ctx context.Context, c *client, enc encoder, flusher http.Flusher, f elklogs.Formatter) error {
+	var heartbeat <-chan time.Time
+	if s.config.Heartbeat > 0 {
+		t := time.NewTicker(s.config.Heartbeat)
+		defer t.Stop()
+		heartbeat = t.C
+	}
+
+	write := func(e *elklogs.Entry) error {
+		ev, err := newEvent(e, f)
+		if err != nil {
+			return err
+		}
+		return enc.event(ev)
+	}
+
+	for {
+		select {
+		case e := <-c.entries:
+			if err := write(e); err != nil {
+				return err
+			}
+			// entries queued together are flushed together
+			for n := len(c.entries); n > 0; n-- {
+				if err := write(<-c.entries); err != nil {
+					return err
+				}
+			}
+			flusher.Flush()
+		case <-heartbeat:
+			if err := enc.heartbeat(); err != nil {
+				return err
+			}
+			flusher.Flush()
+		case <-c.done:
+			// the entries queued before the stream ended are still sent
+			for n := len(c.entries); n > 0; n-- {
+				if err := write(<-c.entries); err != nil {
+					return err
+				}
+			}
+			if c.err != nil {
+				enc.error(c.err)
+			}
+			flusher.Flush()
+			return c.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// health reports the streams and clients, failing if the database is unreachable
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	streams, clients := s.hub.stats()
+	status := map[string]interface{}{"status": "ok", "streams": streams, "clients": clients}
+	code := http.StatusOK
+	if _, err := s.connector.IndexNames(ctx); err != nil {
+		status["status"], status["error"] = "unavailable", err.Error()
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/tail/tailtest"
+	"github.com/pmdcosta/elklogs/pkg/elklogs"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// testConnector exposes the test connector of the tail engine as a library connector
+type testConnector struct {
+	*tailtest.Connector
+	added int
+}
+
+// newTestConnector creates a connector with the messages, as error logs a second apart
+func newTestConnector(t *testing.T, messages ...string) *testConnector {
+	c := &testConnector{Connector: tailtest.New(t)}
+	for _, m := range messages {
+		c.add(m)
+	}
+	return c
+}
+
+func (c *testConnector) IndexNames(ctx context.Context) ([]string, error) {
+	return c.GetIndexNames(ctx)
+}
+
+func (c *testConnector) Search(ctx context.Context, req elklogs.SearchRequest) ([]*elklogs.Entry, error) {
+	logs, err := c.ExecuteQuery(ctx, req.Indices, req.TimestampField, req.Ascending, req.Query, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*elklogs.Entry, 0, len(logs))
+	for _, l := range logs {
+		entries = append(entries, &elklogs.Entry{ID: l.ID, Index: l.Index, Timestamp: l.Timestamp, Source: *l.Message})
+	}
+	return entries, nil
+}
+
+// add appends a newer log
+func (c *testConnector) add(message string) {
+	ts := time.Date(2018, 10, 10, 10, 0, c.added, 0, time.UTC)
+	c.added++
+	c.Add("", ts, map[string]interface{}{"level": "error", "message": message})
+}
+
+func newTestServer(c *testConnector, config Config) (*Server, *httptest.Server) {
+	config.IndexPattern = "logstash-[0-9].*"
+	if config.Entries == 0 {
+		config.Entries = 10
+	}
+	if config.Refresh == 0 {
+		config.Refresh = 5 * time.Millisecond
+	}
+	if config.ClientBuffer == 0 {
+		config.ClientBuffer = 10
+	}
+	s := New(logrus.WithFields(nil), c, config)
+	return s, httptest.NewServer(s.Handler())
+}
+
+// readLines reads the lines of the response until n lines were read
+func readLines(t *testing.T, resp *http.Response, n int) []string {
+	var lines []string
+	r := bufio.NewReader(resp.Body)
+	for len(lines) < n {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read %d lines: %v", len(lines), err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	return lines
+}
+
+func TestServer_ndjson(t *testing.T) {
+	c := newTestConnector(t, "first", "second")
+	defer c.Close()
+	_, ts := newTestServer(c, Config{})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/stream?format=ndjson&output=%25message")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	lines := readLines(t, resp, 2)
+	var ev event
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &ev))
+	assert.Equal(t, "0", ev.ID)
+	assert.Equal(t, "first", ev.Line)
+	assert.JSONEq(t, `{"@timestamp":"2018-10-10T10:00:00Z","level":"error","message":"first"}`, string(ev.Source))
+
+	// new logs are streamed as they are fetched
+	c.add("third")
+	lines = readLines(t, resp, 1)
+	assert.Contains(t, lines[0], `"line":"third"`)
+}
+
+func TestServer_sse(t *testing.T) {
+	c := newTestConnector(t, "first")
+	defer c.Close()
+	_, ts := newTestServer(c, Config{})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/stream?q=level:error")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	lines := readLines(t, resp, 3)
+	assert.Equal(t, "id: 0", lines[0])
+	assert.Equal(t, "event: log", lines[1])
+	assert.True(t, strings.HasPrefix(lines[2], `data: {"id":"0"`))
+}
+
+func TestServer_dedup(t *testing.T) {
+	c := newTestConnector(t, "first")
+	defer c.Close()
+	s, ts := newTestServer(c, Config{History: 10})
+	defer ts.Close()
+
+	var resps []*http.Response
+	for _, q := range []string{"first", "first", "level:error"} {
+		resp, err := http.Get(ts.URL + "/stream?format=ndjson&q=" + q)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		// clients joining a running stream receive its latest entries
+		assert.Len(t, readLines(t, resp, 1), 1)
+		resps = append(resps, resp)
+	}
+
+	streams, clients := s.hub.stats()
+	assert.Equal(t, 2, streams)
+	assert.Equal(t, 3, clients)
+
+	// the streams stop with their last client
+	for _, resp := range resps {
+		resp.Body.Close()
+	}
+	for i := 0; i < 100; i++ {
+		if streams, _ = s.hub.stats(); streams == 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, 0, streams)
+}
+
+func TestServer_badRequest(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	_, ts := newTestServer(c, Config{})
+	defer ts.Close()
+
+	for _, params := range []string{"after=yesterday", "grep=(", "format=xml", "output=plain"} {
+		resp, err := http.Get(ts.URL + "/stream?" + params)
+		assert.Nil(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, params)
+	}
+}
+
+func TestHub_slowClient(t *testing.T) {
+	h := &hub{logger: logrus.WithFields(nil), config: Config{ClientBuffer: 1}, streams: make(map[string]*stream)}
+	s := &stream{key: "q=a", cancel: func() {}, clients: make(map[*client]bool)}
+	h.streams[s.key] = s
+	slow := &client{stream: s, entries: make(chan *elklogs.Entry, 1), done: make(chan struct{})}
+	fast := &client{stream: s, entries: make(chan *elklogs.Entry, 2), done: make(chan struct{})}
+	s.clients[slow], s.clients[fast] = true, true
+
+	// the poller never blocks: the client whose buffer is full is dropped
+	s.broadcast(&elklogs.Entry{ID: "1"})
+	s.broadcast(&elklogs.Entry{ID: "2"})
+	<-slow.done
+	assert.Equal(t, errSlowClient, slow.err)
+	assert.Len(t, fast.entries, 2)
+	assert.Len(t, s.clients, 1)
+
+	h.unsubscribe(fast)
+	assert.Empty(t, h.streams)
+}
+
+func TestServer_health(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	_, ts := newTestServer(c, Config{})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/health")
+	assert.Nil(t, err)
+	var status map[string]interface{}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&status))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok", status["status"])
+
+	c.Fail(-1, errors.New("connection refused"))
+	resp, err = http.Get(ts.URL + "/health")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestStreamQuery_key(t *testing.T) {
+	a, err := ParseStreamQuery(url.Values{"q": {"level:error"}, "after": {"-1h"}, "format": {"sse"}})
+	assert.Nil(t, err)
+	b, err := ParseStreamQuery(url.Values{"after": {"-1h"}, "q": {"level:error"}, "format": {"ndjson"}})
+	assert.Nil(t, err)
+	assert.Equal(t, a.key(), b.key())
+	assert.Equal(t, "after=-1h&q=level%3Aerror", a.key())
+}
@@ -0,0 +1,364 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/pmdcosta/elklogs/pkg/elklogs"
+	"github.com/sirupsen/logrus"
+)
+
+// types of the messages sent by the clients of a websocket session
+const (
+	requestSubscribe = "subscribe" // replace the query, the query field holds the new one
+	requestUpdate    = "update"    // change the fields of the query present in the query field
+	requestPause     = "pause"     // stop sending new entries
+	requestResume    = "resume"    // send the latest entries and keep following
+	requestHistory   = "history"   // send a page of entries older than the oldest one sent
+)
+
+// types of the messages sent to the clients of a websocket session
+const (
+	responseSubscribed = "subscribed" // the query in effect, after subscribe and update
+	responseEntries    = "entries"    // new entries, oldest first
+	responsePaused     = "paused"
+	responseResumed    = "resumed"
+	responseHistory    = "history" // older entries, oldest first, empty when there are none left
+	responseError      = "error"
+)
+
+// request is a message sent by the client
+type request struct {
+	Type  string          `json:"type"`
+	Query json.RawMessage `json:"query,omitempty"`
+}
+
+// response is a message sent to the client
+type response struct {
+	Type    string        `json:"type"`
+	Query   *sessionQuery `json:"query,omitempty"`
+	Entries []*event      `json:"entries,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// sessionQuery is the query of a session along with its page size and line format
+type sessionQuery struct {
+	StreamQuery
+	Entries int    `json:"entries,omitempty"`
+	Output  string `json:"output,omitempty"`
+}
+
+// session follows the query of a single websocket client, which can change it at any time
+type session struct {
+	logger *logrus.Entry
+	config Config
+	conn   *wsConn
+	tail   *tail.Tail
+
+	query     sessionQuery
+	q         *domain.Query
+	indices   []string
+	formatter elklogs.Formatter
+	paused    bool
+	oldest    *domain.LogEntry
+	sent      sentRange
+}
+
+// sentRange is the time range of the entries sent to a session, from the oldest to the newest one.
+// Only the ids at its boundaries are kept, as the entries in between were all sent and the entries
+// fetched again can only share the timestamp of the newest or the oldest one.
+type sentRange struct {
+	oldest    time.Time
+	newest    time.Time
+	oldestIDs map[string]bool
+	newestIDs map[string]bool
+}
+
+// contains checks if the log was sent
+func (r *sentRange) contains(l *domain.LogEntry) bool {
+	switch {
+	case r.oldestIDs == nil || l.Timestamp.Before(r.oldest) || l.Timestamp.After(r.newest):
+		return false
+	case l.Timestamp.Equal(r.oldest):
+		return r.oldestIDs[l.ID]
+	case l.Timestamp.Equal(r.newest):
+		return r.newestIDs[l.ID]
+	}
+	return true
+}
+
+// add extends the range with the log
+func (r *sentRange) add(l *domain.LogEntry) {
+	if r.oldestIDs == nil || l.Timestamp.Before(r.oldest) {
+		r.oldest, r.oldestIDs = l.Timestamp, make(map[string]bool)
+	}
+	if r.newestIDs == nil || l.Timestamp.After(r.newest) {
+		r.newest, r.newestIDs = l.Timestamp, make(map[string]bool)
+	}
+	if l.Timestamp.Equal(r.oldest) {
+		r.oldestIDs[l.ID] = true
+	}
+	if l.Timestamp.Equal(r.newest) {
+		r.newestIDs[l.ID] = true
+	}
+}
+
+// websocket runs a session on the websocket connection of the request
+func (s *Server) websocket(w http.ResponseWriter, r *http.Request) {
+	// browsers send the cookies of the server with the handshakes of any page, so the other origins are rejected
+	if !checkOrigin(r, s.config.AllowedOrigins) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	conn, err := upgrade(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer conn.Close()
+
+	logger := s.logger.WithFields(logrus.Fields{"remote": r.RemoteAddr})
+	logger.Debug("websocket connected")
+	sess := &session{
+		logger: logger,
+		config: s.config,
+		conn:   conn,
+		tail:   tail.New(logger, tailConnector{s.connector}),
+	}
+	err = sess.run(context.Background())
+	logger.WithFields(logrus.Fields{"err": err}).Debug("websocket disconnected")
+}
+
+// run handles the messages of the client and sends the new entries on each refresh,
+// until the client disconnects or a message cannot be sent
+func (s *session) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	messages := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			b, err := s.conn.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case messages <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(s.config.Refresh)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case b := <-messages:
+			err = s.handle(ctx, b)
+		case <-ticker.C:
+			if s.q != nil && !s.paused {
+				err = s.fetch(ctx)
+			}
+		case err := <-errs:
+			return err
+		}
+		if err != nil {
+			if _, ok := err.(sendError); ok {
+				return err
+			}
+			// the other errors are reported, the client can fix its query
+			if err := s.send(response{Type: responseError, Error: err.Error()}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendError is returned when a message could not be sent to the client
+type sendError struct {
+	error
+}
+
+// send writes the message to the client
+func (s *session) send(resp response) error {
+	if err := s.conn.WriteJSON(resp); err != nil {
+		return sendError{err}
+	}
+	return nil
+}
+
+// handle processes a message of the client
+func (s *session) handle(ctx context.Context, b []byte) error {
+	var req request
+	if err := json.Unmarshal(b, &req); err != nil {
+		return fmt.Errorf("invalid message: %s", err)
+	}
+
+	switch req.Type {
+	case requestSubscribe, requestUpdate:
+		// updates only change the fields present in the message
+		q := sessionQuery{}
+		if req.Type == requestUpdate {
+			q = s.query
+		}
+		if len(req.Query) > 0 {
+			if err := json.Unmarshal(req.Query, &q); err != nil {
+				return fmt.Errorf("invalid query: %s", err)
+			}
+		}
+		return s.subscribe(ctx, q)
+	case requestPause:
+		s.paused = true
+		return s.send(response{Type: responsePaused})
+	case requestResume:
+		s.paused = false
+		if err := s.send(response{Type: responseResumed}); err != nil {
+			return err
+		}
+		if s.q == nil {
+			return nil
+		}
+		return s.fetch(ctx)
+	case requestHistory:
+		return s.history(ctx)
+	default:
+		return fmt.Errorf("unknown message type: %s", req.Type)
+	}
+}
+
+// subscribe replaces the query of the session and sends its latest entries
+func (s *session) subscribe(ctx context.Context, query sessionQuery) error {
+	if err := query.validate(); err != nil {
+		return err
+	}
+	if query.Entries <= 0 {
+		query.Entries = s.config.Entries
+	}
+	var formatter elklogs.Formatter
+	if query.Output != "" {
+		var err error
+		if formatter, err = elklogs.TemplateFormatter(query.Output); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	q := &domain.Query{
+		IndexPattern: s.config.IndexPattern,
+		Query:        query.Query,
+		Entries:      query.Entries,
+		Grep:         query.Grep,
+		GrepInvert:   query.GrepInvert,
+		GrepField:    query.GrepField,
+	}
+	q.AfterDateTime, _ = tail.ParseDate(query.After, now)
+	q.BeforeDateTime, _ = tail.ParseDate(query.Before, now)
+	indices, err := s.tail.Indices(ctx, q)
+	if err != nil {
+		return err
+	}
+	if err := s.tail.Reset(q); err != nil {
+		return err
+	}
+
+	s.query, s.q, s.indices, s.formatter = query, q, indices, formatter
+	s.oldest, s.sent = nil, sentRange{}
+	s.logger.WithFields(logrus.Fields{"query": query.key(), "indices": len(indices)}).Debug("session subscribed")
+	if err := s.send(response{Type: responseSubscribed, Query: &s.query}); err != nil {
+		return err
+	}
+	if s.paused {
+		return nil
+	}
+	return s.fetch(ctx)
+}
+
+// fetch sends the entries newer than the ones sent
+func (s *session) fetch(ctx context.Context) error {
+	logs, err := s.tail.Fetch(ctx, s.q, s.indices)
+	if err != nil {
+		return err
+	}
+	events, err := s.events(logs)
+	if err != nil || len(events) == 0 {
+		return err
+	}
+	return s.send(response{Type: responseEntries, Entries: events})
+}
+
+// history sends a page of the entries older than the oldest one sent
+func (s *session) history(ctx context.Context) error {
+	if s.q == nil {
+		return fmt.Errorf("not subscribed")
+	}
+	var events []*event
+	if s.oldest != nil {
+		logs, err := s.tail.Older(ctx, s.q, s.indices, s.oldest)
+		if err != nil {
+			return err
+		}
+		if events, err = s.events(logs); err != nil {
+			return err
+		}
+		if len(logs) > 0 {
+			s.oldest = logs[0]
+		}
+	}
+	return s.send(response{Type: responseHistory, Entries: events})
+}
+
+// events converts the logs not sent yet, oldest first, keeping track of the oldest one
+func (s *session) events(logs []*domain.LogEntry) ([]*event, error) {
+	events := make([]*event, 0, len(logs))
+	for _, l := range logs {
+		if s.sent.contains(l) {
+			continue
+		}
+		s.sent.add(l)
+		if s.oldest == nil {
+			s.oldest = l
+		}
+
+		e := &elklogs.Entry{ID: l.ID, Index: l.Index, Timestamp: l.Timestamp}
+		if l.Message != nil {
+			e.Source = *l.Message
+		}
+		ev, err := newEvent(e, s.formatter)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// tailConnector adapts the library connector to the tail engine
+type tailConnector struct {
+	elklogs.Connector
+}
+
+func (c tailConnector) GetIndexNames(ctx context.Context) ([]string, error) {
+	return c.IndexNames(ctx)
+}
+
+func (c tailConnector) ExecuteQuery(ctx context.Context, indices []string, timestampField string, order bool, query string, entries int) ([]*domain.LogEntry, error) {
+	result, err := c.Search(ctx, elklogs.SearchRequest{Indices: indices, TimestampField: timestampField, Ascending: order, Query: query, Size: entries})
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]*domain.LogEntry, 0, len(result))
+	for _, e := range result {
+		source := json.RawMessage(e.Source)
+		logs = append(logs, &domain.LogEntry{ID: e.ID, Index: e.Index, Timestamp: e.Timestamp, Message: &source})
+	}
+	return logs, nil
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+// dialWebsocket opens a websocket session on the test server
+func dialWebsocket(t *testing.T, serverURL string) *wsConn {
+	c, resp := handshake(t, serverURL, "")
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	return c
+}
+
+// handshake sends a websocket handshake to the test server from the origin, if not empty
+func handshake(t *testing.T, serverURL string, origin string) (*wsConn, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, serverURL+"/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	resp, err := http.ReadResponse(rw.Reader, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wsConn{conn: conn, rw: rw, masked: true}, resp
+}
+
+// receive reads the next message sent by the server
+func receive(t *testing.T, c *wsConn) response {
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	b, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp response
+	assert.Nil(t, json.Unmarshal(b, &resp))
+	return resp
+}
+
+// eventIDs returns the ids of the events
+func eventIDs(events []*event) []string {
+	ids := make([]string, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestSession_protocol(t *testing.T) {
+	c := newTestConnector(t, "a", "b", "c")
+	defer c.Close()
+	_, ts := newTestServer(c, Config{Refresh: 10 * time.Millisecond})
+	defer ts.Close()
+	ws := dialWebsocket(t, ts.URL)
+	defer ws.Close()
+
+	assert.Nil(t, ws.WriteJSON(map[string]interface{}{"type": "subscribe", "query": map[string]interface{}{"q": "level:error", "entries": 2, "output": "%message"}}))
+	resp := receive(t, ws)
+	assert.Equal(t, responseSubscribed, resp.Type)
+	assert.Equal(t, "level:error", resp.Query.Query)
+	resp = receive(t, ws)
+	assert.Equal(t, responseEntries, resp.Type)
+	assert.Equal(t, []string{"1", "2"}, eventIDs(resp.Entries))
+	assert.Equal(t, "c", resp.Entries[1].Line)
+
+	// new logs are sent on refresh
+	c.add("d")
+	resp = receive(t, ws)
+	assert.Equal(t, []string{"3"}, eventIDs(resp.Entries))
+
+	// updates keep the fields missing from the message
+	assert.Nil(t, ws.WriteJSON(map[string]interface{}{"type": "update", "query": map[string]interface{}{"grep": "d", "grep_field": "message"}}))
+	resp = receive(t, ws)
+	assert.Equal(t, responseSubscribed, resp.Type)
+	assert.Equal(t, "level:error", resp.Query.Query)
+	assert.Equal(t, "d", resp.Query.Grep)
+	assert.Equal(t, 2, resp.Query.Entries)
+	resp = receive(t, ws)
+	assert.Equal(t, []string{"3"}, eventIDs(resp.Entries))
+
+	// no entries are sent while paused
+	assert.Nil(t, ws.WriteJSON(map[string]string{"type": "pause"}))
+	assert.Equal(t, responsePaused, receive(t, ws).Type)
+	c.add("dd")
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, ws.WriteJSON(map[string]string{"type": "resume"}))
+	assert.Equal(t, responseResumed, receive(t, ws).Type)
+	assert.Equal(t, []string{"4"}, eventIDs(receive(t, ws).Entries))
+}
+
+func TestSession_history(t *testing.T) {
+	c := newTestConnector(t, "a", "b", "c", "d", "e")
+	defer c.Close()
+	_, ts := newTestServer(c, Config{})
+	defer ts.Close()
+	ws := dialWebsocket(t, ts.URL)
+	defer ws.Close()
+
+	// history is an error before subscribing
+	assert.Nil(t, ws.WriteJSON(map[string]string{"type": "history"}))
+	assert.Equal(t, responseError, receive(t, ws).Type)
+
+	assert.Nil(t, ws.WriteJSON(map[string]interface{}{"type": "subscribe", "query": map[string]int{"entries": 2}}))
+	assert.Equal(t, responseSubscribed, receive(t, ws).Type)
+	assert.Equal(t, []string{"3", "4"}, eventIDs(receive(t, ws).Entries))
+
+	for _, page := range [][]string{{"2"}, {"1"}, {"0"}, {}} {
+		assert.Nil(t, ws.WriteJSON(map[string]string{"type": "history"}))
+		resp := receive(t, ws)
+		assert.Equal(t, responseHistory, resp.Type)
+		assert.Equal(t, page, eventIDs(resp.Entries))
+	}
+}
+
+func TestSession_invalidMessages(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	_, ts := newTestServer(c, Config{})
+	defer ts.Close()
+	ws := dialWebsocket(t, ts.URL)
+	defer ws.Close()
+
+	for _, m := range []string{`not json`, `{"type":"unknown"}`, `{"type":"subscribe","query":{"grep":"("}}`} {
+		assert.Nil(t, ws.writeFrame(opText, []byte(m)))
+		resp := receive(t, ws)
+		assert.Equal(t, responseError, resp.Type, m)
+		assert.NotEmpty(t, resp.Error)
+	}
+}
+
+func TestWebsocket_frames(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 70000} {
+		payload := bytes.Repeat([]byte("x"), size)
+		var buf bytes.Buffer
+		assert.Nil(t, writeFrame(&buf, opText, payload, true))
+		fin, op, got, err := readFrame(&buf)
+		assert.Nil(t, err)
+		assert.True(t, fin)
+		assert.Equal(t, byte(opText), op)
+		assert.Equal(t, payload, got)
+	}
+}
+
+func TestWebsocket_notUpgrade(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	_, ts := newTestServer(c, Config{})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/ws")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestWebsocket_origin(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	_, ts := newTestServer(c, Config{AllowedOrigins: []string{"https://logs.example.com"}})
+	defer ts.Close()
+
+	for origin, status := range map[string]int{
+		"":                         http.StatusSwitchingProtocols,
+		ts.URL:                     http.StatusSwitchingProtocols,
+		"https://logs.example.com": http.StatusSwitchingProtocols,
+		"https://evil.example.com": http.StatusForbidden,
+	} {
+		c, resp := handshake(t, ts.URL, origin)
+		assert.Equal(t, status, resp.StatusCode, origin)
+		c.Close()
+	}
+}
+
+func TestSentRange(t *testing.T) {
+	ts := time.Date(2018, 10, 10, 10, 0, 0, 0, time.UTC)
+	log := func(id string, seconds int) *domain.LogEntry {
+		return &domain.LogEntry{ID: id, Timestamp: ts.Add(time.Duration(seconds) * time.Second)}
+	}
+
+	var r sentRange
+	assert.False(t, r.contains(log("a", 0)))
+	for _, l := range []*domain.LogEntry{log("a", 0), log("b", 1), log("c", 2), log("d", 2)} {
+		r.add(l)
+	}
+	assert.True(t, r.contains(log("a", 0)))
+	assert.True(t, r.contains(log("b", 1)))
+	assert.True(t, r.contains(log("d", 2)))
+	assert.False(t, r.contains(log("e", 2)))
+	assert.False(t, r.contains(log("f", 0)))
+	assert.False(t, r.contains(log("g", 3)))
+
+	// only the ids at the boundaries are kept
+	r.add(log("g", 3))
+	r.add(log("h", -1))
+	assert.Equal(t, map[string]bool{"g": true}, r.newestIDs)
+	assert.Equal(t, map[string]bool{"h": true}, r.oldestIDs)
+	assert.True(t, r.contains(log("d", 2)))
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/pmdcosta/elklogs/pkg/elklogs"
+	"github.com/sirupsen/logrus"
+)
+
+// errSlowClient is sent to the clients disconnected because their buffer is full
+var errSlowClient = errors.New("client too slow, entries were dropped")
+
+// StreamQuery selects the logs of a stream. Clients with equal queries share the same upstream poller.
+type StreamQuery struct {
+	Query      string `json:"q,omitempty"`     // elasticsearch query string
+	After      string `json:"after,omitempty"` // date or negative duration, resolved when the poller starts
+	Before     string `json:"before,omitempty"`
+	Grep       string `json:"grep,omitempty"`
+	GrepInvert string `json:"grep_v,omitempty"`
+	GrepField  string `json:"grep_field,omitempty"`
+}
+
+// ParseStreamQuery reads the query from the url parameters q, after, before, grep, grep-v and grep-field
+func ParseStreamQuery(values url.Values) (StreamQuery, error) {
+	q := StreamQuery{
+		Query:      values.Get("q"),
+		After:      values.Get("after"),
+		Before:     values.Get("before"),
+		Grep:       values.Get("grep"),
+		GrepInvert: values.Get("grep-v"),
+		GrepField:  values.Get("grep-field"),
+	}
+	return q, q.validate()
+}
+
+// validate checks the dates and expressions of the query, so errors are reported before streaming
+func (q StreamQuery) validate() error {
+	for _, d := range []string{q.After, q.Before} {
+		if _, err := tail.ParseDate(d, time.Now()); err != nil {
+			return err
+		}
+	}
+	for _, expr := range []string{q.Grep, q.GrepInvert} {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid grep expression: %s", expr)
+		}
+	}
+	return nil
+}
+
+// key identifies the upstream poller of the query
+func (q StreamQuery) key() string {
+	values := url.Values{}
+	for k, v := range map[string]string{"q": q.Query, "after": q.After, "before": q.Before, "grep": q.Grep, "grep-v": q.GrepInvert, "grep-field": q.GrepField} {
+		if v != "" {
+			values.Set(k, v)
+		}
+	}
+	return values.Encode()
+}
+
+// build returns the library query, resolving the relative dates
+func (q StreamQuery) build(config Config, now time.Time) *elklogs.Query {
+	query := elklogs.NewQuery(q.Query).
+		IndexPattern(config.IndexPattern).
+		Limit(config.Entries).
+		Follow(config.Refresh).
+		Grep(q.Grep).
+		GrepInvert(q.GrepInvert).
+		GrepField(q.GrepField)
+	if after, _ := tail.ParseDate(q.After, now); after != nil {
+		query = query.After(*after)
+	}
+	if before, _ := tail.ParseDate(q.Before, now); before != nil {
+		query = query.Before(*before)
+	}
+	return query
+}
+
+// client receives the entries of a stream through a bounded buffer
+type client struct {
+	stream  *stream
+	entries chan *elklogs.Entry
+	done    chan struct{} // closed when the stream ends or drops the client
+	err     error         // reason the client was dropped, set before done is closed
+}
+
+// stream polls the logs of a query once for all its clients
+type stream struct {
+	key    string
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	clients map[*client]bool
+	history []*elklogs.Entry // latest entries, replayed to new clients
+	limit   int
+}
+
+// hub runs a stream per distinct query while it has clients
+type hub struct {
+	logger *logrus.Entry
+	client *elklogs.Client
+	config Config
+
+	mu      sync.Mutex
+	streams map[string]*stream
+}
+
+// subscribe adds a client to the stream of the query, starting the stream if needed.
+// The latest entries of a running stream are queued first.
+func (h *hub) subscribe(q StreamQuery) *client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := q.key()
+	s, ok := h.streams[key]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		s = &stream{key: key, cancel: cancel, clients: make(map[*client]bool), limit: h.config.History}
+		h.streams[key] = s
+		go h.run(ctx, s, q.build(h.config, time.Now()))
+		h.logger.WithFields(logrus.Fields{"stream": key}).Debug("stream started")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &client{
+		stream:  s,
+		entries: make(chan *elklogs.Entry, h.config.ClientBuffer+len(s.history)),
+		done:    make(chan struct{}),
+	}
+	for _, e := range s.history {
+		c.entries <- e
+	}
+	s.clients[c] = true
+	h.logger.WithFields(logrus.Fields{"stream": key, "clients": len(s.clients)}).Debug("client subscribed")
+	return c
+}
+
+// unsubscribe removes the client from its stream, stopping the stream after its last client
+func (h *hub) unsubscribe(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := c.stream
+	s.mu.Lock()
+	delete(s.clients, c)
+	empty := len(s.clients) == 0
+	s.mu.Unlock()
+
+	if empty && h.streams[s.key] == s {
+		delete(h.streams, s.key)
+		s.cancel()
+		h.logger.WithFields(logrus.Fields{"stream": s.key}).Debug("stream stopped")
+	}
+}
+
+// run sends the entries of the query to the clients of the stream until it is cancelled or fails
+func (h *hub) run(ctx context.Context, s *stream, q *elklogs.Query) {
+	entries, errs := h.client.Stream(ctx, q)
+	for e := range entries {
+		s.broadcast(e)
+	}
+	err := <-errs
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{"stream": s.key, "err": err}).Warn("stream failed")
+	} else if ctx.Err() == nil {
+		err = errors.New("stream ended")
+	}
+
+	// a failed stream is forgotten so the next clients start a new one
+	h.mu.Lock()
+	if h.streams[s.key] == s {
+		delete(h.streams, s.key)
+	}
+	h.mu.Unlock()
+	s.close(err)
+}
+
+// broadcast queues the entry for every client without blocking, dropping the clients whose buffer is full
+func (s *stream) broadcast(e *elklogs.Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history = append(s.history, e)
+	if len(s.history) > s.limit {
+		s.history = s.history[len(s.history)-s.limit:]
+	}
+	for c := range s.clients {
+		select {
+		case c.entries <- e:
+		default:
+			delete(s.clients, c)
+			c.err = errSlowClient
+			close(c.done)
+		}
+	}
+}
+
+// close ends the stream for all its clients
+func (s *stream) close(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		delete(s.clients, c)
+		c.err = err
+		close(c.done)
+	}
+}
+
+// stats returns the number of streams and clients
+func (h *hub) stats() (int, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clients := 0
+	for _, s := range h.streams {
+		s.mu.Lock()
+		clients += len(s.clients)
+		s.mu.Unlock()
+	}
+	return len(h.streams), clients
+}
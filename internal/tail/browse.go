@@ -0,0 +1,98 @@
+package tail
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+)
+
+// Reset prepares the tail to fetch the logs of a new query, forgetting the logs already fetched
+func (t *Tail) Reset(query *domain.Query) error {
+	grep, err := newGrepFilter(query)
+	if err != nil {
+		return err
+	}
+	t.grep = grep
+	t.formatter = t.formatOption
+	if t.formatter == nil {
+		t.formatter = NewFormatter(query.ShowTime, query.Format, query.FormatFields)
+	}
+	t.lastID = ""
+	return nil
+}
+
+// Fetch retrieves the logs newer than the ones already fetched, oldest first
+func (t *Tail) Fetch(ctx context.Context, query *domain.Query, indices []string) ([]*domain.LogEntry, error) {
+	logs, err := t.connector.ExecuteQuery(ctx, indices, timestampField, false, rangeQuery(query), query.Entries)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not fetch logs")
+	}
+	entries, err := t.processLogs(logs)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not process logs")
+	}
+	t.logger.WithFields(logrus.Fields{"indices": indices, "logs": len(entries)}).Debug("new logs fetched")
+
+	result := make([]*domain.LogEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		result = append(result, logEntry(entries[i]))
+	}
+	return result, nil
+}
+
+// Older retrieves a page of logs older than the log, oldest first.
+// Logs sharing the timestamp of the log are included, so they must be deduplicated by the caller.
+func (t *Tail) Older(ctx context.Context, query *domain.Query, indices []string, log *domain.LogEntry) ([]*domain.LogEntry, error) {
+	q := fmt.Sprintf(`%s:[* TO "%s"]`, timestampField, log.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+	if r := rangeQuery(query); r != "" {
+		q = fmt.Sprintf("(%s) AND %s", r, q)
+	}
+	logs, err := t.connector.ExecuteQuery(ctx, indices, timestampField, false, q, query.Entries)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not fetch older logs")
+	}
+
+	kept := make([]*domain.LogEntry, 0, len(logs))
+	for _, l := range logs {
+		_, ok, err := t.processLog(l)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not process logs")
+		}
+		if ok && l.ID != log.ID {
+			kept = append(kept, l)
+		}
+	}
+	t.logger.WithFields(logrus.Fields{"before": log.ID, "logs": len(kept)}).Debug("older logs fetched")
+	return reverseLogs(kept), nil
+}
+
+// rangeQuery restricts the query string to the time range of the query
+func rangeQuery(query *domain.Query) string {
+	if query.AfterDateTime == nil && query.BeforeDateTime == nil {
+		return query.Query
+	}
+	start, end := "*", "*"
+	if query.AfterDateTime != nil {
+		start = fmt.Sprintf(`"%s"`, query.AfterDateTime.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+	}
+	if query.BeforeDateTime != nil {
+		end = fmt.Sprintf(`"%s"`, query.BeforeDateTime.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+	}
+	r := fmt.Sprintf("%s:[%s TO %s]", timestampField, start, end)
+	if query.Query == "" {
+		return r
+	}
+	return fmt.Sprintf("(%s) AND %s", query.Query, r)
+}
+
+// reverseLogs returns the logs in the opposite order
+func reverseLogs(logs []*domain.LogEntry) []*domain.LogEntry {
+	result := make([]*domain.LogEntry, 0, len(logs))
+	for i := len(logs) - 1; i >= 0; i-- {
+		result = append(result, logs[i])
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package tail
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTail_Fetch(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	tl := New(logrus.WithFields(nil), c)
+	q := &domain.Query{Entries: 10}
+	assert.Nil(t, tl.Reset(q))
+
+	logs, err := tl.Fetch(context.Background(), q, []string{"logstash-2018.10.11"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c"}, ids(logs))
+
+	// only the new logs are returned on the next fetch
+	c.add("f", "2018-10-11T11:00")
+	logs, err = tl.Fetch(context.Background(), q, []string{"logstash-2018.10.11"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"f"}, ids(logs))
+}
+
+func TestTail_Older(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	tl := New(logrus.WithFields(nil), c)
+	q := &domain.Query{Entries: 10, Query: "NOT message:a2", Grep: "message [af]"}
+	assert.Nil(t, tl.Reset(q))
+
+	// the logs up to the given one are returned oldest first, without it, matching the query and grep
+	c.add("f", "2018-10-11T09:00")
+	c.add("x", "2018-10-11T08:30")
+	c.add("a2", "2018-10-11T08:40")
+	c.add("g", "2018-10-11T11:00")
+	logs, err := tl.Older(context.Background(), q, []string{"logstash-2018.10.11"}, entry("c", "logstash-2018.10.11", "2018-10-11T10:00"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "f"}, ids(logs))
+}
+
+func TestRangeQuery(t *testing.T) {
+	after := time.Date(2018, 10, 10, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, "level:error", rangeQuery(&domain.Query{Query: "level:error"}))
+	assert.Equal(t, `@timestamp:["2018-10-10T12:00:00.000Z" TO *]`, rangeQuery(&domain.Query{AfterDateTime: &after}))
+	assert.Equal(t, `(level:error) AND @timestamp:[* TO "2018-10-10T12:00:00.000Z"]`, rangeQuery(&domain.Query{Query: "level:error", BeforeDateTime: &after}))
+}
+
+func ids(logs []*domain.LogEntry) []string {
+	result := make([]string, 0, len(logs))
+	for _, l := range logs {
+		result = append(result, l.ID)
+	}
+	return result
+}
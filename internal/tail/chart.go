@@ -0,0 +1,115 @@
+package tail
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+)
+
+// characters used to draw the charts
+var (
+	sparkChars  = []rune("▁▂▃▄▅▆▇█")
+	seriesChars = []rune("█▓▒░▚▞")
+)
+
+// otherSeries names the logs that do not belong to any of the split series
+const otherSeries = "other"
+
+// Sparkline draws the bucket counts as a line of bars scaled to the largest bucket
+func Sparkline(buckets []*domain.Bucket) string {
+	max := maxCount(buckets)
+	line := make([]rune, 0, len(buckets))
+	for _, b := range buckets {
+		i := 0
+		if max > 0 {
+			i = int(b.Count * int64(len(sparkChars)-1) / max)
+		}
+		line = append(line, sparkChars[i])
+	}
+	return string(line)
+}
+
+// SeriesNames returns the names of the split series of the buckets, sorted by total count
+func SeriesNames(buckets []*domain.Bucket) []string {
+	totals := make(map[string]int64)
+	for _, b := range buckets {
+		for name, c := range b.Series {
+			totals[name] += c
+		}
+	}
+	names := make([]string, 0, len(totals))
+	for name := range totals {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if totals[names[i]] == totals[names[j]] {
+			return names[i] < names[j]
+		}
+		return totals[names[i]] > totals[names[j]]
+	})
+	return names
+}
+
+// BarChart draws a horizontal bar per bucket scaled to the width, stacking the split series of the buckets.
+// A legend line is appended when there are split series.
+func BarChart(buckets []*domain.Bucket, width int) []string {
+	max := maxCount(buckets)
+	series := SeriesNames(buckets)
+	if len(series) > len(seriesChars)-1 {
+		series = series[:len(seriesChars)-1]
+	}
+
+	// leave room for the time and count labels
+	labelWidth := len(fmt.Sprintf("%d", max))
+	barWidth := width - len("2006-01-02T15:04:05") - labelWidth - 3
+	if barWidth < 10 {
+		barWidth = 10
+	}
+
+	lines := make([]string, 0, len(buckets)+1)
+	for _, b := range buckets {
+		var bar strings.Builder
+		var drawn int64
+		for i, name := range series {
+			drawn += b.Series[name]
+			bar.WriteString(strings.Repeat(string(seriesChars[i]), scale(drawn, max, barWidth)-len([]rune(bar.String()))))
+		}
+		if len(series) > 0 {
+			bar.WriteString(strings.Repeat(string(seriesChars[len(series)]), scale(b.Count, max, barWidth)-len([]rune(bar.String()))))
+		} else {
+			bar.WriteString(strings.Repeat(string(seriesChars[0]), scale(b.Count, max, barWidth)))
+		}
+		lines = append(lines, fmt.Sprintf("%s %*d %s", b.Time.Format("2006-01-02T15:04:05"), labelWidth, b.Count, bar.String()))
+	}
+
+	if len(series) > 0 {
+		legend := make([]string, 0, len(series)+1)
+		for i, name := range series {
+			legend = append(legend, fmt.Sprintf("%c %s", seriesChars[i], name))
+		}
+		legend = append(legend, fmt.Sprintf("%c %s", seriesChars[len(series)], otherSeries))
+		lines = append(lines, strings.Join(legend, "  "))
+	}
+	return lines
+}
+
+// scale scales the count to the width, relative to the max count
+func scale(count int64, max int64, width int) int {
+	if max == 0 {
+		return 0
+	}
+	return int(count * int64(width) / max)
+}
+
+// maxCount returns the largest bucket count
+func maxCount(buckets []*domain.Bucket) int64 {
+	var max int64
+	for _, b := range buckets {
+		if b.Count > max {
+			max = b.Count
+		}
+	}
+	return max
+}
@@ -0,0 +1,48 @@
+package tail_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBuckets() []*domain.Bucket {
+	start, _ := time.Parse("2006-01-02T15:04", "2018-11-28T10:00")
+	return []*domain.Bucket{
+		{Time: start, Count: 0},
+		{Time: start.Add(time.Minute), Count: 4, Series: map[string]int64{"a": 2, "b": 1}},
+		{Time: start.Add(2 * time.Minute), Count: 8, Series: map[string]int64{"a": 4, "b": 4}},
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	assert.Equal(t, "▁▄█", tail.Sparkline(newBuckets()))
+	assert.Equal(t, "▁", tail.Sparkline([]*domain.Bucket{{Count: 0}}))
+}
+
+func TestSeriesNames(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, tail.SeriesNames(newBuckets()))
+}
+
+func TestBarChart(t *testing.T) {
+	r := tail.BarChart(newBuckets(), 41)
+	assert.Equal(t, []string{
+		"2018-11-28T10:00:00 0 ",
+		"2018-11-28T10:01:00 4 ████▓▓▒▒▒",
+		"2018-11-28T10:02:00 8 █████████▓▓▓▓▓▓▓▓▓",
+		"█ a  ▓ b  ▒ other",
+	}, r)
+}
+
+func TestBarChart_noSeries(t *testing.T) {
+	buckets := newBuckets()
+	for _, b := range buckets {
+		b.Series = nil
+	}
+	r := tail.BarChart(buckets, 41)
+	assert.Equal(t, "2018-11-28T10:02:00 8 ██████████████████", r[2])
+	assert.Len(t, r, 3)
+}
@@ -0,0 +1,52 @@
+package tail
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ParseDate parses a time filter, returning nil if it is not set.
+// Besides dates, "now" and negative durations relative to now (such as -1h) are accepted.
+func ParseDate(value string, now time.Time) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	if value == "now" {
+		return &now, nil
+	}
+	if strings.HasPrefix(value, "-") {
+		if d, err := time.ParseDuration(value); err == nil {
+			t := now.Add(d)
+			return &t, nil
+		}
+	}
+	d, err := time.Parse("2006-01-02T15:04", value)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("invalid date: %s", value))
+	}
+	return &d, nil
+}
+
+// ParseRange parses a time range in the form start..end, where either side can be empty
+func ParseRange(value string, now time.Time) (*time.Time, *time.Time, error) {
+	parts := strings.SplitN(value, "..", 2)
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("invalid time range, expected start..end: %s", value)
+	}
+	start, err := ParseDate(parts[0], now)
+	if err != nil {
+		return nil, nil, err
+	}
+	end, err := ParseDate(parts[1], now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if start != nil && end != nil && end.Before(*start) {
+		return nil, nil, fmt.Errorf("invalid time range, end is before start: %s", value)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,47 @@
+package tail_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2018, 10, 10, 12, 0, 0, 0, time.UTC)
+
+	r, err := tail.ParseDate("", now)
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+
+	r, err = tail.ParseDate("-90m", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "2018-10-10T10:30:00Z", r.Format(time.RFC3339))
+
+	r, err = tail.ParseDate("2018-10-09T08:00", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "2018-10-09T08:00:00Z", r.Format(time.RFC3339))
+
+	_, err = tail.ParseDate("yesterday", now)
+	assert.NotNil(t, err)
+}
+
+func TestParseRange(t *testing.T) {
+	now := time.Date(2018, 10, 10, 12, 0, 0, 0, time.UTC)
+
+	start, end, err := tail.ParseRange("-1h..-30m", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "2018-10-10T11:00:00Z", start.Format(time.RFC3339))
+	assert.Equal(t, "2018-10-10T11:30:00Z", end.Format(time.RFC3339))
+
+	start, end, err = tail.ParseRange("-30m..", now)
+	assert.Nil(t, err)
+	assert.Equal(t, "2018-10-10T11:30:00Z", start.Format(time.RFC3339))
+	assert.Nil(t, end)
+
+	_, _, err = tail.ParseRange("-30m..-1h", now)
+	assert.NotNil(t, err)
+	_, _, err = tail.ParseRange("-30m", now)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,70 @@
+package tail
+
+import (
+	"math"
+	"sort"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+)
+
+// TermChange compares the number of logs with a value of a field between two time windows
+type TermChange struct {
+	Value         string  `json:"value"`
+	Baseline      int64   `json:"baseline"`
+	Current       int64   `json:"current"`
+	BaselineShare float64 `json:"baseline_share"` // percentage of the logs of the window
+	CurrentShare  float64 `json:"current_share"`
+}
+
+// Shift returns the change of the share of the value, in percentage points
+func (c *TermChange) Shift() float64 {
+	return c.CurrentShare - c.BaselineShare
+}
+
+// Change returns the relative change of the number of logs as a percentage, reporting false if the value
+// is new in the current window
+func Change(baseline int64, current int64) (float64, bool) {
+	if baseline == 0 {
+		return 0, current == 0
+	}
+	return float64(current-baseline) * 100 / float64(baseline), true
+}
+
+// CompareTerms compares the values of a field between the baseline and the current windows,
+// sorted by the largest shift in share first
+func CompareTerms(baseline []*domain.Term, baselineTotal int64, current []*domain.Term, currentTotal int64) []*TermChange {
+	byValue := make(map[string]*TermChange)
+	var changes []*TermChange
+	get := func(value string) *TermChange {
+		c, ok := byValue[value]
+		if !ok {
+			c = &TermChange{Value: value}
+			byValue[value] = c
+			changes = append(changes, c)
+		}
+		return c
+	}
+	for _, t := range baseline {
+		get(t.Value).Baseline = t.Count
+	}
+	for _, t := range current {
+		get(t.Value).Current = t.Count
+	}
+
+	for _, c := range changes {
+		c.BaselineShare = share(c.Baseline, baselineTotal)
+		c.CurrentShare = share(c.Current, currentTotal)
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return math.Abs(changes[i].Shift()) > math.Abs(changes[j].Shift())
+	})
+	return changes
+}
+
+// share returns the percentage of the count in the total
+func share(count int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) * 100 / float64(total)
+}
@@ -0,0 +1,36 @@
+package tail_test
+
+import (
+	"testing"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareTerms(t *testing.T) {
+	baseline := []*domain.Term{{Value: "web-1", Count: 50}, {Value: "web-2", Count: 40}, {Value: "web-3", Count: 10}}
+	current := []*domain.Term{{Value: "web-1", Count: 100}, {Value: "web-4", Count: 80}, {Value: "web-2", Count: 20}}
+
+	r := tail.CompareTerms(baseline, 100, current, 200)
+	assert.Equal(t, []*tail.TermChange{
+		{Value: "web-4", Baseline: 0, Current: 80, BaselineShare: 0, CurrentShare: 40},
+		{Value: "web-2", Baseline: 40, Current: 20, BaselineShare: 40, CurrentShare: 10},
+		{Value: "web-3", Baseline: 10, Current: 0, BaselineShare: 10, CurrentShare: 0},
+		{Value: "web-1", Baseline: 50, Current: 100, BaselineShare: 50, CurrentShare: 50},
+	}, r)
+	assert.Equal(t, -30.0, r[1].Shift())
+}
+
+func TestChange(t *testing.T) {
+	c, ok := tail.Change(100, 150)
+	assert.True(t, ok)
+	assert.Equal(t, 50.0, c)
+
+	_, ok = tail.Change(0, 10)
+	assert.False(t, ok)
+
+	c, ok = tail.Change(0, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 0.0, c)
+}
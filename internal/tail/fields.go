@@ -0,0 +1,79 @@
+package tail
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+)
+
+// FieldInfo describes a field across the mappings of several indices
+type FieldInfo struct {
+	Name       string
+	Types      map[string][]string // indices mapping the field, by type
+	MultiField bool
+	Populated  int // number of sampled logs holding a value for the field
+}
+
+// Conflict checks if the field is mapped with different types across indices
+func (f *FieldInfo) Conflict() bool {
+	return len(f.Types) > 1
+}
+
+// TypeNames returns the sorted types of the field
+func (f *FieldInfo) TypeNames() []string {
+	types := make([]string, 0, len(f.Types))
+	for t := range f.Types {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// MergeFields merges the fields of the index mappings, sorted by name
+func MergeFields(mappings map[string][]*domain.Field) []*FieldInfo {
+	byName := make(map[string]*FieldInfo)
+	for index, fields := range mappings {
+		for _, f := range fields {
+			info, ok := byName[f.Name]
+			if !ok {
+				info = &FieldInfo{Name: f.Name, Types: make(map[string][]string), MultiField: f.MultiField}
+				byName[f.Name] = info
+			}
+			info.Types[f.Type] = append(info.Types[f.Type], index)
+		}
+	}
+
+	result := make([]*FieldInfo, 0, len(byName))
+	for _, info := range byName {
+		for _, indices := range info.Types {
+			sort.Strings(indices)
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// SampleFields counts how many of the logs hold a value for each field.
+// Multi fields are populated whenever their parent field is.
+func SampleFields(fields []*FieldInfo, logs []*domain.LogEntry) error {
+	for _, log := range logs {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(*log.Message, &entry); err != nil {
+			return err
+		}
+
+		for _, f := range fields {
+			path := f.Name
+			if f.MultiField {
+				path = path[:strings.LastIndex(path, ".")]
+			}
+			if _, err := evaluateExpression(entry, path); err == nil {
+				f.Populated++
+			}
+		}
+	}
+	return nil
+}
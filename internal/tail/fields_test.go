@@ -0,0 +1,45 @@
+package tail_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeFields(t *testing.T) {
+	mappings := map[string][]*domain.Field{
+		"logstash-2018.11.28": {{Name: "message", Type: "text"}, {Name: "message.keyword", Type: "keyword", MultiField: true}},
+		"logstash-2018.11.29": {{Name: "message", Type: "keyword"}},
+		"logstash-2018.11.30": {{Name: "message", Type: "keyword"}},
+	}
+
+	r := tail.MergeFields(mappings)
+	assert.Len(t, r, 2)
+	assert.Equal(t, "message", r[0].Name)
+	assert.True(t, r[0].Conflict())
+	assert.Equal(t, []string{"keyword", "text"}, r[0].TypeNames())
+	assert.Equal(t, []string{"logstash-2018.11.29", "logstash-2018.11.30"}, r[0].Types["keyword"])
+	assert.Equal(t, "message.keyword", r[1].Name)
+	assert.False(t, r[1].Conflict())
+}
+
+func TestSampleFields(t *testing.T) {
+	a := json.RawMessage(`{"message":"test","kubernetes":{"pod":{"name":"pod-1"}}}`)
+	b := json.RawMessage(`{"message":"test2"}`)
+	logs := []*domain.LogEntry{{ID: "a", Message: &a}, {ID: "b", Message: &b}}
+
+	fields := []*tail.FieldInfo{
+		{Name: "kubernetes.pod.name"},
+		{Name: "message"},
+		{Name: "message.keyword", MultiField: true},
+		{Name: "missing"},
+	}
+	assert.Nil(t, tail.SampleFields(fields, logs))
+	assert.Equal(t, 1, fields[0].Populated)
+	assert.Equal(t, 2, fields[1].Populated)
+	assert.Equal(t, 2, fields[2].Populated)
+	assert.Equal(t, 0, fields[3].Populated)
+}
@@ -0,0 +1,59 @@
+package tail
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/pmdcosta/elklogs/internal/domain"
+)
+
+// grepFilter filters the processed log lines on the client side
+type grepFilter struct {
+	match  *regexp.Regexp
+	invert *regexp.Regexp
+	field  string
+
+	filtered int // number of logs dropped by the filter
+}
+
+// newGrepFilter compiles the grep expressions of the query
+func newGrepFilter(query *domain.Query) (*grepFilter, error) {
+	g := &grepFilter{field: query.GrepField}
+
+	var err error
+	if query.Grep != "" {
+		if g.match, err = regexp.Compile(query.Grep); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid grep expression: %s", query.Grep))
+		}
+	}
+	if query.GrepInvert != "" {
+		if g.invert, err = regexp.Compile(query.GrepInvert); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid grep expression: %s", query.GrepInvert))
+		}
+	}
+	return g, nil
+}
+
+// Keep checks if the entry passes the filter, recording the matches of its line.
+// The expressions are evaluated on the grep field of the log when set, and on the line otherwise.
+func (g *grepFilter) Keep(e *domain.Entry) (bool, error) {
+	if g.match == nil && g.invert == nil {
+		return true, nil
+	}
+
+	value := e.Line
+	if g.field != "" {
+		// a missing field never matches
+		value, _ = evaluateExpression(e.Source, g.field)
+	}
+
+	if (g.match != nil && !g.match.MatchString(value)) || (g.invert != nil && g.invert.MatchString(value)) {
+		g.filtered++
+		return false, nil
+	}
+	if g.match != nil && g.field == "" {
+		e.Matches = g.match.FindAllStringIndex(e.Line, -1)
+	}
+	return true, nil
+}
@@ -0,0 +1,77 @@
+package tail
+
+import (
+	"testing"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// renderedEntry decodes the log with the line it was rendered to
+func renderedEntry(log *domain.LogEntry, line string) *domain.Entry {
+	e, _ := NewEntry(log)
+	e.Line = line
+	return e
+}
+
+func TestGrepFilter_keep(t *testing.T) {
+	g, err := newGrepFilter(&domain.Query{Grep: "message [a-c]", GrepInvert: "b$"})
+	assert.Nil(t, err)
+
+	for _, log := range []*domain.LogEntry{entry("c", "logstash-2018.10.11", "2018-10-11T10:00"), entry("a", "logstash-2018.10.11", "2018-10-11T08:00")} {
+		ok, err := g.Keep(renderedEntry(log, "message "+log.ID))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	ok, err := g.Keep(renderedEntry(entry("b", "logstash-2018.10.10", "2018-10-10T23:00"), "message b"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = g.Keep(renderedEntry(entry("e", "logstash-2018.10.12", "2018-10-12T01:00"), "message e"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 2, g.filtered)
+}
+
+func TestGrepFilter_field(t *testing.T) {
+	g, err := newGrepFilter(&domain.Query{Grep: "^message e$", GrepField: "message"})
+	assert.Nil(t, err)
+
+	e := renderedEntry(entry("e", "logstash-2018.10.12", "2018-10-12T01:00"), "rendered line")
+	ok, err := g.Keep(e)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Nil(t, e.Matches)
+
+	g, err = newGrepFilter(&domain.Query{GrepInvert: ".", GrepField: "missing"})
+	assert.Nil(t, err)
+	ok, err = g.Keep(renderedEntry(entry("e", "logstash-2018.10.12", "2018-10-12T01:00"), "rendered line"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestGrepFilter_matches(t *testing.T) {
+	g, err := newGrepFilter(&domain.Query{Grep: "o+"})
+	assert.Nil(t, err)
+
+	e := &domain.Entry{Line: "foo box"}
+	ok, err := g.Keep(e)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, [][]int{{1, 3}, {5, 6}}, e.Matches)
+	assert.Equal(t, "f\x1b[1;31moo\x1b[0m b\x1b[1;31mo\x1b[0mx", highlight(e.Line, e.Matches))
+	assert.Equal(t, "> f\x1b[1;31moo\x1b[0m b\x1b[1;31mo\x1b[0mx", highlight(marked(e).Line, marked(e).Matches))
+}
+
+func TestStart_grep(t *testing.T) {
+	q := newStopQuery()
+	q.Refresh = 0
+	q.Grep = "e$"
+
+	c := newTestConnector(t)
+	defer c.Close()
+	tl := New(logrus.WithFields(nil), c)
+	assert.Nil(t, tl.Start(q))
+	assert.Equal(t, 1, tl.grep.filtered)
+	assert.Equal(t, 1, tl.stop.printed)
+}
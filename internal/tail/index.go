@@ -27,11 +27,12 @@ func FilterIndex(indices []string, indexPattern string, start *time.Time, end *t
 	for _, idx := range indices {
 		matched, _ := regexp.MatchString(indexPattern, idx)
 		if matched {
-			idxDate, err := extractIndexDate(idx)
+			idxDate, err := ExtractIndexDate(idx)
 			if err != nil {
 				return nil, errors.Wrap(err, fmt.Sprintf("failed parsing log date: %s", idx))
 			}
-			if (idxDate.After(*start) || idxDate.Equal(*start)) && (idxDate.Before(*end) || idxDate.Equal(*end)) {
+			// daily indices hold the logs of the whole day, so they are selected if the day overlaps the range
+			if idxDate.Add(24*time.Hour).After(*start) && (idxDate.Before(*end) || idxDate.Equal(*end)) {
 				result = append(result, idx)
 			}
 		}
@@ -55,8 +56,8 @@ func findLastIndex(indices []string, indexPattern string) string {
 	return lastIdx
 }
 
-// extractIndexDate extracts and parses the index date from its name
-func extractIndexDate(dateStr string) (*time.Time, error) {
+// ExtractIndexDate extracts and parses the index date from its name
+func ExtractIndexDate(dateStr string) (*time.Time, error) {
 	dateRegexp := regexp.MustCompile(fmt.Sprintf(`(\d{4}.\d{2}.\d{2})`))
 	match := dateRegexp.FindAllStringSubmatch(dateStr, -1)
 	if len(match) == 0 {
@@ -69,3 +70,15 @@ func extractIndexDate(dateStr string) (*time.Time, error) {
 	}
 	return &parsed, nil
 }
+
+// MatchIndex returns the indices that match the pattern
+func MatchIndex(indices []string, indexPattern string) []string {
+	result := make([]string, 0, len(indices))
+	for _, idx := range indices {
+		matched, _ := regexp.MatchString(indexPattern, idx)
+		if matched {
+			result = append(result, idx)
+		}
+	}
+	return result
+}
@@ -37,3 +37,20 @@ func TestFilterIndex_start(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, []string{"logstash-2018.11.03", "logstash-2018.10.10", "logstash-2018.10.11"}, r)
 }
+
+func TestFilterIndex_startWithinDay(t *testing.T) {
+	var indices = []string{"logstash-2018.11.03", "logstash-2018.10.10", "logstash-2018.10.09", "logstash-2018.10.11"}
+
+	start, err := time.Parse("2006-01-02T15:04", "2018-10-10T15:00")
+	assert.Nil(t, err)
+	r, err := tail.FilterIndex(indices, pattern, &start, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"logstash-2018.11.03", "logstash-2018.10.10", "logstash-2018.10.11"}, r)
+}
+
+func TestMatchIndex(t *testing.T) {
+	var indices = []string{"logstash-2018.11.03", "metrics-2018.10.10", "logstash-2018.10.09"}
+
+	r := tail.MatchIndex(indices, pattern)
+	assert.Equal(t, []string{"logstash-2018.11.03", "logstash-2018.10.09"}, r)
+}
@@ -0,0 +1,131 @@
+package tail
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KubernetesFields maps the kubernetes metadata to the fields of the logs
+type KubernetesFields struct {
+	Namespace  string
+	Pod        string
+	Container  string
+	Labels     string // object holding the pod labels
+	Deployment string
+}
+
+// DefaultKubernetesFields are the fields added by Filebeat's kubernetes autodiscover
+var DefaultKubernetesFields = KubernetesFields{
+	Namespace:  "kubernetes.namespace",
+	Pod:        "kubernetes.pod.name",
+	Container:  "kubernetes.container.name",
+	Labels:     "kubernetes.labels",
+	Deployment: "kubernetes.deployment.name",
+}
+
+// ParseKubernetesFields overrides the default fields with the mapping of names (namespace, pod, container,
+// labels or deployment) to fields
+func ParseKubernetesFields(mapping map[string]string) (KubernetesFields, error) {
+	fields := DefaultKubernetesFields
+	for name, field := range mapping {
+		switch name {
+		case "namespace":
+			fields.Namespace = field
+		case "pod":
+			fields.Pod = field
+		case "container":
+			fields.Container = field
+		case "labels":
+			fields.Labels = field
+		case "deployment":
+			fields.Deployment = field
+		default:
+			return fields, fmt.Errorf("unknown kubernetes field: %s", name)
+		}
+	}
+	return fields, nil
+}
+
+// KubernetesFilter selects the logs of kubernetes workloads
+type KubernetesFilter struct {
+	Namespace  string
+	Pod        string // glob pattern
+	Container  string
+	Labels     map[string]string
+	Deployment string
+}
+
+// Empty checks if no filter is set
+func (k *KubernetesFilter) Empty() bool {
+	return k.Namespace == "" && k.Pod == "" && k.Container == "" && len(k.Labels) == 0 && k.Deployment == ""
+}
+
+// Query returns the query string selecting the logs, combined with the query
+func (k *KubernetesFilter) Query(fields KubernetesFields, query string) (string, error) {
+	var terms []string
+	add := func(field string, name string, value string) error {
+		if value == "" {
+			return nil
+		}
+		if field == "" {
+			return fmt.Errorf("no field mapped for the kubernetes %s", name)
+		}
+		terms = append(terms, fmt.Sprintf(`%s:"%s"`, field, escapeQueryValue(value)))
+		return nil
+	}
+
+	if err := add(fields.Namespace, "namespace", k.Namespace); err != nil {
+		return "", err
+	}
+	if k.Pod != "" {
+		if fields.Pod == "" {
+			return "", fmt.Errorf("no field mapped for the kubernetes pod")
+		}
+		terms = append(terms, fmt.Sprintf("%s:%s", fields.Pod, escapeGlob(k.Pod)))
+	}
+	if err := add(fields.Container, "container", k.Container); err != nil {
+		return "", err
+	}
+	if err := add(fields.Deployment, "deployment", k.Deployment); err != nil {
+		return "", err
+	}
+
+	// sort the labels so the query is stable
+	labels := make([]string, 0, len(k.Labels))
+	for l := range k.Labels {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+	for _, l := range labels {
+		if err := add(fields.Labels+"."+l, "labels", k.Labels[l]); err != nil {
+			return "", err
+		}
+	}
+
+	filter := strings.Join(terms, " AND ")
+	switch {
+	case filter == "":
+		return query, nil
+	case query == "":
+		return filter, nil
+	}
+	return fmt.Sprintf("(%s) AND %s", query, filter), nil
+}
+
+// KubernetesFormat returns the output format prefixing the message with namespace/pod[container]
+func KubernetesFormat(fields KubernetesFields, message string) string {
+	return fmt.Sprintf("%%%s/%%%s[%%%s] %%%s", fields.Namespace, fields.Pod, fields.Container, message)
+}
+
+// escapeGlob escapes the query string reserved characters of a glob pattern, keeping its wildcards
+func escapeGlob(pattern string) string {
+	var b strings.Builder
+	for _, r := range pattern {
+		if strings.ContainsRune(`+-=&|><!(){}[]^"~:\/ `, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package tail_test
+
+import (
+	"testing"
+
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKubernetesFilter_Query(t *testing.T) {
+	k := &tail.KubernetesFilter{
+		Namespace: "prod",
+		Pod:       "api-7d9f*",
+		Container: "app",
+		Labels:    map[string]string{"tier": "backend", "app": "test"},
+	}
+
+	r, err := k.Query(tail.DefaultKubernetesFields, "level:error")
+	assert.Nil(t, err)
+	assert.Equal(t, `(level:error) AND kubernetes.namespace:"prod" AND kubernetes.pod.name:api\-7d9f* AND kubernetes.container.name:"app" AND kubernetes.labels.app:"test" AND kubernetes.labels.tier:"backend"`, r)
+
+	r, err = (&tail.KubernetesFilter{}).Query(tail.DefaultKubernetesFields, "level:error")
+	assert.Nil(t, err)
+	assert.Equal(t, "level:error", r)
+}
+
+func TestKubernetesFilter_fields(t *testing.T) {
+	fields, err := tail.ParseKubernetesFields(map[string]string{"namespace": "k8s.ns", "deployment": ""})
+	assert.Nil(t, err)
+	assert.Equal(t, "k8s.ns", fields.Namespace)
+	assert.Equal(t, "kubernetes.pod.name", fields.Pod)
+
+	r, err := (&tail.KubernetesFilter{Namespace: "prod"}).Query(fields, "")
+	assert.Nil(t, err)
+	assert.Equal(t, `k8s.ns:"prod"`, r)
+
+	_, err = (&tail.KubernetesFilter{Deployment: "api"}).Query(fields, "")
+	assert.NotNil(t, err)
+
+	_, err = tail.ParseKubernetesFields(map[string]string{"node": "kubernetes.node.name"})
+	assert.NotNil(t, err)
+
+	assert.Equal(t, "%k8s.ns/%kubernetes.pod.name[%kubernetes.container.name] %message", tail.KubernetesFormat(fields, "message"))
+}
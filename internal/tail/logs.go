@@ -21,24 +21,44 @@ func GetFields(format string) []string {
 	return formatRegexp.FindAllString(format, -1)
 }
 
-func processEntry(e *domain.LogEntry, showTime bool, format string, fields []string) (string, error) {
+// ProcessLogs processes json messages and returns the log entries according to the provided format, in the same order.
+// Unlike the tailed logs, the fields missing from a message are left empty instead of keeping their placeholder.
+func ProcessLogs(logs []*json.RawMessage, showTime bool, format string, fields []string) ([]string, error) {
+	entries := make([]string, 0, len(logs))
+	for _, l := range logs {
+		s, err := processEntry(&domain.LogEntry{Message: l}, showTime, format, fields, true)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, s)
+	}
+	return entries, nil
+}
+
+// processEntry decodes the log and builds its line based on the provided output format
+func processEntry(e *domain.LogEntry, showTime bool, format string, fields []string, blank bool) (string, error) {
 	// unmarshal the log entry
 	var entry map[string]interface{}
 	err := json.Unmarshal(*e.Message, &entry)
 	if err != nil {
 		return "", err
 	}
+	return formatSource(entry, e.Message, showTime, format, fields, blank), nil
+}
 
+// formatSource builds the line of a decoded log based on the provided output format.
+// The fields missing from the log keep their placeholder, or are left empty if blank is set.
+func formatSource(entry map[string]interface{}, raw *json.RawMessage, showTime bool, format string, fields []string, blank bool) string {
 	// if no fields were provided, print the log as is
 	if len(fields) == 0 {
-		return fmt.Sprintf("%s", *e.Message), nil
+		return fmt.Sprintf("%s", *raw)
 	}
 
 	// build the log entry based on the provided output format
 	result := format
 	for _, f := range fields {
 		value, err := evaluateExpression(entry, f[1:])
-		if err != nil {
+		if err != nil && !blank {
 			continue
 		}
 		result = strings.Replace(result, f, strings.Trim(value, "\n"), -1)
@@ -47,16 +67,25 @@ func processEntry(e *domain.LogEntry, showTime bool, format string, fields []str
 	if showTime {
 		value, err := evaluateExpression(entry, timestampField)
 		if err != nil {
-			return result, nil
+			return result
 		}
 		t, err := time.Parse(time.RFC3339Nano, value)
 		if err != nil {
-			return result, nil
+			return result
 		}
 		result = fmt.Sprintf("%s: %s", t.Format("2006-01-02T15:04:05"), result)
 	}
 
-	return result, nil
+	return result
+}
+
+// FieldValue returns the value of the field of the json message, using dot syntax for nested fields
+func FieldValue(message *json.RawMessage, field string) (string, error) {
+	var entry map[string]interface{}
+	if err := json.Unmarshal(*message, &entry); err != nil {
+		return "", err
+	}
+	return evaluateExpression(entry, field)
 }
 
 // EvaluateExpression Expression evaluation function. It uses map as a model and evaluates expression given as the parameter using dot syntax:
@@ -87,15 +116,3 @@ func evaluateExpression(model interface{}, fieldExpression string) (string, erro
 	}
 	return evaluateExpression(nextModel, nextExpression)
 }
-
-func printLogs(entries []string, reverse bool) {
-	if !reverse {
-		for i := len(entries) - 1; i >= 0; i-- {
-			fmt.Println(entries[i])
-		}
-	} else {
-		for i := 0; i < len(entries); i++ {
-			fmt.Println(entries[i])
-		}
-	}
-}
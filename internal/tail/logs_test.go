@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/pmdcosta/elklogs/internal/domain"
 	"github.com/pmdcosta/elklogs/internal/tail"
 	"github.com/stretchr/testify/assert"
 )
@@ -46,3 +47,14 @@ func TestProcessLogs_notfound(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, []string{"2018-11-29T04:51:34: message :", "2018-11-29T04:51:35: message2 :"}, r)
 }
+
+func TestNewFormatter_notfound(t *testing.T) {
+	a := json.RawMessage(`{"@timestamp":"2018-11-29T04:51:34","test":"message\n"}`)
+	var source map[string]interface{}
+	assert.Nil(t, json.Unmarshal(a, &source))
+
+	format := "%@timestamp: %test :%stuff"
+	r, err := tail.NewFormatter(false, format, tail.GetFields(format)).Format(&domain.Entry{Source: source, Raw: &a})
+	assert.Nil(t, err)
+	assert.Equal(t, "2018-11-29T04:51:34: message :%stuff", r)
+}
@@ -0,0 +1,102 @@
+package tail
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/pmdcosta/elklogs/internal/domain"
+)
+
+// DefaultMultilinePatterns match the continuation lines of Java and Python stack traces
+var DefaultMultilinePatterns = []string{
+	`^\s`,
+	`^at `,
+	`^Caused by:`,
+	`^\.\.\. \d+ (more|common frames omitted)`,
+	`^Traceback \(most recent call last\)`,
+	`^During handling of the above exception`,
+	`^The above exception was the direct cause`,
+	`^[\w.$]+(Error|Exception)(: |$)`,
+}
+
+// indentation of the continuation lines in a block
+const continuationIndent = "    "
+
+// multiline groups the continuation lines with the previous log of the same source
+type multiline struct {
+	patterns []*regexp.Regexp
+	by       []string
+	field    string
+}
+
+// newMultiline compiles the multi-line patterns of the query, returning nil if grouping is disabled
+func newMultiline(query *domain.Query) (*multiline, error) {
+	if len(query.MultilinePatterns) == 0 {
+		return nil, nil
+	}
+	m := &multiline{by: query.MultilineBy, field: query.MultilineField}
+	if m.field == "" {
+		m.field = "message"
+	}
+	for _, p := range query.MultilinePatterns {
+		r, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid multi-line pattern: %s", p))
+		}
+		m.patterns = append(m.patterns, r)
+	}
+	return m, nil
+}
+
+// group merges the continuation logs into the block of the previous log of their source.
+// The entries are sorted newest first, the blocks are returned in the same order.
+func (m *multiline) group(entries []*domain.Entry) []*domain.Entry {
+	blocks := make([]*domain.Entry, 0, len(entries))
+	open := make(map[string]int) // last block of each source
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		source, message, ok := m.parse(entries[i])
+		if j, found := open[source]; ok && found && m.continuation(message) {
+			blocks[j].Line += "\n" + continuationIndent + strings.TrimRightFunc(message, unicode.IsSpace)
+			continue
+		}
+		open[source] = len(blocks)
+		// the head is copied since its line grows with the block
+		head := *entries[i]
+		blocks = append(blocks, &head)
+	}
+
+	// back to newest first
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	return blocks
+}
+
+// parse returns the source and the message of the entry
+func (m *multiline) parse(e *domain.Entry) (string, string, bool) {
+	values := make([]string, 0, len(m.by))
+	for _, f := range m.by {
+		// fields missing from the log are left empty
+		v, _ := evaluateExpression(e.Source, f)
+		values = append(values, v)
+	}
+	message, err := evaluateExpression(e.Source, m.field)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Join(values, "\x00"), message, true
+}
+
+// continuation checks if the message continues the previous log
+func (m *multiline) continuation(message string) bool {
+	for _, p := range m.patterns {
+		if p.MatchString(message) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package tail
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func sourceEntry(id string, pod string, message string) *domain.LogEntry {
+	b, _ := json.Marshal(map[string]interface{}{"pod": pod, "message": message})
+	m := json.RawMessage(b)
+	return &domain.LogEntry{ID: id, Message: &m}
+}
+
+func TestMultiline_group(t *testing.T) {
+	m, err := newMultiline(&domain.Query{MultilinePatterns: DefaultMultilinePatterns, MultilineBy: []string{"pod"}})
+	assert.Nil(t, err)
+
+	// newest first, with the lines of both pods interleaved
+	logs := []*domain.LogEntry{
+		sourceEntry("7", "b", "request done"),
+		sourceEntry("6", "a", "\tat com.example.Main.main(Main.java:10)"),
+		sourceEntry("5", "b", "  File \"app.py\", line 3, in <module>"),
+		sourceEntry("4", "a", "Caused by: java.io.IOException: closed"),
+		sourceEntry("3", "b", "Traceback (most recent call last):"),
+		sourceEntry("2", "a", "java.lang.IllegalStateException: failed"),
+		sourceEntry("1", "a", "request failed"),
+	}
+	entries := make([]*domain.Entry, len(logs))
+	for i, l := range logs {
+		entries[i] = renderedEntry(l, fmt.Sprintf("[%s] %s", l.ID, l.ID))
+	}
+
+	blocks := m.group(entries)
+	lines := make([]string, 0, len(blocks))
+	heads := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		heads = append(heads, b.ID)
+		lines = append(lines, b.Line)
+	}
+	assert.Equal(t, []string{"7", "3", "1"}, heads)
+	assert.Equal(t, []string{
+		"[7] 7",
+		"[3] 3\n      File \"app.py\", line 3, in <module>",
+		"[1] 1\n    java.lang.IllegalStateException: failed\n    Caused by: java.io.IOException: closed\n    \tat com.example.Main.main(Main.java:10)",
+	}, lines)
+	assert.Equal(t, "[1] 1", entries[6].Line)
+}
+
+func TestMultiline_disabled(t *testing.T) {
+	m, err := newMultiline(&domain.Query{})
+	assert.Nil(t, err)
+	assert.Nil(t, m)
+
+	_, err = newMultiline(&domain.Query{MultilinePatterns: []string{"("}})
+	assert.NotNil(t, err)
+}
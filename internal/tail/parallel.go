@@ -0,0 +1,210 @@
+package tail
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+)
+
+// errStopMerge can be returned by the merge callback to stop consuming entries
+var errStopMerge = errors.New("stop merge")
+
+// indexSource holds the result of querying a single index
+type indexSource struct {
+	index string
+	bound *time.Time // newest timestamp the index can hold, nil if unknown
+	done  chan struct{}
+
+	logs []*domain.LogEntry
+	err  error
+	pos  int
+}
+
+// head returns the next entry of the source, or nil if it was consumed
+func (s *indexSource) head() *domain.LogEntry {
+	if s.pos >= len(s.logs) {
+		return nil
+	}
+	return s.logs[s.pos]
+}
+
+// resolved checks if the query to the index has finished
+func (s *indexSource) resolved() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// newIndexSources creates a source per index, ordered from the newest to the oldest index
+func newIndexSources(indices []string) []*indexSource {
+	sources := make([]*indexSource, 0, len(indices))
+	for _, idx := range indices {
+		s := &indexSource{index: idx, done: make(chan struct{})}
+		if d, err := ExtractIndexDate(idx); err == nil {
+			b := d.Add(24 * time.Hour)
+			s.bound = &b
+		}
+		sources = append(sources, s)
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		a, b := sources[i].bound, sources[j].bound
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		return a.After(*b)
+	})
+	return sources
+}
+
+// fetchParallel queries the indices concurrently and merges the results newest first,
+// calling emit for each entry as soon as no pending index can hold a newer one
+func (t *Tail) fetchParallel(ctx context.Context, query *domain.Query, indices []string, emit func(*domain.LogEntry) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	sources := newIndexSources(indices)
+	workers := query.Parallel
+	if workers > len(sources) {
+		workers = len(sources)
+	}
+	t.logger.WithFields(logrus.Fields{"indices": len(sources), "workers": workers}).Debug("querying indices in parallel")
+
+	// the newest indices are queried first since their entries are emitted first
+	jobs := make(chan *indexSource)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range jobs {
+				s.logs, s.err = t.connector.ExecuteQuery(ctx, []string{s.index}, timestampField, false, query.Query, query.Entries)
+				t.logger.WithFields(logrus.Fields{"index": s.index, "logs": len(s.logs), "err": s.err}).Debug("index fetched")
+				close(s.done)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, s := range sources {
+			select {
+			case jobs <- s:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// the queries still running when the merge stops early are cancelled before waiting for them
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for emitted := 0; emitted < query.Entries; {
+		next, wait, err := nextSource(sources)
+		if err != nil {
+			return err
+		}
+		if wait != nil {
+			select {
+			case <-wait.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			continue
+		}
+		if next == nil {
+			return nil
+		}
+
+		if err := emit(next.head()); err != nil {
+			if err == errStopMerge {
+				return nil
+			}
+			return err
+		}
+		next.pos++
+		emitted++
+	}
+	return nil
+}
+
+// nextSource picks the source holding the newest entry, or the pending source that must be waited on
+// before the newest entry can be known. Both are nil when every source was consumed.
+func nextSource(sources []*indexSource) (next *indexSource, wait *indexSource, err error) {
+	for _, s := range sources {
+		if !s.resolved() {
+			continue
+		}
+		if s.err != nil {
+			return nil, nil, errors.Wrap(s.err, fmt.Sprintf("could not fetch logs from %s", s.index))
+		}
+		if h := s.head(); h != nil && (next == nil || h.Timestamp.After(next.head().Timestamp)) {
+			next = s
+		}
+	}
+
+	for _, s := range sources {
+		if s.resolved() {
+			continue
+		}
+		if next == nil || s.bound == nil || s.bound.After(next.head().Timestamp) {
+			return nil, s, nil
+		}
+	}
+	return next, nil, nil
+}
+
+// parallelLoop retrieves logs querying each index concurrently, processes them and prints them
+func (t *Tail) parallelLoop(ctx context.Context, query *domain.Query, indices []string) error {
+	// newest first output does not depend on older entries so it can be printed right away,
+	// unless the new logs must be checked against the until query or grouped with older lines first
+	stream := query.Reverse && (t.stop == nil || t.stop.untilQuery == "") && t.multiline == nil
+
+	var first string
+	var entries []*domain.Entry
+	err := t.fetchParallel(ctx, query, indices, func(log *domain.LogEntry) error {
+		if log.ID == t.lastID {
+			return errStopMerge
+		}
+		if first == "" {
+			first = log.ID
+		}
+
+		e, ok, err := t.processLog(log)
+		if err != nil {
+			return errors.Wrap(err, "could not process logs")
+		}
+		if !ok {
+			return nil
+		}
+		if stream {
+			return t.printLog(ctx, query, indices, e)
+		}
+		entries = append(entries, e)
+		return nil
+	})
+
+	// we need to keep track of the ID of the last message to remove duplicates between loops
+	if first != "" {
+		t.lastID = first
+	}
+	if err != nil || stream {
+		return err
+	}
+
+	// check which of the new logs match the stop query
+	if err := t.matchUntil(ctx, query, indices, entries); err != nil {
+		return err
+	}
+
+	return t.printLogs(ctx, query, indices, entries)
+}
@@ -0,0 +1,145 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail/tailtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// testConnector records the queries of the test connector, optionally blocking them until their index is released
+type testConnector struct {
+	*tailtest.Connector
+	release map[string]chan struct{}
+
+	mu       sync.Mutex
+	executed []string // queries received, in order
+}
+
+func (c *testConnector) ExecuteQuery(ctx context.Context, indices []string, timestampField string, order bool, query string, entries int) ([]*domain.LogEntry, error) {
+	c.mu.Lock()
+	c.executed = append(c.executed, query)
+	c.mu.Unlock()
+
+	if r, ok := c.release[indices[0]]; ok {
+		select {
+		case <-r:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return c.Connector.ExecuteQuery(ctx, indices, timestampField, order, query, entries)
+}
+
+// add adds a log with the message of its id at the time
+func (c *testConnector) add(id string, ts string) {
+	c.Add(id, date(ts), map[string]interface{}{"message": "message " + id})
+}
+
+// date parses a time formatted as 2006-01-02T15:04
+func date(ts string) time.Time {
+	t, _ := time.Parse("2006-01-02T15:04", ts)
+	return t
+}
+
+func entry(id string, index string, ts string) *domain.LogEntry {
+	t := date(ts)
+	m := json.RawMessage(fmt.Sprintf(`{"@timestamp":"%s","message":"message %s"}`, t.Format(time.RFC3339), id))
+	return &domain.LogEntry{ID: id, Index: index, Timestamp: t, Message: &m}
+}
+
+// newTestConnector creates a connector with logs in the daily indices of three days
+func newTestConnector(t *testing.T) *testConnector {
+	c := &testConnector{Connector: tailtest.New(t), release: map[string]chan struct{}{}}
+	c.add("a", "2018-10-11T08:00")
+	c.add("b", "2018-10-10T23:00")
+	c.add("c", "2018-10-11T10:00")
+	c.add("d", "2018-10-12T00:30")
+	c.add("e", "2018-10-12T01:00")
+	return c
+}
+
+func TestFetchParallel(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	tl := New(logrus.WithFields(nil), c)
+	indices, _ := c.GetIndexNames(context.Background())
+
+	var ids []string
+	err := tl.fetchParallel(context.Background(), &domain.Query{Parallel: 2, Entries: 4}, indices, func(e *domain.LogEntry) error {
+		ids = append(ids, e.ID)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"e", "d", "c", "a"}, ids)
+}
+
+func TestFetchParallel_stop(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	tl := New(logrus.WithFields(nil), c)
+	indices, _ := c.GetIndexNames(context.Background())
+
+	var ids []string
+	err := tl.fetchParallel(context.Background(), &domain.Query{Parallel: 3, Entries: 10}, indices, func(e *domain.LogEntry) error {
+		if e.ID == "a" {
+			return errStopMerge
+		}
+		ids = append(ids, e.ID)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"e", "d", "c"}, ids)
+}
+
+func TestFetchParallel_streaming(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	c.release["logstash-2018.10.10"] = make(chan struct{})
+	tl := New(logrus.WithFields(nil), c)
+	indices, _ := c.GetIndexNames(context.Background())
+
+	// entries from the newer indices must be emitted while the oldest index is still being queried
+	var ids []string
+	err := tl.fetchParallel(context.Background(), &domain.Query{Parallel: 3, Entries: 10}, indices, func(e *domain.LogEntry) error {
+		ids = append(ids, e.ID)
+		if e.ID == "a" {
+			close(c.release["logstash-2018.10.10"])
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"e", "d", "c", "a", "b"}, ids)
+}
+
+func TestFetchParallel_cancel(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	c.release["logstash-2018.10.10"] = make(chan struct{})
+	tl := New(logrus.WithFields(nil), c)
+	indices, _ := c.GetIndexNames(context.Background())
+
+	// the oldest index is never released, so returning requires cancelling its query once the entries are merged
+	done := make(chan error)
+	var ids []string
+	go func() {
+		done <- tl.fetchParallel(context.Background(), &domain.Query{Parallel: 3, Entries: 1}, indices, func(e *domain.LogEntry) error {
+			ids = append(ids, e.ID)
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"e"}, ids)
+	case <-time.After(time.Second):
+		t.Fatal("the pending index query was not cancelled")
+	}
+}
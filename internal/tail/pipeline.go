@@ -0,0 +1,139 @@
+package tail
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+)
+
+// Filter decides which entries are written, after they are formatted
+type Filter interface {
+	Keep(e *domain.Entry) (bool, error)
+}
+
+// FilterFunc adapts a function to the Filter interface
+type FilterFunc func(e *domain.Entry) (bool, error)
+
+// Keep calls the function
+func (f FilterFunc) Keep(e *domain.Entry) (bool, error) {
+	return f(e)
+}
+
+// Formatter renders the line of an entry
+type Formatter interface {
+	Format(e *domain.Entry) (string, error)
+}
+
+// FormatterFunc adapts a function to the Formatter interface
+type FormatterFunc func(e *domain.Entry) (string, error)
+
+// Format calls the function
+func (f FormatterFunc) Format(e *domain.Entry) (string, error) {
+	return f(e)
+}
+
+// NewFormatter creates a formatter replacing the fields in the format with their values in the log.
+// The log is rendered as is when there are no fields, and the fields missing from it keep their placeholder.
+func NewFormatter(showTime bool, format string, fields []string) Formatter {
+	return FormatterFunc(func(e *domain.Entry) (string, error) {
+		return formatSource(e.Source, e.Raw, showTime, format, fields, false), nil
+	})
+}
+
+// JSONFormatter renders the log as a single line json document
+var JSONFormatter Formatter = FormatterFunc(func(e *domain.Entry) (string, error) {
+	var b bytes.Buffer
+	if err := json.Compact(&b, *e.Raw); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+})
+
+// NewEntry decodes a log fetched from the database into an entry of the pipeline
+func NewEntry(log *domain.LogEntry) (*domain.Entry, error) {
+	e := &domain.Entry{
+		ID:        log.ID,
+		Index:     log.Index,
+		Timestamp: log.Timestamp,
+		Raw:       log.Message,
+	}
+	if err := json.Unmarshal(*log.Message, &e.Source); err != nil {
+		return nil, err
+	}
+
+	// the sort value is missing when the logs are not sorted by timestamp
+	if e.Timestamp.IsZero() {
+		if value, err := evaluateExpression(e.Source, timestampField); err == nil {
+			e.Timestamp, _ = time.Parse(time.RFC3339Nano, value)
+		}
+	}
+	return e, nil
+}
+
+// logEntry converts the entry back to the log it was decoded from
+func logEntry(e *domain.Entry) *domain.LogEntry {
+	return &domain.LogEntry{ID: e.ID, Index: e.Index, Timestamp: e.Timestamp, Message: e.Raw}
+}
+
+// processLogs decodes the new logs, formats them and returns the entries kept by the filters
+func (t *Tail) processLogs(logs []*domain.LogEntry) ([]*domain.Entry, error) {
+	entries := make([]*domain.Entry, 0, len(logs))
+	for _, log := range logs {
+		if log.ID == t.lastID {
+			break
+		}
+
+		e, ok, err := t.processLog(log)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			entries = append(entries, e)
+		}
+	}
+
+	// we need to keep track of the ID of the last message to remove duplicates between loops
+	if len(logs) > 0 {
+		t.lastID = logs[0].ID
+	}
+
+	return entries, nil
+}
+
+// processLog decodes and formats a single log, reporting if it passes the filters
+func (t *Tail) processLog(log *domain.LogEntry) (*domain.Entry, bool, error) {
+	e, err := t.render(log, domain.EntryLog)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, f := range t.filters() {
+		ok, err := f.Keep(e)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+	}
+	return e, true, nil
+}
+
+// render decodes the log and formats its line
+func (t *Tail) render(log *domain.LogEntry, kind domain.EntryKind) (*domain.Entry, error) {
+	e, err := NewEntry(log)
+	if err != nil {
+		return nil, err
+	}
+	e.Kind = kind
+	if e.Line, err = t.formatter.Format(e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// filters returns the grep filter followed by the configured filters
+func (t *Tail) filters() []Filter {
+	if t.grep == nil {
+		return t.extraFilters
+	}
+	return append([]Filter{t.grep}, t.extraFilters...)
+}
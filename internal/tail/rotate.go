@@ -0,0 +1,265 @@
+package tail
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// placeholders of the output file name templates
+const (
+	templateDate  = "{date}"
+	templateTime  = "{time}"
+	templateIndex = "{index}"
+)
+
+// Rotation configures when the output files are rotated
+type Rotation struct {
+	MaxSize  int64         // rotate before the file exceeds the size in bytes, 0 disables it
+	Interval time.Duration // rotate at each multiple of the interval since the local midnight, or the local epoch for intervals over a day, 0 disables it
+	Compress bool          // gzip the rotated files
+	MaxFiles int           // number of files kept, removing the oldest ones, 0 keeps all of them
+}
+
+// enabled checks if the files are ever rotated
+func (r Rotation) enabled() bool {
+	return r.MaxSize > 0 || r.Interval > 0
+}
+
+// RotatingFile writes to files named after a template, starting a new file when a rotation limit is reached.
+// The template accepts {date} and {time}, the time the file was started at, and {index}, which counts
+// the files sharing the same date and time, skipping existing ones. Without {index}, files after the first
+// are suffixed with .N instead.
+type RotatingFile struct {
+	template string
+	rotation Rotation
+	now      func() time.Time
+
+	file    *os.File
+	name    string
+	size    int64
+	started time.Time // start of the interval of the file
+	base    string    // name of the first file of the date and time
+	index   int
+}
+
+// NewRotatingFile opens the first file of the template.
+// Without rotation, the file is appended to; otherwise existing files are never written to.
+func NewRotatingFile(template string, rotation Rotation) (*RotatingFile, error) {
+	r := &RotatingFile{template: template, rotation: rotation, now: time.Now}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Name returns the name of the file being written
+func (r *RotatingFile) Name() string {
+	return r.name
+}
+
+// Write writes to the current file, rotating it first if the data would exceed a limit
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	if r.due(len(p)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Close syncs and closes the current file, which is not compressed
+func (r *RotatingFile) Close() error {
+	if err := r.file.Sync(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// due checks if the file must be rotated before writing the number of bytes
+func (r *RotatingFile) due(n int) bool {
+	if r.rotation.MaxSize > 0 && r.size > 0 && r.size+int64(n) > r.rotation.MaxSize {
+		return true
+	}
+	return r.rotation.Interval > 0 && !r.now().Before(r.started.Add(r.rotation.Interval))
+}
+
+// rotate syncs and closes the current file, compresses it if requested and opens the next one
+func (r *RotatingFile) rotate() error {
+	if err := r.Close(); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("could not close %s", r.name))
+	}
+	if r.rotation.Compress {
+		if err := compressFile(r.name); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("could not compress %s", r.name))
+		}
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	return r.prune()
+}
+
+// open opens the file for the current time
+func (r *RotatingFile) open() error {
+	now := r.now()
+	r.started = now
+	if r.rotation.Interval > 0 {
+		r.started = intervalStart(now, r.rotation.Interval)
+	}
+
+	flags := os.O_WRONLY | os.O_APPEND | os.O_CREATE
+	name := r.fileName(r.started, 0)
+	if r.rotation.enabled() {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		if name != r.base {
+			r.base, r.index = name, 0
+		}
+		for name = r.fileName(r.started, r.index); exists(name) || exists(name+".gz"); {
+			r.index++
+			name = r.fileName(r.started, r.index)
+		}
+	}
+
+	f, err := os.OpenFile(name, flags, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not open the output file")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "could not open the output file")
+	}
+	r.file, r.name, r.size = f, name, info.Size()
+	return nil
+}
+
+// intervalStart returns the start of the interval holding the time, counting the intervals from midnight
+// in the zone of the time, as the file names are rendered in it. The intervals over a day are counted
+// from the epoch in the zone instead, the ones of whole days from its midnights.
+func intervalStart(t time.Time, interval time.Duration) time.Time {
+	const day = 24 * time.Hour
+	if interval > day && interval%day == 0 {
+		days := int64(interval / day)
+		elapsed := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / int64(day/time.Second)
+		return time.Date(1970, 1, 1+int(elapsed/days*days), 0, 0, 0, 0, t.Location())
+	}
+	origin := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if interval > day {
+		origin = time.Date(1970, 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	return origin.Add(t.Sub(origin) / interval * interval)
+}
+
+// fileName renders the template for the time and index
+func (r *RotatingFile) fileName(t time.Time, index int) string {
+	name := strings.NewReplacer(
+		templateDate, t.Format("2006-01-02"),
+		templateTime, t.Format("15-04-05"),
+		templateIndex, strconv.Itoa(index),
+	).Replace(r.template)
+	if index > 0 && !strings.Contains(r.template, templateIndex) {
+		name = fmt.Sprintf("%s.%d", name, index)
+	}
+	return name
+}
+
+// prune removes the oldest files of the template beyond the max files
+func (r *RotatingFile) prune() error {
+	if r.rotation.MaxFiles <= 0 {
+		return nil
+	}
+
+	dir := filepath.Dir(r.template)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "could not list the output files")
+	}
+	match := r.filesRegexp()
+	var files []os.FileInfo
+	for _, info := range infos {
+		if !info.IsDir() && match.MatchString(info.Name()) {
+			files = append(files, info)
+		}
+	}
+	if len(files) <= r.rotation.MaxFiles {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, info := range files[:len(files)-r.rotation.MaxFiles] {
+		name := filepath.Join(dir, info.Name())
+		if name == r.name {
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			return errors.Wrap(err, "could not remove old output file")
+		}
+	}
+	return nil
+}
+
+// filesRegexp matches the base names of the files written for the template, compressed or not
+func (r *RotatingFile) filesRegexp() *regexp.Regexp {
+	pattern := strings.NewReplacer(
+		regexp.QuoteMeta(templateDate), `\d{4}-\d{2}-\d{2}`,
+		regexp.QuoteMeta(templateTime), `\d{2}-\d{2}-\d{2}`,
+		regexp.QuoteMeta(templateIndex), `\d+`,
+	).Replace(regexp.QuoteMeta(filepath.Base(r.template)))
+	if !strings.Contains(r.template, templateIndex) {
+		pattern += `(\.\d+)?`
+	}
+	return regexp.MustCompile("^" + pattern + `(\.gz)?$`)
+}
+
+// compressFile replaces the file with its gzip version
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// exists checks if the file exists
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
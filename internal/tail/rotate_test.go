@@ -0,0 +1,166 @@
+package tail
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tempDir creates a directory for the output files of the test
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "elklogs")
+	assert.Nil(t, err)
+	return dir
+}
+
+// listDir returns the sorted names of the files in the directory
+func listDir(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRotatingFile_size(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	r, err := NewRotatingFile(filepath.Join(dir, "out.log"), Rotation{MaxSize: 10})
+	assert.Nil(t, err)
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dd\n"} {
+		_, err := r.Write([]byte(line))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, r.Close())
+
+	assert.Equal(t, []string{"out.log", "out.log.1"}, listDir(t, dir))
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "out.log.1"))
+	assert.Equal(t, "cccc\ndd\n", string(b))
+}
+
+func TestRotatingFile_intervalTemplate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	now := time.Date(2018, 10, 11, 23, 59, 0, 0, time.UTC)
+	r := &RotatingFile{
+		template: filepath.Join(dir, "logs-{date}-{index}.ndjson"),
+		rotation: Rotation{Interval: 24 * time.Hour, Compress: true},
+		now:      func() time.Time { return now },
+	}
+	assert.Nil(t, r.open())
+
+	_, err := r.Write([]byte("first\n"))
+	assert.Nil(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = r.Write([]byte("second\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+
+	assert.Equal(t, []string{"logs-2018-10-11-0.ndjson.gz", "logs-2018-10-12-0.ndjson"}, listDir(t, dir))
+	f, err := os.Open(filepath.Join(dir, "logs-2018-10-11-0.ndjson.gz"))
+	assert.Nil(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(zr)
+	assert.Equal(t, "first\n", string(b))
+}
+
+func TestRotatingFile_intervalLocal(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	// the local midnight is in the middle of the utc day
+	loc := time.FixedZone("IST", 5*3600+30*60)
+	now := time.Date(2018, 10, 11, 23, 59, 0, 0, loc)
+	r := &RotatingFile{
+		template: filepath.Join(dir, "logs-{date}.ndjson"),
+		rotation: Rotation{Interval: 24 * time.Hour},
+		now:      func() time.Time { return now },
+	}
+	assert.Nil(t, r.open())
+	assert.Equal(t, time.Date(2018, 10, 11, 0, 0, 0, 0, loc), r.started)
+
+	_, err := r.Write([]byte("first\n"))
+	assert.Nil(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = r.Write([]byte("second\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	assert.Equal(t, []string{"logs-2018-10-11.ndjson", "logs-2018-10-12.ndjson"}, listDir(t, dir))
+
+	// shorter intervals are counted from the local midnight too
+	assert.Equal(t, time.Date(2018, 10, 11, 10, 0, 0, 0, loc), intervalStart(time.Date(2018, 10, 11, 10, 59, 0, 0, loc), time.Hour))
+	assert.Equal(t, time.Date(2018, 10, 11, 10, 45, 0, 0, loc), intervalStart(time.Date(2018, 10, 11, 10, 59, 0, 0, loc), 15*time.Minute))
+}
+
+func TestRotatingFile_intervalDays(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	// 2018-10-10 is an even number of days since the epoch
+	loc := time.FixedZone("IST", 5*3600+30*60)
+	now := time.Date(2018, 10, 11, 23, 59, 0, 0, loc)
+	r := &RotatingFile{
+		template: filepath.Join(dir, "logs-{date}.ndjson"),
+		rotation: Rotation{Interval: 48 * time.Hour},
+		now:      func() time.Time { return now },
+	}
+	assert.Nil(t, r.open())
+	assert.Equal(t, time.Date(2018, 10, 10, 0, 0, 0, 0, loc), r.started)
+
+	_, err := r.Write([]byte("first\n"))
+	assert.Nil(t, err)
+	now = now.Add(2 * time.Minute)
+	_, err = r.Write([]byte("second\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, r.Close())
+	assert.Equal(t, []string{"logs-2018-10-10.ndjson", "logs-2018-10-12.ndjson"}, listDir(t, dir))
+
+	// the intervals over a day that are not whole days are counted from the epoch in the zone
+	assert.Equal(t, time.Date(2018, 10, 11, 12, 0, 0, 0, loc), intervalStart(time.Date(2018, 10, 11, 13, 0, 0, 0, loc), 36*time.Hour))
+}
+
+func TestRotatingFile_maxFiles(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "other.log"), nil, 0644))
+	r, err := NewRotatingFile(filepath.Join(dir, "out-{index}.log"), Rotation{MaxSize: 1, MaxFiles: 2})
+	assert.Nil(t, err)
+
+	for i := 0; i < 4; i++ {
+		_, err := r.Write([]byte("x"))
+		assert.Nil(t, err)
+		// the files written are backdated so their order is known
+		old := time.Now().Add(time.Duration(i-10) * time.Second)
+		os.Chtimes(r.Name(), old, old)
+	}
+	assert.Nil(t, r.Close())
+	assert.Equal(t, []string{"other.log", "out-2.log", "out-3.log"}, listDir(t, dir))
+}
+
+func TestRotatingFile_existing(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.log")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("old\n"), 0644))
+
+	// files are appended to without rotation, and never written to with it
+	r, err := NewRotatingFile(path, Rotation{})
+	assert.Nil(t, err)
+	assert.Equal(t, path, r.Name())
+	assert.Nil(t, r.Close())
+
+	r, err = NewRotatingFile(path, Rotation{MaxSize: 100})
+	assert.Nil(t, err)
+	assert.Equal(t, path+".1", r.Name())
+	assert.Nil(t, r.Close())
+}
@@ -0,0 +1,186 @@
+package tail
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmdcosta/elklogs/internal/domain"
+)
+
+// ansi escape codes used to highlight the grep matches
+const (
+	highlightStart = "\x1b[1;31m"
+	highlightEnd   = "\x1b[0m"
+)
+
+// number of entries queued for the sinks before writing blocks the tailing
+const outputQueue = 256
+
+// Sink receives the entries written by the tail, in order
+type Sink interface {
+	Write(e *domain.Entry) error
+	Close() error
+}
+
+// WriterSink writes the entry lines to a writer
+type WriterSink struct {
+	w         io.Writer
+	highlight bool
+	formatter Formatter
+}
+
+// NewWriterSink creates a sink writing a line per entry, highlighting the grep matches with ansi codes if requested
+func NewWriterSink(w io.Writer, highlight bool) *WriterSink {
+	return &WriterSink{w: w, highlight: highlight}
+}
+
+// NewFormattedSink creates a sink writing the logs rendered by its own formatter instead of the entry lines.
+// Entries without a log, such as separators, are skipped.
+func NewFormattedSink(w io.Writer, formatter Formatter) *WriterSink {
+	return &WriterSink{w: w, formatter: formatter}
+}
+
+// Write writes the line of the entry
+func (s *WriterSink) Write(e *domain.Entry) error {
+	line := e.Line
+	switch {
+	case s.formatter != nil:
+		if e.Source == nil {
+			return nil
+		}
+		var err error
+		if line, err = s.formatter.Format(e); err != nil {
+			return err
+		}
+	case s.highlight:
+		line = highlight(line, e.Matches)
+	}
+	_, err := io.WriteString(s.w, line+"\n")
+	return err
+}
+
+// Close does nothing, the writer is owned by the caller
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// FileSink writes the entry lines to rotating files
+type FileSink struct {
+	*WriterSink
+	file *RotatingFile
+}
+
+// NewFileSink opens the file named after the template, see RotatingFile.
+// The logs are rendered with the formatter when set, and written as the entry lines otherwise.
+func NewFileSink(template string, rotation Rotation, formatter Formatter) (*FileSink, error) {
+	f, err := NewRotatingFile(template, rotation)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileSink{WriterSink: NewWriterSink(f, false), file: f}
+	s.formatter = formatter
+	return s, nil
+}
+
+// Close syncs and closes the current file
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// highlight wraps the matched ranges of the line in ansi codes
+func highlight(line string, matches [][]int) string {
+	if len(matches) == 0 {
+		return line
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m[0] < last || m[1] > len(line) {
+			continue
+		}
+		b.WriteString(line[last:m[0]])
+		b.WriteString(highlightStart + line[m[0]:m[1]] + highlightEnd)
+		last = m[1]
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
+
+// output writes the entries to the sinks from a single goroutine, so they are written in order.
+// The queue is bounded: a slow sink slows down the tailing instead of buffering without limit.
+type output struct {
+	sinks   []Sink
+	entries chan *domain.Entry
+	done    chan struct{}
+	failed  chan struct{}
+	err     error // first sink error, set before failed is closed
+}
+
+// newOutput starts writing the queued entries to the sinks
+func newOutput(sinks []Sink, size int) *output {
+	o := &output{
+		sinks:   sinks,
+		entries: make(chan *domain.Entry, size),
+		done:    make(chan struct{}),
+		failed:  make(chan struct{}),
+	}
+	go o.run()
+	return o
+}
+
+// run writes the entries until the queue is closed, dropping them after a sink fails
+func (o *output) run() {
+	defer close(o.done)
+	for e := range o.entries {
+		if o.err != nil {
+			continue
+		}
+		for _, s := range o.sinks {
+			if err := s.Write(e); err != nil {
+				o.err = errors.Wrap(err, "could not write the logs")
+				close(o.failed)
+				break
+			}
+		}
+	}
+}
+
+// failure returns the error of the sink that failed, if any
+func (o *output) failure() error {
+	select {
+	case <-o.failed:
+		return o.err
+	default:
+		return nil
+	}
+}
+
+// write queues the entry, blocking while the queue is full
+func (o *output) write(ctx context.Context, e *domain.Entry) error {
+	if err := o.failure(); err != nil {
+		return err
+	}
+	select {
+	case o.entries <- e:
+		return nil
+	case <-o.failed:
+		return o.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close waits for the queued entries to be written and closes the sinks
+func (o *output) close() error {
+	close(o.entries)
+	<-o.done
+	err := o.err
+	for _, s := range o.sinks {
+		if cerr := s.Close(); cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "could not close the output")
+		}
+	}
+	return err
+}
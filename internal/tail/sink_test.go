@@ -0,0 +1,176 @@
+package tail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// memorySink keeps the entries written to it, optionally failing or waiting on each write
+type memorySink struct {
+	entries []*domain.Entry
+	delay   time.Duration
+	err     error
+	closed  bool
+}
+
+func (s *memorySink) Write(e *domain.Entry) error {
+	time.Sleep(s.delay)
+	if s.err != nil {
+		return s.err
+	}
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+// newSinkQuery queries the indices of the test connector since 2018-10-11, holding a, c, d and e
+func newSinkQuery() *domain.Query {
+	q := newStopQuery()
+	after := date("2018-10-11T00:00")
+	q.AfterDateTime = &after
+	return q
+}
+
+func TestStart_sinks(t *testing.T) {
+	q := newSinkQuery()
+	q.Refresh = 0
+	q.Grep = "message [ce]"
+
+	var buf bytes.Buffer
+	mem := &memorySink{}
+	c := newTestConnector(t)
+	defer c.Close()
+	tl := New(logrus.WithFields(nil), c, WithSinks(NewWriterSink(&buf, false), mem))
+	assert.Nil(t, tl.Start(q))
+
+	assert.Equal(t, "message c\nmessage e\n", buf.String())
+	assert.True(t, mem.closed)
+	if assert.Len(t, mem.entries, 2) {
+		e := mem.entries[0]
+		assert.Equal(t, "c", e.ID)
+		assert.Equal(t, "logstash-2018.10.11", e.Index)
+		assert.Equal(t, domain.EntryLog, e.Kind)
+		assert.Equal(t, "message c", e.Source["message"])
+		assert.Equal(t, [][]int{{0, 9}}, e.Matches)
+	}
+}
+
+func TestStart_formatterAndFilters(t *testing.T) {
+	q := newSinkQuery()
+	q.Refresh = 0
+
+	var buf bytes.Buffer
+	c := newTestConnector(t)
+	defer c.Close()
+	tl := New(logrus.WithFields(nil), c,
+		WithSinks(NewWriterSink(&buf, false)),
+		WithFormatter(FormatterFunc(func(e *domain.Entry) (string, error) {
+			return e.Index + " " + e.ID, nil
+		})),
+		WithFilters(FilterFunc(func(e *domain.Entry) (bool, error) {
+			return e.ID != "d", nil
+		})),
+	)
+	assert.Nil(t, tl.Start(q))
+	assert.Equal(t, "logstash-2018.10.11 a\nlogstash-2018.10.11 c\nlogstash-2018.10.12 e\n", buf.String())
+}
+
+func TestStart_slowSink(t *testing.T) {
+	q := newSinkQuery()
+	q.Refresh = 0
+	q.Reverse = true
+
+	// every entry is written before start returns, in order, even when the sink is slower than the tailing
+	mem := &memorySink{delay: 5 * time.Millisecond}
+	c := newTestConnector(t)
+	defer c.Close()
+	tl := New(logrus.WithFields(nil), c, WithSinks(mem))
+	assert.Nil(t, tl.Start(q))
+	assert.Equal(t, []string{"e", "d", "c", "a"}, []string{mem.entries[0].ID, mem.entries[1].ID, mem.entries[2].ID, mem.entries[3].ID})
+}
+
+func TestStart_sinkError(t *testing.T) {
+	q := newSinkQuery()
+
+	mem := &memorySink{err: errors.New("disk full")}
+	c := newTestConnector(t)
+	defer c.Close()
+	tl := New(logrus.WithFields(nil), c, WithSinks(mem))
+	err := tl.Start(q)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "disk full")
+	}
+	assert.True(t, mem.closed)
+}
+
+func TestOutput_backpressure(t *testing.T) {
+	release := make(chan struct{})
+	o := newOutput([]Sink{&blockingSink{release}}, 1)
+
+	// the first entry is taken by the writer, the second fills the queue and the third blocks
+	ctx := context.Background()
+	assert.Nil(t, o.write(ctx, &domain.Entry{}))
+	assert.Nil(t, o.write(ctx, &domain.Entry{}))
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, o.write(timeout, &domain.Entry{}))
+
+	close(release)
+	assert.Nil(t, o.close())
+}
+
+// blockingSink blocks every write until it is released
+type blockingSink struct {
+	release chan struct{}
+}
+
+func (s *blockingSink) Write(e *domain.Entry) error {
+	<-s.release
+	return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elklogs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.log")
+
+	for _, line := range []string{"first", "second"} {
+		s, err := NewFileSink(path, Rotation{}, nil)
+		assert.Nil(t, err)
+		assert.Nil(t, s.Write(&domain.Entry{Line: line, Matches: [][]int{{0, 1}}}))
+		assert.Nil(t, s.Close())
+	}
+
+	b, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "first\nsecond\n", string(b))
+}
+
+func TestFormattedSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewFormattedSink(&buf, JSONFormatter)
+
+	e, err := NewEntry(entry("a", "logstash-2018.10.11", "2018-10-11T08:00"))
+	assert.Nil(t, err)
+	e.Line = "rendered"
+	assert.Nil(t, s.Write(e))
+	assert.Nil(t, s.Write(&domain.Entry{Kind: domain.EntrySeparator, Line: groupSeparator}))
+	assert.Equal(t, `{"@timestamp":"2018-10-11T08:00:00Z","message":"message a"}`+"\n", buf.String())
+}
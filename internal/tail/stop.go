@@ -0,0 +1,141 @@
+package tail
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrTimeout is returned when the query timeout is reached before any other stop condition
+	ErrTimeout = errors.New("timeout reached")
+	// ErrMatched is returned when the until pattern matches and matches are configured as failures
+	ErrMatched = errors.New("failure pattern matched")
+	// ErrNotMatched is returned when the logs end without matching the until pattern, unless matches are failures
+	ErrNotMatched = errors.New("until pattern not matched")
+
+	// errDone signals that a successful stop condition was reached
+	errDone = errors.New("done")
+)
+
+// stopConditions tracks the conditions that end the tailing
+type stopConditions struct {
+	untilRegexp *regexp.Regexp
+	untilQuery  string
+	untilIDs    map[string]bool
+	failOnMatch bool
+
+	maxLines int
+	printed  int
+}
+
+// newStopConditions parses the stop conditions of the query.
+// The until pattern is a regular expression on the printed line when enclosed in slashes (/pattern/) and a query string otherwise.
+func newStopConditions(query *domain.Query) (*stopConditions, error) {
+	s := &stopConditions{
+		failOnMatch: query.FailOnMatch,
+		maxLines:    query.MaxLines,
+	}
+
+	until := query.UntilMatch
+	if len(until) > 1 && strings.HasPrefix(until, "/") && strings.HasSuffix(until, "/") {
+		r, err := regexp.Compile(until[1 : len(until)-1])
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid until pattern: %s", until))
+		}
+		s.untilRegexp = r
+	} else {
+		s.untilQuery = until
+	}
+	return s, nil
+}
+
+// waitsForMatch checks if the tailing only succeeds once the until pattern matches
+func (s *stopConditions) waitsForMatch() bool {
+	return (s.untilRegexp != nil || s.untilQuery != "") && !s.failOnMatch
+}
+
+// matchUntil checks which of the logs also match the until query, so they can be detected when printed
+func (t *Tail) matchUntil(ctx context.Context, query *domain.Query, indices []string, entries []*domain.Entry) error {
+	if t.stop == nil || t.stop.untilQuery == "" || len(entries) == 0 {
+		return nil
+	}
+
+	q := fmt.Sprintf("(%s)", t.stop.untilQuery)
+	if query.Query != "" {
+		q = fmt.Sprintf("(%s) AND %s", query.Query, q)
+	}
+
+	// any new log that matches is within the newest matches, since there are as many new logs as entries at most
+	matches, err := t.connector.ExecuteQuery(ctx, indices, timestampField, false, q, query.Entries)
+	if err != nil {
+		return errors.Wrap(err, "could not fetch until matches")
+	}
+	t.logger.WithFields(logrus.Fields{"query": q, "matches": len(matches)}).Debug("until matches fetched")
+
+	t.stop.untilIDs = make(map[string]bool, len(matches))
+	for _, m := range matches {
+		t.stop.untilIDs[m.ID] = true
+	}
+	return nil
+}
+
+// printLogs prints the entries in the requested order, checking the stop conditions after each line
+func (t *Tail) printLogs(ctx context.Context, query *domain.Query, indices []string, entries []*domain.Entry) error {
+	if t.multiline != nil {
+		entries = t.multiline.group(entries)
+	}
+	if !query.Reverse {
+		for i := len(entries) - 1; i >= 0; i-- {
+			if err := t.printLog(ctx, query, indices, entries[i]); err != nil {
+				return err
+			}
+		}
+	} else {
+		for i := 0; i < len(entries); i++ {
+			if err := t.printLog(ctx, query, indices, entries[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// printLog prints a single entry along with its surrounding logs, returning errDone or ErrMatched if it ends the tailing
+func (t *Tail) printLog(ctx context.Context, query *domain.Query, indices []string, e *domain.Entry) error {
+	if query.ContextBefore > 0 || query.ContextAfter > 0 {
+		if err := t.printSurrounded(ctx, query, indices, e); err != nil {
+			return err
+		}
+	} else if err := t.out.write(ctx, e); err != nil {
+		return err
+	}
+	if query.CorrelateBy != "" {
+		if err := t.printCorrelated(ctx, query, e); err != nil {
+			return err
+		}
+	}
+	if t.stop == nil {
+		return nil
+	}
+	t.stop.printed++
+
+	if (t.stop.untilRegexp != nil && t.stop.untilRegexp.MatchString(e.Line)) || t.stop.untilIDs[e.ID] {
+		t.logger.WithFields(logrus.Fields{"id": e.ID}).Debug("until pattern matched")
+		if t.stop.failOnMatch {
+			return ErrMatched
+		}
+		return errDone
+	}
+
+	if t.stop.maxLines > 0 && t.stop.printed >= t.stop.maxLines {
+		t.logger.WithFields(logrus.Fields{"lines": t.stop.printed}).Debug("max lines printed")
+		return errDone
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package tail
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const pattern = "logstash-[0-9].*"
+
+func newStopQuery() *domain.Query {
+	return &domain.Query{
+		IndexPattern: pattern,
+		Entries:      10,
+		Refresh:      time.Millisecond,
+		Format:       "%message",
+		FormatFields: []string{"%message"},
+	}
+}
+
+func TestStart_maxLines(t *testing.T) {
+	q := newStopQuery()
+	q.MaxLines = 1
+
+	c := newTestConnector(t)
+	defer c.Close()
+	var buf bytes.Buffer
+	tl := New(logrus.WithFields(nil), c, WithSinks(NewWriterSink(&buf, false)))
+	assert.Nil(t, tl.Start(q))
+	assert.Equal(t, "message d\n", buf.String())
+}
+
+func TestStart_untilRegexp(t *testing.T) {
+	q := newStopQuery()
+	q.UntilMatch = "/message [d]$/"
+
+	c := newTestConnector(t)
+	defer c.Close()
+	var buf bytes.Buffer
+	tl := New(logrus.WithFields(nil), c, WithSinks(NewWriterSink(&buf, false)))
+	assert.Nil(t, tl.Start(q))
+	assert.Equal(t, "message d\n", buf.String())
+
+	q.FailOnMatch = true
+	tl = New(logrus.WithFields(nil), c, WithSinks(NewWriterSink(&bytes.Buffer{}, false)))
+	assert.Equal(t, ErrMatched, tl.Start(q))
+}
+
+func TestStart_untilQuery(t *testing.T) {
+	q := newStopQuery()
+	q.UntilMatch = `message:"message e"`
+
+	c := newTestConnector(t)
+	defer c.Close()
+	var buf bytes.Buffer
+	tl := New(logrus.WithFields(nil), c, WithSinks(NewWriterSink(&buf, false)))
+	assert.Nil(t, tl.Start(q))
+	assert.Equal(t, "message d\nmessage e\n", buf.String())
+}
+
+func TestStart_untilNotMatched(t *testing.T) {
+	q := newStopQuery()
+	q.Refresh = 0
+	q.UntilMatch = "/never/"
+
+	c := newTestConnector(t)
+	defer c.Close()
+	var buf bytes.Buffer
+	tl := New(logrus.WithFields(nil), c, WithSinks(NewWriterSink(&buf, false)))
+	assert.Equal(t, ErrNotMatched, tl.Start(q))
+	assert.Equal(t, "message d\nmessage e\n", buf.String())
+
+	// not matching a failure pattern succeeds
+	q.FailOnMatch = true
+	tl = New(logrus.WithFields(nil), c, WithSinks(NewWriterSink(&bytes.Buffer{}, false)))
+	assert.Nil(t, tl.Start(q))
+}
+
+func TestStart_timeout(t *testing.T) {
+	q := newStopQuery()
+	q.UntilMatch = "/never/"
+	q.Timeout = 20 * time.Millisecond
+
+	c := newTestConnector(t)
+	defer c.Close()
+	var buf bytes.Buffer
+	tl := New(logrus.WithFields(nil), c, WithSinks(NewWriterSink(&buf, false)))
+	assert.Equal(t, ErrTimeout, tl.Start(q))
+	assert.Equal(t, "message d\nmessage e\n", buf.String())
+}
+
+func TestStart_invalidUntil(t *testing.T) {
+	q := newStopQuery()
+	q.UntilMatch = "/[/"
+
+	c := newTestConnector(t)
+	defer c.Close()
+	var buf bytes.Buffer
+	tl := New(logrus.WithFields(nil), c, WithSinks(NewWriterSink(&buf, false)))
+	assert.NotNil(t, tl.Start(q))
+	assert.Empty(t, buf.String())
+}
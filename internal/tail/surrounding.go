@@ -0,0 +1,138 @@
+package tail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+)
+
+// markers used when printing the surrounding logs of a match
+const (
+	matchMarker    = "> "
+	contextMarker  = "  "
+	groupSeparator = "--"
+)
+
+// surrounding keeps track of the surrounding logs already printed
+type surrounding struct {
+	groups int
+	seen   map[string]bool // logs printed in the previous group, which can overlap with the next one
+}
+
+// printSurrounded prints the entry marked as a match along with the logs before and after it
+func (t *Tail) printSurrounded(ctx context.Context, query *domain.Query, indices []string, e *domain.Entry) error {
+	before, after, err := t.fetchSurrounding(ctx, query, indices, e)
+	if err != nil {
+		return err
+	}
+
+	// before is sorted newest first and after oldest first
+	older := make([]*domain.LogEntry, 0, len(before))
+	for i := len(before) - 1; i >= 0; i-- {
+		older = append(older, before[i])
+	}
+	newer := after
+	if query.Reverse {
+		older, newer = make([]*domain.LogEntry, 0, len(after)), before
+		for i := len(after) - 1; i >= 0; i-- {
+			older = append(older, after[i])
+		}
+	}
+
+	if t.surrounding == nil {
+		t.surrounding = &surrounding{}
+	}
+	if t.surrounding.groups > 0 {
+		if err := t.out.write(ctx, &domain.Entry{Kind: domain.EntrySeparator, Line: groupSeparator}); err != nil {
+			return err
+		}
+	}
+	t.surrounding.groups++
+
+	seen := make(map[string]bool, len(older)+len(newer)+1)
+	printContext := func(logs []*domain.LogEntry) error {
+		for _, l := range logs {
+			if t.surrounding.seen[l.ID] || seen[l.ID] {
+				continue
+			}
+			seen[l.ID] = true
+			c, err := t.render(l, domain.EntryContext)
+			if err != nil {
+				return errors.Wrap(err, "could not process surrounding logs")
+			}
+			c.Line = contextMarker + c.Line
+			if err := t.out.write(ctx, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := printContext(older); err != nil {
+		return err
+	}
+	seen[e.ID] = true
+	if err := t.out.write(ctx, marked(e)); err != nil {
+		return err
+	}
+	if err := printContext(newer); err != nil {
+		return err
+	}
+	t.surrounding.seen = seen
+	return nil
+}
+
+// marked returns a copy of the entry with the match marker, shifting its grep matches
+func marked(e *domain.Entry) *domain.Entry {
+	m := *e
+	m.Line = matchMarker + e.Line
+	m.Matches = make([][]int, 0, len(e.Matches))
+	for _, r := range e.Matches {
+		m.Matches = append(m.Matches, []int{r[0] + len(matchMarker), r[1] + len(matchMarker)})
+	}
+	return &m
+}
+
+// fetchSurrounding retrieves the logs right before (newest first) and after (oldest first) the entry,
+// sharing the value of the context field with it
+func (t *Tail) fetchSurrounding(ctx context.Context, query *domain.Query, indices []string, e *domain.Entry) ([]*domain.LogEntry, []*domain.LogEntry, error) {
+	if e.Timestamp.IsZero() {
+		return nil, nil, errors.New("could not find the log timestamp")
+	}
+	date := e.Timestamp.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+
+	var scope string
+	if query.ContextBy != "" {
+		value, err := evaluateExpression(e.Source, query.ContextBy)
+		if err == nil {
+			scope = fmt.Sprintf(`%s:"%s" AND `, query.ContextBy, escapeQueryValue(value))
+		}
+	}
+
+	var before, after []*domain.LogEntry
+	var err error
+	if query.ContextBefore > 0 {
+		q := fmt.Sprintf(`%s%s:[* TO "%s"}`, scope, timestampField, date)
+		if before, err = t.connector.ExecuteQuery(ctx, indices, timestampField, false, q, query.ContextBefore); err != nil {
+			return nil, nil, errors.Wrap(err, "could not fetch the logs before the match")
+		}
+	}
+	if query.ContextAfter > 0 {
+		q := fmt.Sprintf(`%s%s:{"%s" TO *]`, scope, timestampField, date)
+		if after, err = t.connector.ExecuteQuery(ctx, indices, timestampField, true, q, query.ContextAfter); err != nil {
+			return nil, nil, errors.Wrap(err, "could not fetch the logs after the match")
+		}
+	}
+	t.logger.WithFields(logrus.Fields{"id": e.ID, "scope": scope, "before": len(before), "after": len(after)}).Debug("surrounding logs fetched")
+
+	return before, after, nil
+}
+
+// escapeQueryValue escapes a value to be used as a quoted query string term
+func escapeQueryValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
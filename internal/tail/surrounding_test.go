@@ -0,0 +1,44 @@
+package tail
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchSurrounding(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	for id, ts := range map[string]string{"c1": "2018-10-11T07:00", "c2": "2018-10-11T09:00", "c3": "2018-10-11T09:30", "c4": "2018-10-11T11:00", "c5": "2018-10-11T12:00"} {
+		c.Add(id, date(ts), map[string]interface{}{"message": "message c"})
+	}
+	match, _ := NewEntry(entry("c", "logstash-2018.10.11", "2018-10-11T10:00"))
+
+	// the surrounding logs share the message of the match, the nearest first
+	tl := New(logrus.WithFields(nil), c)
+	q := &domain.Query{ContextBefore: 2, ContextAfter: 1, ContextBy: "message"}
+	before, after, err := tl.fetchSurrounding(context.Background(), q, []string{"logstash-2018.10.11"}, match)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c3", "c2"}, ids(before))
+	assert.Equal(t, []string{"c4"}, ids(after))
+}
+
+func TestFetchSurrounding_unscoped(t *testing.T) {
+	c := newTestConnector(t)
+	defer c.Close()
+	match, _ := NewEntry(entry("c", "logstash-2018.10.11", "2018-10-11T10:00"))
+
+	tl := New(logrus.WithFields(nil), c)
+	q := &domain.Query{ContextBefore: 1, ContextBy: "missing"}
+	_, after, err := tl.fetchSurrounding(context.Background(), q, []string{"logstash-2018.10.11"}, match)
+	assert.Nil(t, err)
+	assert.Nil(t, after)
+	assert.Equal(t, []string{`@timestamp:[* TO "2018-10-11T10:00:00.000Z"}`}, c.executed)
+}
+
+func TestEscapeQueryValue(t *testing.T) {
+	assert.Equal(t, `a \"b\" \\c`, escapeQueryValue(`a "b" \c`))
+}
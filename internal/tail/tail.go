@@ -2,6 +2,7 @@ package tail
 
 import (
 	"context"
+	"os"
 	"time"
 
 	"github.com/pkg/errors"
@@ -16,50 +17,163 @@ type Connector interface {
 	ExecuteQuery(ctx context.Context, indices []string, timestampField string, order bool, query string, entries int) ([]*domain.LogEntry, error)
 }
 
+// CountConnector is a connector that also counts the logs matching a query within a time range
+type CountConnector interface {
+	Connector
+	Count(ctx context.Context, indices []string, timestampField string, query string, after *time.Time, before *time.Time) (int64, error)
+}
+
 // Tail is a structure that holds data necessary to perform tailing
 type Tail struct {
 	logger    *logrus.Entry
 	connector Connector
 
-	lastID string
+	sinks        []Sink
+	extraFilters []Filter
+	formatOption Formatter // formatter set with WithFormatter, the query format is used when nil
+
+	lastID      string
+	formatter   Formatter
+	out         *output
+	stop        *stopConditions
+	grep        *grepFilter
+	multiline   *multiline
+	surrounding *surrounding
+
+	correlated   map[string]bool // correlation values already printed
+	traceIndices []string
+}
+
+// OptionFunc is a function that configures the Tail
+type OptionFunc func(*Tail)
+
+// WithSinks sets the sinks the logs are written to, instead of the standard output
+func WithSinks(sinks ...Sink) OptionFunc {
+	return func(t *Tail) {
+		t.sinks = sinks
+	}
+}
+
+// WithFilters adds filters applied to the logs after the grep filter
+func WithFilters(filters ...Filter) OptionFunc {
+	return func(t *Tail) {
+		t.extraFilters = append(t.extraFilters, filters...)
+	}
+}
+
+// WithFormatter sets the formatter of the logs, instead of the query format
+func WithFormatter(formatter Formatter) OptionFunc {
+	return func(t *Tail) {
+		t.formatOption = formatter
+	}
 }
 
 // New creates a new Tail
-func New(logger *logrus.Entry, connector Connector) *Tail {
+func New(logger *logrus.Entry, connector Connector, options ...OptionFunc) *Tail {
 	t := &Tail{
 		logger:    logger,
 		connector: connector,
 	}
+	for _, option := range options {
+		option(t)
+	}
 
 	return t
 }
 
-// Start starts tailing logs
-func (t *Tail) Start(query *domain.Query) error {
+// Start starts tailing logs, writing them to the sinks which are closed when it returns
+func (t *Tail) Start(query *domain.Query) (err error) {
+	stop, err := newStopConditions(query)
+	if err != nil {
+		return err
+	}
+	t.stop = stop
+
+	if err = t.Reset(query); err != nil {
+		return err
+	}
+
+	multiline, err := newMultiline(query)
+	if err != nil {
+		return err
+	}
+	t.multiline = multiline
+
+	ctx := context.Background()
+	if query.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, query.Timeout)
+		defer cancel()
+	}
+
+	sinks := t.sinks
+	if len(sinks) == 0 {
+		sinks = []Sink{NewWriterSink(os.Stdout, query.Highlight)}
+	}
+	t.out = newOutput(sinks, outputQueue)
+	defer func() {
+		if cerr := t.out.close(); cerr != nil && (err == nil || err == ErrMatched) {
+			err = cerr
+		}
+	}()
+
+	err = t.run(ctx, query)
+	t.logger.WithFields(logrus.Fields{"filtered": t.grep.filtered}).Debug("logs filtered on the client")
+	switch {
+	case err == errDone:
+		return nil
+	case err != nil && ctx.Err() == context.DeadlineExceeded:
+		return ErrTimeout
+	case err == nil && t.stop.waitsForMatch():
+		// without following, the logs can end before the until pattern matched
+		return ErrNotMatched
+	}
+	return err
+}
+
+// Indices returns the indices to query, based on the index pattern and date filters of the query
+func (t *Tail) Indices(ctx context.Context, query *domain.Query) ([]string, error) {
 	// get cluster indices
-	indices, err := t.connector.GetIndexNames(context.Background())
+	indices, err := t.connector.GetIndexNames(ctx)
 	if err != nil {
-		return errors.Wrap(err, "could not fetch available indices")
+		return nil, errors.Wrap(err, "could not fetch available indices")
 	}
 	t.logger.WithFields(logrus.Fields{"indices": indices}).Debug("indices fetched")
 
 	// filter indices based on query date filters
 	indices, err = FilterIndex(indices, query.IndexPattern, query.AfterDateTime, query.BeforeDateTime)
 	if err != nil {
-		return errors.Wrap(err, "could not filter indices")
+		return nil, errors.Wrap(err, "could not filter indices")
 	}
 	t.logger.WithFields(logrus.Fields{"indices": indices}).Debug("indices filtered")
+	return indices, nil
+}
+
+// run fetches the indices and tails the logs until an error or a stop condition
+func (t *Tail) run(ctx context.Context, query *domain.Query) error {
+	indices, err := t.Indices(ctx, query)
+	if err != nil {
+		return err
+	}
 
 	// execute
-	if err = t.loop(query, indices); err != nil {
+	if err = t.loop(ctx, query, indices); err != nil {
 		return err
 	}
 
 	// tail the logs
 	for query.Refresh != 0 {
 		// refresh timer
-		time.Sleep(query.Refresh)
-		if err = t.loop(query, indices); err != nil {
+		select {
+		case <-time.After(query.Refresh):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err = t.loop(ctx, query, indices); err != nil {
+			return err
+		}
+		// a sink can fail after the last entry was queued
+		if err = t.out.failure(); err != nil {
 			return err
 		}
 	}
@@ -68,45 +182,31 @@ func (t *Tail) Start(query *domain.Query) error {
 }
 
 // loop retrieves logs from the database, processes them and prints them
-func (t *Tail) loop(query *domain.Query, indices []string) error {
+func (t *Tail) loop(ctx context.Context, query *domain.Query, indices []string) error {
+	if query.Parallel > 0 && len(indices) > 1 {
+		return t.parallelLoop(ctx, query, indices)
+	}
+
 	// retrieve logs from the host
-	logs, err := t.connector.ExecuteQuery(context.Background(), indices, timestampField, false, query.Query, query.Entries)
+	logs, err := t.connector.ExecuteQuery(ctx, indices, timestampField, false, query.Query, query.Entries)
 	if err != nil {
 		return errors.Wrap(err, "could not fetch logs")
 	}
 	t.logger.WithFields(logrus.Fields{"indices": indices, "query": query.Query, "entries": query.Entries, "logs": len(logs)}).Debug("logs fetched")
 
 	// process logs
-	entries, err := t.processLogs(query, logs)
+	filtered := t.grep.filtered
+	entries, err := t.processLogs(logs)
 	if err != nil {
 		return errors.Wrap(err, "could not process logs")
 	}
-	t.logger.WithFields(logrus.Fields{"logs": len(entries)}).Debug("logs processed")
+	t.logger.WithFields(logrus.Fields{"logs": len(entries), "filtered": t.grep.filtered - filtered}).Debug("logs processed")
 
-	// print logs
-	printLogs(entries, query.Reverse)
-	return nil
-}
-
-// processLogs processes json messages and returns the log entries according to the provided format
-func (t *Tail) processLogs(query *domain.Query, logs []*domain.LogEntry) ([]string, error) {
-	entries := make([]string, 0, len(logs))
-	for _, log := range logs {
-		if log.ID == t.lastID {
-			return entries, nil
-		}
-
-		s, err := processEntry(log, query.ShowTime, query.Format, query.FormatFields)
-		if err != nil {
-			return nil, err
-		}
-		entries = append(entries, s)
-	}
-
-	// we need to keep track of the ID of the last message to remove duplicates between loops
-	if t.lastID == "" {
-		t.lastID = logs[0].ID
+	// check which of the new logs match the stop query
+	if err := t.matchUntil(ctx, query, indices, entries); err != nil {
+		return err
 	}
 
-	return entries, nil
+	// print logs
+	return t.printLogs(ctx, query, indices, entries)
 }
@@ -0,0 +1,139 @@
+// Package tailtest provides a connector serving the logs added by tests. The logs are written as search hits
+// to a temporary file queried by the file connector, so queries and time ranges have the semantics of the
+// query string instead of being matched by each test.
+package tailtest
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/fileconn"
+)
+
+// TimestampField is the field holding the timestamp of the logs added
+const TimestampField = "@timestamp"
+
+// Connector serves the logs added to it, and fails the calls set with Fail
+type Connector struct {
+	files *fileconn.Files
+	dir   string
+
+	mu   sync.Mutex
+	out  *os.File
+	logs int
+	fail int // calls left to fail, all of them when negative
+	err  error
+}
+
+// New creates a connector without logs. Close removes its file.
+func New(t testing.TB) *Connector {
+	dir, err := ioutil.TempDir("", "tailtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "logs.json")
+	out, err := os.Create(name)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	files, err := fileconn.New(name, fileconn.Config{})
+	if err != nil {
+		out.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return &Connector{files: files, dir: dir, out: out}
+}
+
+// Add appends a log with the fields and the timestamp, in the daily logstash index of the timestamp.
+// The logs without an id are numbered in the order they are added, from 0.
+func (c *Connector) Add(id string, ts time.Time, fields map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id == "" {
+		id = strconv.Itoa(c.logs)
+	}
+	c.logs++
+
+	source := map[string]interface{}{TimestampField: ts.Format(time.RFC3339Nano)}
+	for k, v := range fields {
+		source[k] = v
+	}
+	raw, err := json.Marshal(source)
+	if err != nil {
+		panic(err)
+	}
+	line, err := json.Marshal(map[string]interface{}{
+		"_index":  ts.UTC().Format(fileconn.DefaultIndexFormat),
+		"_id":     id,
+		"_source": json.RawMessage(raw),
+	})
+	if err != nil {
+		panic(err)
+	}
+	if _, err := c.out.Write(append(line, '\n')); err != nil {
+		panic(err)
+	}
+}
+
+// Fail makes the next n calls fail with the error, or all of them until Fail is called again if n is negative
+func (c *Connector) Fail(n int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fail, c.err = n, err
+}
+
+// failed returns the error of a call set to fail
+func (c *Connector) failed() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail == 0 {
+		return nil
+	}
+	if c.fail > 0 {
+		c.fail--
+	}
+	return c.err
+}
+
+// Close removes the file of the logs
+func (c *Connector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.out.Close()
+	c.files.Close()
+	return os.RemoveAll(c.dir)
+}
+
+// GetIndexNames returns the indices of the logs added
+func (c *Connector) GetIndexNames(ctx context.Context) ([]string, error) {
+	if err := c.failed(); err != nil {
+		return nil, err
+	}
+	return c.files.GetIndexNames(ctx)
+}
+
+// ExecuteQuery returns the logs of the indices matching the query, as the file connector
+func (c *Connector) ExecuteQuery(ctx context.Context, indices []string, timestampField string, order bool, query string, entries int) ([]*domain.LogEntry, error) {
+	if err := c.failed(); err != nil {
+		return nil, err
+	}
+	return c.files.ExecuteQuery(ctx, indices, timestampField, order, query, entries)
+}
+
+// Count counts the logs of the indices matching the query within the time range, as the file connector
+func (c *Connector) Count(ctx context.Context, indices []string, timestampField string, query string, after *time.Time, before *time.Time) (int64, error) {
+	if err := c.failed(); err != nil {
+		return 0, err
+	}
+	return c.files.Count(ctx, indices, timestampField, query, after, before)
+}
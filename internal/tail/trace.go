@@ -0,0 +1,153 @@
+package tail
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/sirupsen/logrus"
+)
+
+// indentation of the correlated logs printed under a log
+const correlatedIndent = "    "
+
+// Tracer formats the logs of a trace, relative to its first log and indented by service
+type Tracer struct {
+	serviceField string
+	format       string
+	fields       []string
+
+	first    time.Time
+	services map[string]int // depth of each service, in order of appearance
+	last     string         // service of the previous line
+}
+
+// NewTracer creates a tracer grouping the logs by the service field, printing them with the format
+func NewTracer(serviceField string, format string) *Tracer {
+	if format == "" {
+		format = "%message"
+	}
+	return &Tracer{
+		serviceField: serviceField,
+		format:       format,
+		fields:       GetFields(format),
+		services:     make(map[string]int),
+	}
+}
+
+// Line formats the log, which must be newer than the previous ones
+func (r *Tracer) Line(log *domain.LogEntry) (string, error) {
+	var entry map[string]interface{}
+	if err := json.Unmarshal(*log.Message, &entry); err != nil {
+		return "", err
+	}
+
+	ts := log.Timestamp
+	if ts.IsZero() {
+		value, err := evaluateExpression(entry, timestampField)
+		if err != nil {
+			return "", errors.Wrap(err, "could not find the log timestamp")
+		}
+		if ts, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			return "", errors.Wrap(err, "could not parse the log timestamp")
+		}
+	}
+	if r.first.IsZero() {
+		r.first = ts
+	}
+
+	service, _ := evaluateExpression(entry, r.serviceField)
+	if service == "" {
+		service = "-"
+	}
+	depth, ok := r.services[service]
+	if !ok {
+		depth = len(r.services)
+		r.services[service] = depth
+	}
+
+	// the service is only named on the first of its consecutive lines
+	label := service
+	if service == r.last {
+		label = strings.Repeat(" ", len(service))
+	}
+	r.last = service
+
+	message, err := processEntry(log, false, r.format, r.fields, false)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%10s  %s%s  %s", formatOffset(ts.Sub(r.first)), strings.Repeat("  ", depth), label, message), nil
+}
+
+// Services returns the number of services seen
+func (r *Tracer) Services() int {
+	return len(r.services)
+}
+
+// formatOffset formats the time since the first log of the trace
+func formatOffset(d time.Duration) string {
+	return fmt.Sprintf("%+.3fs", d.Seconds())
+}
+
+// TraceIndices returns the indices to search for correlated logs, all the indices matching the pattern
+// unless the query is date filtered
+func (t *Tail) TraceIndices(ctx context.Context, query *domain.Query) ([]string, error) {
+	if query.AfterDateTime != nil || query.BeforeDateTime != nil {
+		return t.Indices(ctx, query)
+	}
+	indices, err := t.connector.GetIndexNames(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not fetch available indices")
+	}
+	return MatchIndex(indices, query.IndexPattern), nil
+}
+
+// CorrelationQuery returns the query string matching the logs with the value of the field
+func CorrelationQuery(field string, value string) string {
+	return fmt.Sprintf(`%s:"%s"`, field, escapeQueryValue(value))
+}
+
+// printCorrelated prints the logs sharing the correlation field with the log, once per value
+func (t *Tail) printCorrelated(ctx context.Context, query *domain.Query, e *domain.Entry) error {
+	value, err := evaluateExpression(e.Source, query.CorrelateBy)
+	if err != nil || value == "" || t.correlated[value] {
+		return nil
+	}
+	if t.correlated == nil {
+		t.correlated = make(map[string]bool)
+	}
+	t.correlated[value] = true
+
+	if t.traceIndices == nil {
+		if t.traceIndices, err = t.TraceIndices(ctx, query); err != nil {
+			return err
+		}
+	}
+	logs, err := t.connector.ExecuteQuery(ctx, t.traceIndices, timestampField, true, CorrelationQuery(query.CorrelateBy, value), query.Entries)
+	if err != nil {
+		return errors.Wrap(err, "could not fetch the correlated logs")
+	}
+	t.logger.WithFields(logrus.Fields{"field": query.CorrelateBy, "value": value, "logs": len(logs)}).Debug("correlated logs fetched")
+
+	tracer := NewTracer(query.ServiceField, query.Format)
+	for _, l := range logs {
+		line, err := tracer.Line(l)
+		if err != nil {
+			return errors.Wrap(err, "could not process the correlated logs")
+		}
+		c, err := NewEntry(l)
+		if err != nil {
+			return errors.Wrap(err, "could not process the correlated logs")
+		}
+		c.Kind, c.Line = domain.EntryCorrelated, correlatedIndent+line
+		if err := t.out.write(ctx, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
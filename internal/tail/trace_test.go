@@ -0,0 +1,45 @@
+package tail_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/stretchr/testify/assert"
+)
+
+func span(ts string, service string, message string) *domain.LogEntry {
+	t, _ := time.Parse(time.RFC3339Nano, ts)
+	b, _ := json.Marshal(map[string]interface{}{"@timestamp": ts, "service": map[string]string{"name": service}, "message": message})
+	m := json.RawMessage(b)
+	return &domain.LogEntry{Timestamp: t, Message: &m}
+}
+
+func TestTracer(t *testing.T) {
+	r := tail.NewTracer("service.name", "")
+	var lines []string
+	for _, l := range []*domain.LogEntry{
+		span("2018-10-10T10:00:00.000Z", "gateway", "GET /orders"),
+		span("2018-10-10T10:00:00.012Z", "orders", "loading order"),
+		span("2018-10-10T10:00:00.015Z", "orders", "order loaded"),
+		span("2018-10-10T10:00:01.250Z", "gateway", "200 OK"),
+	} {
+		line, err := r.Line(l)
+		assert.Nil(t, err)
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, []string{
+		"   +0.000s  gateway  GET /orders",
+		"   +0.012s    orders  loading order",
+		"   +0.015s            order loaded",
+		"   +1.250s  gateway  200 OK",
+	}, lines)
+	assert.Equal(t, 2, r.Services())
+}
+
+func TestCorrelationQuery(t *testing.T) {
+	assert.Equal(t, `trace.id:"4bf92f\"35"`, tail.CorrelationQuery("trace.id", `4bf92f"35`))
+}
@@ -0,0 +1,235 @@
+package ui
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ansi escape codes used to draw the screen
+const (
+	enterScreen  = "\x1b[?1049h\x1b[?25l"
+	exitScreen   = "\x1b[?25h\x1b[?1049l"
+	cursorHome   = "\x1b[H"
+	clearLine    = "\x1b[K"
+	clearBelow   = "\x1b[J"
+	reverseStart = "\x1b[7m"
+	boldStart    = "\x1b[1m"
+	styleEnd     = "\x1b[0m"
+)
+
+// names of the keys that are not printable
+const (
+	keyUp        = "<up>"
+	keyDown      = "<down>"
+	keyLeft      = "<left>"
+	keyRight     = "<right>"
+	keyPageUp    = "<pgup>"
+	keyPageDown  = "<pgdown>"
+	keyHome      = "<home>"
+	keyEnd       = "<end>"
+	keyEnter     = "<enter>"
+	keyEscape    = "<esc>"
+	keyBackspace = "<backspace>"
+	keyCtrlC     = "<ctrl-c>"
+)
+
+// escape sequences of the special keys
+var sequences = []struct {
+	seq string
+	key string
+}{
+	{"\x1b[A", keyUp}, {"\x1bOA", keyUp},
+	{"\x1b[B", keyDown}, {"\x1bOB", keyDown},
+	{"\x1b[C", keyRight}, {"\x1bOC", keyRight},
+	{"\x1b[D", keyLeft}, {"\x1bOD", keyLeft},
+	{"\x1b[5~", keyPageUp}, {"\x1b[6~", keyPageDown},
+	{"\x1b[H", keyHome}, {"\x1bOH", keyHome}, {"\x1b[1~", keyHome},
+	{"\x1b[F", keyEnd}, {"\x1bOF", keyEnd}, {"\x1b[4~", keyEnd},
+}
+
+// Run shows the browser full screen until it is quit, refreshing the logs on the query refresh interval
+func (b *Browser) Run(ctx context.Context, in *os.File, out io.Writer) error {
+	fd := int(in.Fd())
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer terminal.Restore(fd, state)
+	fmt.Fprint(out, enterScreen)
+	defer fmt.Fprint(out, exitScreen)
+
+	keys := make(chan []string)
+	go readKeys(in, keys)
+
+	if err := b.requery(ctx); err != nil {
+		b.status = err.Error()
+	}
+	refresh := b.query.Refresh
+	if refresh <= 0 {
+		refresh = time.Second
+	}
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for !b.quit {
+		width, height, err := terminal.GetSize(fd)
+		if err != nil || width <= 0 || height <= 0 {
+			width, height = 80, 24
+		}
+		draw(out, b.Render(width, height))
+
+		select {
+		case ks, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, k := range ks {
+				b.HandleKey(ctx, k)
+			}
+		case <-ticker.C:
+			if err := b.refresh(ctx); err != nil {
+				b.status = err.Error()
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// draw writes the lines over the previous screen
+func draw(out io.Writer, lines []string) {
+	var buf bytes.Buffer
+	buf.WriteString(cursorHome)
+	for i, l := range lines {
+		if i > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString(l)
+		buf.WriteString(clearLine)
+	}
+	buf.WriteString(clearBelow)
+	out.Write(buf.Bytes())
+}
+
+// readKeys reads the key presses from the terminal until it is closed
+func readKeys(in io.Reader, keys chan<- []string) {
+	defer close(keys)
+	buf := make([]byte, 256)
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			keys <- parseKeys(buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// parseKeys splits the input read from the terminal in keys
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		if b[0] == 0x1b {
+			key, size := keyEscape, 1
+			for _, s := range sequences {
+				if bytes.HasPrefix(b, []byte(s.seq)) {
+					key, size = s.key, len(s.seq)
+					break
+				}
+			}
+			keys = append(keys, key)
+			b = b[size:]
+			continue
+		}
+
+		switch b[0] {
+		case '\r', '\n':
+			keys = append(keys, keyEnter)
+		case 0x7f, 0x08:
+			keys = append(keys, keyBackspace)
+		case 0x03:
+			keys = append(keys, keyCtrlC)
+		default:
+			r, size := utf8.DecodeRune(b)
+			if r >= ' ' {
+				keys = append(keys, string(r))
+			}
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// columnWidths returns the width of each column, the last one taking the rest of the line
+func columnWidths(header []string, rows [][]string) []int {
+	const maxWidth = 40
+	widths := make([]int, len(header))
+	for i, h := range header {
+		widths[i] = utf8.RuneCountInString(h)
+	}
+	for _, r := range rows {
+		for i, v := range r {
+			if i < len(widths) && utf8.RuneCountInString(v) > widths[i] {
+				widths[i] = utf8.RuneCountInString(v)
+			}
+		}
+	}
+	for i := range widths {
+		if widths[i] > maxWidth {
+			widths[i] = maxWidth
+		}
+	}
+	return widths
+}
+
+// formatRow aligns the values to the column widths
+func formatRow(values []string, widths []int) string {
+	cells := make([]string, len(values))
+	for i, v := range values {
+		if i < len(widths)-1 {
+			v = pad(truncate(v, widths[i]), widths[i])
+		}
+		cells[i] = v
+	}
+	return strings.Join(cells, "  ")
+}
+
+// truncate cuts the line to the width
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	if width <= 1 {
+		return string(r[:width])
+	}
+	return string(r[:width-1]) + "…"
+}
+
+// pad fills the line with spaces up to the width
+func pad(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return truncate(s, width)
+}
+
+func reverse(s string) string {
+	return reverseStart + s + styleEnd
+}
+
+func bold(s string) string {
+	return boldStart + s + styleEnd
+}
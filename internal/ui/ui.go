@@ -0,0 +1,467 @@
+package ui
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+)
+
+// mode is the current input mode of the browser
+type mode int
+
+const (
+	modeNormal mode = iota
+	modeQuery
+	modeRange
+	modeColumns
+)
+
+// prompts shown while editing
+var prompts = map[mode]string{
+	modeQuery:   "query: ",
+	modeRange:   "range: ",
+	modeColumns: "columns: ",
+}
+
+// maxPages is the number of pages of logs kept loaded, the logs farthest from the selected one being dropped
+const maxPages = 20
+
+// help is shown in the footer when there is no status message
+const help = "↑↓ move  pgup load older  enter detail  space pause  / query  t range  c columns  1-9 toggle column  r reload  q quit"
+
+// column is a field shown in the log list
+type column struct {
+	field  string
+	hidden bool
+}
+
+// Browser is the state of the interactive log browser
+type Browser struct {
+	logger *logrus.Entry
+	tail   *tail.Tail
+	query  *domain.Query
+	window string // time range as typed, in the form start..end
+	now    func() time.Time
+
+	indices  []string
+	logs     []*domain.LogEntry // oldest first
+	seen     map[string]bool
+	maxLogs  int  // logs kept loaded
+	dropped  bool // the newest logs were dropped, so following starts over
+	selected int
+	offset   int
+	follow   bool // keep the newest log selected
+	paused   bool
+	detail   bool
+	columns  []*column
+	height   int // height of the log list in the last render
+
+	mode   mode
+	input  string
+	status string
+	quit   bool
+}
+
+// New creates a browser for the query, showing the fields as columns
+func New(logger *logrus.Entry, connector tail.Connector, query *domain.Query, window string, fields []string) *Browser {
+	b := &Browser{
+		logger: logger,
+		tail:   tail.New(logger, connector),
+		query:  query,
+		window: window,
+		now:    time.Now,
+		follow: true,
+		height: 10,
+	}
+	b.maxLogs = maxPages * query.Entries
+	b.setColumns(fields)
+	return b
+}
+
+// setColumns replaces the columns of the log list
+func (b *Browser) setColumns(fields []string) {
+	b.columns = b.columns[:0]
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			b.columns = append(b.columns, &column{field: f})
+		}
+	}
+}
+
+// requery applies the query and time range, loading the logs again
+func (b *Browser) requery(ctx context.Context) error {
+	var start, end *time.Time
+	var err error
+	if strings.TrimSpace(b.window) != "" {
+		if start, end, err = tail.ParseRange(b.window, b.now()); err != nil {
+			return err
+		}
+	}
+	b.query.AfterDateTime, b.query.BeforeDateTime = start, end
+
+	if b.indices, err = b.tail.Indices(ctx, b.query); err != nil {
+		return err
+	}
+	if err = b.tail.Reset(b.query); err != nil {
+		return err
+	}
+	b.logs, b.seen = nil, make(map[string]bool)
+	b.selected, b.offset, b.follow, b.dropped = 0, 0, true, false
+	return b.fetch(ctx)
+}
+
+// refresh appends the new logs, unless paused. The logs are loaded again when the newest ones were dropped.
+func (b *Browser) refresh(ctx context.Context) error {
+	if b.paused || b.indices == nil {
+		return nil
+	}
+	if b.dropped {
+		return b.requery(ctx)
+	}
+	return b.fetch(ctx)
+}
+
+// fetch appends the logs newer than the ones loaded
+func (b *Browser) fetch(ctx context.Context) error {
+	logs, err := b.tail.Fetch(ctx, b.query, b.indices)
+	if err != nil {
+		return err
+	}
+	for _, l := range logs {
+		if !b.seen[l.ID] {
+			b.seen[l.ID] = true
+			b.logs = append(b.logs, l)
+		}
+	}
+	if b.follow && len(b.logs) > 0 {
+		b.selected = len(b.logs) - 1
+	}
+	b.trim()
+	return nil
+}
+
+// older prepends a page of logs older than the oldest one loaded
+func (b *Browser) older(ctx context.Context) error {
+	if len(b.logs) == 0 {
+		return nil
+	}
+	logs, err := b.tail.Older(ctx, b.query, b.indices, b.logs[0])
+	if err != nil {
+		return err
+	}
+	added := make([]*domain.LogEntry, 0, len(logs))
+	for _, l := range logs {
+		if !b.seen[l.ID] {
+			b.seen[l.ID] = true
+			added = append(added, l)
+		}
+	}
+	if len(added) == 0 {
+		b.status = "no older logs"
+		return nil
+	}
+	b.logs = append(added, b.logs...)
+	b.selected += len(added)
+	b.offset += len(added)
+	b.logger.WithFields(logrus.Fields{"logs": len(added)}).Debug("older logs loaded")
+	b.trim()
+	return nil
+}
+
+// trim drops the logs beyond the ones kept loaded from the end farthest from the selected log.
+// Dropping the newest logs pauses the browser, which loads the latest logs again when resumed.
+func (b *Browser) trim() {
+	excess := len(b.logs) - b.maxLogs
+	if b.maxLogs <= 0 || excess <= 0 {
+		return
+	}
+	if b.selected >= len(b.logs)-1-b.selected {
+		for _, l := range b.logs[:excess] {
+			delete(b.seen, l.ID)
+		}
+		b.logs = b.logs[excess:]
+		b.selected -= excess
+		if b.offset -= excess; b.offset < 0 {
+			b.offset = 0
+		}
+	} else {
+		for _, l := range b.logs[b.maxLogs:] {
+			delete(b.seen, l.ID)
+		}
+		b.logs = b.logs[:b.maxLogs]
+		b.follow, b.paused, b.dropped = false, true, true
+		b.status = "newest logs dropped, space resumes from the latest"
+	}
+	if b.selected < 0 {
+		b.selected = 0
+	}
+	b.logger.WithFields(logrus.Fields{"logs": excess}).Debug("logs dropped")
+}
+
+// HandleKey updates the browser for a key press
+func (b *Browser) HandleKey(ctx context.Context, key string) {
+	var err error
+	if b.mode != modeNormal {
+		err = b.handleInput(ctx, key)
+	} else {
+		b.status = ""
+		err = b.handleNormal(ctx, key)
+	}
+	if err != nil {
+		b.status = err.Error()
+	}
+}
+
+// handleNormal handles the navigation keys
+func (b *Browser) handleNormal(ctx context.Context, key string) error {
+	last := len(b.logs) - 1
+	switch key {
+	case "q", keyCtrlC:
+		b.quit = true
+	case keyUp, "k":
+		if b.selected == 0 {
+			return b.older(ctx)
+		}
+		b.selected--
+		b.follow = false
+	case keyDown, "j":
+		if b.selected < last {
+			b.selected++
+		}
+		b.follow = b.selected >= last
+	case keyPageUp:
+		if b.selected == 0 {
+			return b.older(ctx)
+		}
+		b.selected -= b.height
+		if b.selected < 0 {
+			b.selected = 0
+		}
+		b.follow = false
+	case keyPageDown:
+		b.selected += b.height
+		if b.selected >= last {
+			b.selected = last
+		}
+		b.follow = b.selected >= last
+	case keyHome, "g":
+		b.selected, b.follow = 0, false
+	case keyEnd, "G":
+		b.selected, b.follow = last, true
+	case keyEnter:
+		b.detail = !b.detail
+	case " ", "p":
+		b.paused = !b.paused
+		return b.refresh(ctx)
+	case "r":
+		return b.requery(ctx)
+	case "/":
+		b.mode, b.input = modeQuery, b.query.Query
+	case "t":
+		b.mode, b.input = modeRange, b.window
+	case "c":
+		fields := make([]string, 0, len(b.columns))
+		for _, c := range b.columns {
+			fields = append(fields, c.field)
+		}
+		b.mode, b.input = modeColumns, strings.Join(fields, ",")
+	default:
+		if n, err := strconv.Atoi(key); err == nil && n >= 1 && n <= len(b.columns) {
+			b.columns[n-1].hidden = !b.columns[n-1].hidden
+		}
+	}
+	if b.selected < 0 {
+		b.selected = 0
+	}
+	return nil
+}
+
+// handleInput handles the keys while editing the query, range or columns
+func (b *Browser) handleInput(ctx context.Context, key string) error {
+	switch key {
+	case keyEscape, keyCtrlC:
+		b.mode = modeNormal
+	case keyBackspace:
+		if r := []rune(b.input); len(r) > 0 {
+			b.input = string(r[:len(r)-1])
+		}
+	case keyEnter:
+		m := b.mode
+		b.mode = modeNormal
+		switch m {
+		case modeQuery:
+			b.query.Query = b.input
+			return b.requery(ctx)
+		case modeRange:
+			previous := b.window
+			b.window = b.input
+			if err := b.requery(ctx); err != nil {
+				b.window = previous
+				return err
+			}
+		case modeColumns:
+			b.setColumns(strings.Split(b.input, ","))
+		}
+	default:
+		// ignore the named keys
+		if len([]rune(key)) == 1 {
+			b.input += key
+		}
+	}
+	return nil
+}
+
+// Render draws the browser into lines of the screen size
+func (b *Browser) Render(width int, height int) []string {
+	lines := make([]string, 0, height)
+	lines = append(lines, reverse(pad(b.header(), width)))
+
+	// split the screen between the list and the detail pane
+	list := height - 3
+	var detail []string
+	if b.detail && b.selected < len(b.logs) {
+		list = (height - 3) / 2
+		detail = b.document(b.logs[b.selected], height-4-list)
+	}
+	if list < 1 {
+		list = 1
+	}
+	b.height = list
+
+	// keep the selected log visible
+	if b.selected < b.offset {
+		b.offset = b.selected
+	}
+	if b.selected >= b.offset+list {
+		b.offset = b.selected - list + 1
+	}
+
+	visible := b.visibleColumns()
+	rows := make([][]string, 0, list)
+	for i := b.offset; i < len(b.logs) && i < b.offset+list; i++ {
+		rows = append(rows, b.row(b.logs[i], visible))
+	}
+	widths := columnWidths(visible, rows)
+	lines = append(lines, bold(truncate(formatRow(visible, widths), width)))
+	for i, r := range rows {
+		line := truncate(formatRow(r, widths), width)
+		if b.offset+i == b.selected {
+			line = reverse(pad(line, width))
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < list+2 {
+		lines = append(lines, "")
+	}
+
+	if detail != nil {
+		lines = append(lines, strings.Repeat("─", width))
+		for _, l := range detail {
+			lines = append(lines, truncate(l, width))
+		}
+		for len(lines) < height-1 {
+			lines = append(lines, "")
+		}
+	}
+
+	lines = append(lines, truncate(b.footer(), width))
+	return lines
+}
+
+// header describes the query being browsed
+func (b *Browser) header() string {
+	state := "LIVE"
+	switch {
+	case b.paused:
+		state = "PAUSED"
+	case !b.follow:
+		state = "SCROLL"
+	}
+	window := b.window
+	if window == "" || window == ".." {
+		window = "latest index"
+	}
+	query := b.query.Query
+	if query == "" {
+		query = "*"
+	}
+	return fmt.Sprintf(" %s | query: %s | range: %s | %d logs", state, query, window, len(b.logs))
+}
+
+// footer shows the input being edited, the status message or the help
+func (b *Browser) footer() string {
+	if b.mode != modeNormal {
+		return prompts[b.mode] + b.input + "█"
+	}
+	if b.status != "" {
+		return b.status
+	}
+	return help
+}
+
+// visibleColumns returns the numbered names of the columns, or nil when all of them are hidden
+func (b *Browser) visibleColumns() []string {
+	var names []string
+	for i, c := range b.columns {
+		if !c.hidden {
+			names = append(names, fmt.Sprintf("%d:%s", i+1, c.field))
+		}
+	}
+	return names
+}
+
+// row returns the values of the visible columns of the log, or the whole message without columns
+func (b *Browser) row(log *domain.LogEntry, visible []string) []string {
+	if len(visible) == 0 {
+		return []string{sanitize(string(*log.Message))}
+	}
+	values := make([]string, 0, len(visible))
+	for _, c := range b.columns {
+		if c.hidden {
+			continue
+		}
+		// fields missing from the log are left empty
+		v, _ := tail.FieldValue(log.Message, c.field)
+		values = append(values, sanitize(strings.TrimSpace(v)))
+	}
+	return values
+}
+
+// sanitize replaces the line breaks and tabs of a value with spaces and strips the other control characters,
+// so logs cannot move the cursor or change the terminal with escape sequences
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// document returns the indented json of the log, limited to the number of lines
+func (b *Browser) document(log *domain.LogEntry, lines int) []string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, *log.Message, "", "  "); err != nil {
+		return []string{sanitize(string(*log.Message))}
+	}
+	result := strings.Split(fmt.Sprintf("%s/%s\n%s", log.Index, log.ID, buf.String()), "\n")
+	if lines >= 0 && len(result) > lines {
+		result = result[:lines]
+	}
+	for i, l := range result {
+		result[i] = sanitize(l)
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail/tailtest"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// add adds a log of the host at the minute
+func add(c *tailtest.Connector, id string, minute int, host string) {
+	c.Add(id, time.Date(2018, 10, 10, 10, minute, 0, 0, time.UTC), map[string]interface{}{"host": host, "message": "message " + id})
+}
+
+func newBrowser(c *tailtest.Connector) *Browser {
+	b := New(logrus.WithFields(nil), c, &domain.Query{IndexPattern: "logstash-[0-9].*", Entries: 2}, "", []string{"host", "message"})
+	b.now = func() time.Time { return time.Date(2018, 10, 10, 12, 0, 0, 0, time.UTC) }
+	return b
+}
+
+func TestParseKeys(t *testing.T) {
+	assert.Equal(t, []string{keyUp, "j", keyPageUp, keyEnter, keyEscape, "é", keyBackspace}, parseKeys([]byte("\x1b[Aj\x1b[5~\r\x1bé\x7f")))
+}
+
+func TestBrowser_follow(t *testing.T) {
+	c := tailtest.New(t)
+	defer c.Close()
+	add(c, "a", 1, "web-1")
+	add(c, "b", 2, "web-2")
+	b := newBrowser(c)
+	assert.Nil(t, b.requery(context.Background()))
+	assert.Equal(t, 1, b.selected)
+
+	// new logs keep the newest selected until the selection moves up
+	add(c, "c", 3, "web-1")
+	assert.Nil(t, b.refresh(context.Background()))
+	assert.Len(t, b.logs, 3)
+	assert.Equal(t, 2, b.selected)
+
+	b.HandleKey(context.Background(), keyUp)
+	add(c, "d", 4, "web-1")
+	assert.Nil(t, b.refresh(context.Background()))
+	assert.Equal(t, 1, b.selected)
+
+	// paused browsers do not fetch logs
+	b.HandleKey(context.Background(), " ")
+	add(c, "e", 5, "web-1")
+	assert.Nil(t, b.refresh(context.Background()))
+	assert.Len(t, b.logs, 4)
+}
+
+func TestBrowser_older(t *testing.T) {
+	c := tailtest.New(t)
+	defer c.Close()
+	add(c, "a", 1, "web-1")
+	add(c, "b", 2, "web-2")
+	add(c, "c", 3, "web-1")
+	b := newBrowser(c)
+	assert.Nil(t, b.requery(context.Background()))
+
+	// moving up from the oldest log loads the previous page
+	b.HandleKey(context.Background(), "g")
+	b.HandleKey(context.Background(), keyUp)
+	assert.Equal(t, []string{"a", "b", "c"}, ids(b.logs))
+	assert.Equal(t, 1, b.selected)
+}
+
+func TestBrowser_trim(t *testing.T) {
+	c := tailtest.New(t)
+	defer c.Close()
+	add(c, "a", 1, "web-1")
+	add(c, "b", 2, "web-2")
+	add(c, "c", 3, "web-1")
+	b := newBrowser(c)
+	b.maxLogs = 3
+	assert.Nil(t, b.requery(context.Background()))
+	assert.Equal(t, []string{"b", "c"}, ids(b.logs))
+
+	// following drops the oldest logs
+	add(c, "d", 4, "web-1")
+	add(c, "e", 5, "web-1")
+	assert.Nil(t, b.refresh(context.Background()))
+	assert.Equal(t, []string{"c", "d", "e"}, ids(b.logs))
+	assert.Equal(t, 2, b.selected)
+
+	// paging back drops the newest logs and pauses, resuming loads the latest logs again
+	b.HandleKey(context.Background(), "g")
+	b.HandleKey(context.Background(), keyUp)
+	assert.Equal(t, []string{"b", "c", "d"}, ids(b.logs))
+	assert.Equal(t, 1, b.selected)
+	assert.True(t, b.paused)
+	b.HandleKey(context.Background(), " ")
+	assert.Equal(t, []string{"d", "e"}, ids(b.logs))
+	assert.Equal(t, 1, b.selected)
+}
+
+func TestBrowser_row(t *testing.T) {
+	c := tailtest.New(t)
+	defer c.Close()
+	b := newBrowser(c)
+
+	// control characters cannot reach the terminal
+	m := json.RawMessage(`{"host":"web\u001b[2J-1","message":"a\n\tb\u0007"}`)
+	l := &domain.LogEntry{ID: "a", Message: &m}
+	assert.Equal(t, []string{"web[2J-1", "a  b"}, b.row(l, b.visibleColumns()))
+	assert.NotContains(t, strings.Join(b.document(l, -1), "\n"), "\x1b")
+}
+
+func TestBrowser_editQuery(t *testing.T) {
+	c := tailtest.New(t)
+	defer c.Close()
+	add(c, "a", 1, "web-1")
+	add(c, "b", 2, "web-2")
+	add(c, "c", 70, "web-1")
+	add(c, "d", 80, "web-2")
+	b := newBrowser(c)
+	assert.Nil(t, b.requery(context.Background()))
+
+	for _, k := range []string{"/", "h", "o", "s", "t", ":", "w", "e", "b", "-", "1", keyEnter, "t", keyBackspace, keyBackspace, "-", "1", "h", ".", ".", keyEnter} {
+		b.HandleKey(context.Background(), k)
+	}
+	assert.Equal(t, "", b.status)
+	assert.Equal(t, "host:web-1", b.query.Query)
+	assert.Equal(t, "-1h..", b.window)
+	assert.Equal(t, []string{"c"}, ids(b.logs))
+
+	// invalid ranges are reported and discarded
+	for _, k := range []string{"t", "x", keyEnter} {
+		b.HandleKey(context.Background(), k)
+	}
+	assert.Contains(t, b.status, "invalid date")
+	assert.Equal(t, "-1h..", b.window)
+}
+
+func TestBrowser_Render(t *testing.T) {
+	c := tailtest.New(t)
+	defer c.Close()
+	add(c, "a", 1, "web-1")
+	add(c, "b", 2, "web-2")
+	b := newBrowser(c)
+	assert.Nil(t, b.requery(context.Background()))
+
+	lines := b.Render(60, 8)
+	assert.Len(t, lines, 8)
+	assert.Contains(t, lines[0], "LIVE | query: * | range: latest index | 2 logs")
+	assert.Equal(t, bold("1:host  2:message"), lines[1])
+	assert.Equal(t, "web-1   message a", lines[2])
+	assert.Equal(t, reverse(pad("web-2   message b", 60)), lines[3])
+	assert.Equal(t, truncate(help, 60), lines[7])
+
+	// hide the host column and show the selected document
+	b.HandleKey(context.Background(), "1")
+	b.HandleKey(context.Background(), keyEnter)
+	lines = b.Render(60, 12)
+	assert.Len(t, lines, 12)
+	assert.Equal(t, bold("2:message"), lines[1])
+	assert.Equal(t, reverse(pad("message b", 60)), lines[3])
+	assert.Equal(t, strings.Repeat("─", 60), lines[6])
+	assert.Equal(t, "logstash-2018.10.10/b", lines[7])
+	assert.Equal(t, "{", lines[8])
+}
+
+func ids(logs []*domain.LogEntry) []string {
+	result := make([]string, 0, len(logs))
+	for _, l := range logs {
+		result = append(result, l.ID)
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package elklogs
+
+import (
+	"context"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/elasticconn"
+	"github.com/pmdcosta/elklogs/internal/fileconn"
+	"github.com/pmdcosta/elklogs/internal/tail"
+)
+
+// SearchRequest describes a search of the logs matching a query string
+type SearchRequest struct {
+	Indices        []string
+	TimestampField string
+	Ascending      bool // oldest entries first, newest first otherwise
+	Query          string
+	Size           int
+}
+
+// Connector abstracts the database holding the logs
+type Connector interface {
+	Close() error
+	IndexNames(ctx context.Context) ([]string, error)
+	Search(ctx context.Context, req SearchRequest) ([]*Entry, error)
+}
+
+// NewElasticConnector connects to an elasticsearch cluster, the user and password are optional
+func NewElasticConnector(url string, user string, password string) (Connector, error) {
+	c, err := elasticconn.New(url, user, password)
+	if err != nil {
+		return nil, err
+	}
+	return &engineConnector{c}, nil
+}
+
+// NewFileConnector queries the json logs of the files matching the glob pattern, one document per line,
+// which may be gzipped. The documents are the logs or search hits with their _index, _id and _source.
+// The logs without an index are in the daily logstash-2006.01.02 index of their @timestamp.
+// A subset of the query string syntax is supported, and the files are read again as they grow.
+func NewFileConnector(pattern string) (Connector, error) {
+	f, err := fileconn.New(pattern, fileconn.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return &engineConnector{f}, nil
+}
+
+// engineConnector exposes a connector of the tail engine as a Connector
+type engineConnector struct {
+	db tail.Connector
+}
+
+func (c *engineConnector) Close() error {
+	return c.db.Close()
+}
+
+func (c *engineConnector) IndexNames(ctx context.Context) ([]string, error) {
+	return c.db.GetIndexNames(ctx)
+}
+
+func (c *engineConnector) Search(ctx context.Context, req SearchRequest) ([]*Entry, error) {
+	logs, err := c.db.ExecuteQuery(ctx, req.Indices, req.TimestampField, req.Ascending, req.Query, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, len(logs))
+	for _, l := range logs {
+		entries = append(entries, newEntry(l))
+	}
+	return entries, nil
+}
+
+// tailConnector adapts a Connector to the tail engine
+type tailConnector struct {
+	Connector
+}
+
+func (c tailConnector) GetIndexNames(ctx context.Context) ([]string, error) {
+	return c.IndexNames(ctx)
+}
+
+func (c tailConnector) ExecuteQuery(ctx context.Context, indices []string, timestampField string, order bool, query string, entries int) ([]*domain.LogEntry, error) {
+	result, err := c.Search(ctx, SearchRequest{Indices: indices, TimestampField: timestampField, Ascending: order, Query: query, Size: entries})
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]*domain.LogEntry, 0, len(result))
+	for _, e := range result {
+		logs = append(logs, e.logEntry())
+	}
+	return logs, nil
+}
@@ -0,0 +1,27 @@
+// Package elklogs embeds the elklogs tail engine in Go programs.
+//
+// A Client streams the log entries matching a Query from a Connector, such as the elasticsearch
+// cluster returned by NewElasticConnector or the exported files of NewFileConnector:
+//
+//	conn, err := elklogs.NewElasticConnector("http://localhost:9200", "", "")
+//	if err != nil {
+//		return err
+//	}
+//	client := elklogs.New(conn)
+//	entries, errs := client.Stream(ctx, elklogs.NewQuery("level:error").Since(time.Hour).Follow(time.Second))
+//	for e := range entries {
+//		fmt.Println(e.Field("message"))
+//	}
+//	return <-errs
+//
+// Entries can be rendered with a Formatter, using the same %field templates as the command line.
+//
+// The API of this package is versioned independently of the command line, as Version.
+// Within a major version exported identifiers are not removed and their behavior does not change
+// incompatibly: new functions, methods, options and struct fields may be added in minor versions,
+// so struct values should be built with field names. The Connector and Formatter interfaces only change
+// in major versions. Packages under internal/ are not covered and may change at any time.
+package elklogs
+
+// Version is the semantic version of the package API
+const Version = "1.1.0"
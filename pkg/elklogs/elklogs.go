@@ -0,0 +1,116 @@
+package elklogs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+	"github.com/sirupsen/logrus"
+)
+
+// Client streams the logs of a connector
+type Client struct {
+	connector Connector
+	logger    *logrus.Entry
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithLogger sets the logger of the client, which discards its logs by default
+func WithLogger(logger *logrus.Entry) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// New creates a client for the connector
+func New(connector Connector, options ...Option) *Client {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	c := &Client{connector: connector, logger: logrus.NewEntry(l)}
+	for _, o := range options {
+		o(c)
+	}
+	return c
+}
+
+// Stream sends the entries matching the query, oldest first, until they are all sent or the context is done.
+// When following, new entries keep being sent on each refresh.
+// The entries channel is unbuffered, so entries are only fetched as fast as they are received.
+// At most one error is sent, and both channels are closed when the stream ends.
+func (c *Client) Stream(ctx context.Context, query *Query) (<-chan *Entry, <-chan error) {
+	entries := make(chan *Entry)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(entries)
+		if err := c.stream(ctx, query.build(time.Now()), query.allIndices, entries); err != nil && ctx.Err() == nil {
+			errs <- err
+		}
+	}()
+	return entries, errs
+}
+
+// Print writes the entries matching the query with the formatter, one per line, until the stream ends
+func (c *Client) Print(ctx context.Context, query *Query, w io.Writer, f Formatter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	entries, errs := c.Stream(ctx, query)
+	for e := range entries {
+		line, err := f.Format(e)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return <-errs
+}
+
+// stream fetches the entries with the tail engine
+func (c *Client) stream(ctx context.Context, q *domain.Query, allIndices bool, entries chan<- *Entry) error {
+	t := tail.New(c.logger, tailConnector{c.connector})
+	var indices []string
+	var err error
+	if allIndices {
+		indices, err = t.TraceIndices(ctx, q)
+	} else {
+		indices, err = t.Indices(ctx, q)
+	}
+	if err != nil {
+		return err
+	}
+	if err := t.Reset(q); err != nil {
+		return err
+	}
+
+	for {
+		logs, err := t.Fetch(ctx, q, indices)
+		if err != nil {
+			return err
+		}
+		for _, l := range logs {
+			select {
+			case entries <- newEntry(l):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if q.Refresh <= 0 {
+			return nil
+		}
+		select {
+		case <-time.After(q.Refresh):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package elklogs_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pmdcosta/elklogs/pkg/elklogs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_Stream_follow(t *testing.T) {
+	c := newMemoryConnector()
+	client := elklogs.New(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries, errs := client.Stream(ctx, elklogs.NewQuery("").Follow(time.Millisecond))
+
+	var ids []string
+	for len(ids) < 3 {
+		ids = append(ids, (<-entries).ID)
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+
+	// new entries are sent on the next refresh
+	c.add(&elklogs.Entry{ID: "4", Source: json.RawMessage(`{}`)})
+	assert.Equal(t, "4", (<-entries).ID)
+
+	// cancelling ends the stream without errors
+	cancel()
+	for range entries {
+	}
+	assert.Nil(t, <-errs)
+}
+
+func TestClient_Stream_error(t *testing.T) {
+	client := elklogs.New(newMemoryConnector())
+
+	entries, errs := client.Stream(context.Background(), elklogs.NewQuery("").Grep("("))
+	for range entries {
+	}
+	assert.NotNil(t, <-errs)
+}
+
+func TestNewFileConnector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elklogs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	logs := `{"@timestamp":"2018-11-28T10:00:00.000Z","level":"error","message":"a"}
+{"@timestamp":"2018-11-29T10:00:00.000Z","level":"info","message":"b"}
+{"_index":"logstash-2018.11.29","_id":"c","_source":{"@timestamp":"2018-11-29T11:00:00.000Z","level":"error","message":"c"}}
+`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "logs.ndjson"), []byte(logs), 0644))
+
+	c, err := elklogs.NewFileConnector(filepath.Join(dir, "*.ndjson"))
+	assert.Nil(t, err)
+	defer c.Close()
+	entries, errs := elklogs.New(c).Stream(context.Background(), elklogs.NewQuery("level:error").AllIndices())
+	var messages []string
+	for e := range entries {
+		m, _ := e.Field("message")
+		messages = append(messages, m)
+	}
+	assert.Nil(t, <-errs)
+	assert.Equal(t, []string{"a", "c"}, messages)
+
+	_, err = elklogs.NewFileConnector(filepath.Join(dir, "*.gz"))
+	assert.NotNil(t, err)
+}
+
+func TestQuery_Since(t *testing.T) {
+	var queries []string
+	c := &recordingConnector{memoryConnector: newMemoryConnector(), queries: &queries}
+	client := elklogs.New(c)
+
+	entries, errs := client.Stream(context.Background(), elklogs.NewQuery("level:error").Since(time.Hour))
+	for range entries {
+	}
+	assert.Nil(t, <-errs)
+	assert.Len(t, queries, 1)
+	assert.Contains(t, queries[0], `(level:error) AND @timestamp:["`)
+}
+
+func TestTemplateFormatter(t *testing.T) {
+	f, err := elklogs.TemplateFormatter("%level %missing %message")
+	assert.Nil(t, err)
+	line, err := f.Format(&elklogs.Entry{Source: json.RawMessage(`{"level":"error","message":"disk full"}`)})
+	assert.Nil(t, err)
+	assert.Equal(t, "error  disk full", line)
+
+	_, err = elklogs.TemplateFormatter("message")
+	assert.NotNil(t, err)
+}
+
+// recordingConnector records the query strings searched
+type recordingConnector struct {
+	*memoryConnector
+	queries *[]string
+}
+
+func (r *recordingConnector) Search(ctx context.Context, req elklogs.SearchRequest) ([]*elklogs.Entry, error) {
+	*r.queries = append(*r.queries, fmt.Sprint(req.Query))
+	return nil, nil
+}
@@ -0,0 +1,41 @@
+package elklogs
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+	"github.com/pmdcosta/elklogs/internal/tail"
+)
+
+// Entry is a log entry fetched from the database
+type Entry struct {
+	ID        string
+	Index     string
+	Timestamp time.Time // sort value of the entry, zero if unknown
+	Source    json.RawMessage
+}
+
+// Field returns the value of a field of the source, using dot syntax for nested fields
+func (e *Entry) Field(name string) (string, bool) {
+	v, err := tail.FieldValue(&e.Source, name)
+	if err != nil {
+		return "", false
+	}
+	return v, true
+}
+
+// newEntry converts a log entry of the tail engine
+func newEntry(l *domain.LogEntry) *Entry {
+	e := &Entry{ID: l.ID, Index: l.Index, Timestamp: l.Timestamp}
+	if l.Message != nil {
+		e.Source = *l.Message
+	}
+	return e
+}
+
+// logEntry converts an entry to the tail engine
+func (e *Entry) logEntry() *domain.LogEntry {
+	m := e.Source
+	return &domain.LogEntry{ID: e.ID, Index: e.Index, Timestamp: e.Timestamp, Message: &m}
+}
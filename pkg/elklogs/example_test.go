@@ -0,0 +1,108 @@
+package elklogs_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmdcosta/elklogs/pkg/elklogs"
+)
+
+// memoryConnector serves fixed entries of a single index, showing how to plug another database
+type memoryConnector struct {
+	mu      sync.Mutex
+	entries []*elklogs.Entry // newest first
+}
+
+func (m *memoryConnector) Close() error { return nil }
+
+func (m *memoryConnector) IndexNames(ctx context.Context) ([]string, error) {
+	return []string{"logstash-2018.10.10"}, nil
+}
+
+func (m *memoryConnector) Search(ctx context.Context, req elklogs.SearchRequest) ([]*elklogs.Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []*elklogs.Entry
+	for _, e := range m.entries {
+		// a tiny subset of the query string syntax
+		if level := strings.TrimPrefix(req.Query, "level:"); level != req.Query {
+			if v, _ := e.Field("level"); v != level {
+				continue
+			}
+		}
+		result = append(result, e)
+	}
+	if len(result) > req.Size {
+		result = result[:req.Size]
+	}
+	return result, nil
+}
+
+// add adds a newer entry, while the connector may be searched
+func (m *memoryConnector) add(e *elklogs.Entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append([]*elklogs.Entry{e}, m.entries...)
+}
+
+func newMemoryConnector() *memoryConnector {
+	var entries []*elklogs.Entry
+	for i, l := range []struct{ level, message string }{
+		{"error", "disk full"},
+		{"info", "request done"},
+		{"error", "connection refused"},
+	} {
+		ts := time.Date(2018, 10, 10, 10, 0, 3-i, 0, time.UTC)
+		source, _ := json.Marshal(map[string]string{"@timestamp": ts.Format(time.RFC3339), "level": l.level, "message": l.message})
+		entries = append(entries, &elklogs.Entry{ID: fmt.Sprint(3 - i), Index: "logstash-2018.10.10", Timestamp: ts, Source: source})
+	}
+	return &memoryConnector{entries: entries}
+}
+
+func ExampleClient_Stream() {
+	client := elklogs.New(newMemoryConnector())
+
+	entries, errs := client.Stream(context.Background(), elklogs.NewQuery("level:error").Limit(10))
+	for e := range entries {
+		message, _ := e.Field("message")
+		fmt.Println(e.ID, message)
+	}
+	if err := <-errs; err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// 1 connection refused
+	// 3 disk full
+}
+
+func ExampleClient_Print() {
+	client := elklogs.New(newMemoryConnector())
+
+	f, err := elklogs.TemplateFormatter("[%level] %message")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := client.Print(context.Background(), elklogs.NewQuery("").Grep("request|refused"), os.Stdout, f); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// [error] connection refused
+	// [info] request done
+}
+
+func ExampleFormatterFunc() {
+	upper := elklogs.FormatterFunc(func(e *elklogs.Entry) (string, error) {
+		message, _ := e.Field("message")
+		return strings.ToUpper(message), nil
+	})
+
+	line, _ := upper.Format(&elklogs.Entry{Source: json.RawMessage(`{"message":"disk full"}`)})
+	fmt.Println(line)
+	// Output: DISK FULL
+}
@@ -0,0 +1,43 @@
+package elklogs
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pmdcosta/elklogs/internal/tail"
+)
+
+// Formatter renders an entry as a line of text
+type Formatter interface {
+	Format(e *Entry) (string, error)
+}
+
+// FormatterFunc adapts a function to a Formatter
+type FormatterFunc func(e *Entry) (string, error)
+
+// Format calls the function
+func (f FormatterFunc) Format(e *Entry) (string, error) {
+	return f(e)
+}
+
+// TemplateFormatter renders the entries with a format of %field placeholders, such as "%@timestamp %message".
+// Fields missing from an entry are left empty.
+func TemplateFormatter(format string) (Formatter, error) {
+	fields := tail.GetFields(format)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid format, no fields found: %s", format)
+	}
+	return FormatterFunc(func(e *Entry) (string, error) {
+		source := json.RawMessage(e.Source)
+		lines, err := tail.ProcessLogs([]*json.RawMessage{&source}, false, format, fields)
+		if err != nil {
+			return "", err
+		}
+		return lines[0], nil
+	}), nil
+}
+
+// JSONFormatter renders the entries as their json source
+var JSONFormatter Formatter = FormatterFunc(func(e *Entry) (string, error) {
+	return string(e.Source), nil
+})
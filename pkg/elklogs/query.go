@@ -0,0 +1,100 @@
+package elklogs
+
+import (
+	"time"
+
+	"github.com/pmdcosta/elklogs/internal/domain"
+)
+
+// default query settings, matching the command line defaults
+const (
+	DefaultIndexPattern = "logstash-[0-9].*"
+	DefaultEntries      = 50
+)
+
+// Query is built by chaining its methods, starting from NewQuery
+type Query struct {
+	q          domain.Query
+	since      time.Duration
+	allIndices bool
+}
+
+// NewQuery creates a query for the logs matching the elasticsearch query string, all logs if empty
+func NewQuery(query string) *Query {
+	return &Query{q: domain.Query{
+		Query:        query,
+		IndexPattern: DefaultIndexPattern,
+		Entries:      DefaultEntries,
+	}}
+}
+
+// IndexPattern sets the regexp selecting the indices holding the logs
+func (q *Query) IndexPattern(pattern string) *Query {
+	q.q.IndexPattern = pattern
+	return q
+}
+
+// AllIndices searches all the indices matching the pattern when there is no time range,
+// instead of the latest one
+func (q *Query) AllIndices() *Query {
+	q.allIndices = true
+	return q
+}
+
+// After only matches logs after the time
+func (q *Query) After(t time.Time) *Query {
+	q.q.AfterDateTime, q.since = &t, 0
+	return q
+}
+
+// Before only matches logs before the time
+func (q *Query) Before(t time.Time) *Query {
+	q.q.BeforeDateTime = &t
+	return q
+}
+
+// Since only matches logs of the last duration, relative to the start of each stream
+func (q *Query) Since(d time.Duration) *Query {
+	q.q.AfterDateTime, q.since = nil, d
+	return q
+}
+
+// Limit sets the number of entries fetched, and on each refresh when following
+func (q *Query) Limit(entries int) *Query {
+	q.q.Entries = entries
+	return q
+}
+
+// Follow keeps streaming the new logs, polling on the refresh interval
+func (q *Query) Follow(refresh time.Duration) *Query {
+	q.q.Refresh = refresh
+	return q
+}
+
+// Grep only keeps the entries whose source matches the regexp
+func (q *Query) Grep(expr string) *Query {
+	q.q.Grep = expr
+	return q
+}
+
+// GrepInvert drops the entries whose source matches the regexp
+func (q *Query) GrepInvert(expr string) *Query {
+	q.q.GrepInvert = expr
+	return q
+}
+
+// GrepField applies the grep expressions to the field instead of the whole source
+func (q *Query) GrepField(field string) *Query {
+	q.q.GrepField = field
+	return q
+}
+
+// build returns the query of the tail engine, resolving the relative dates
+func (q *Query) build(now time.Time) *domain.Query {
+	query := q.q
+	if q.since > 0 {
+		after := now.Add(-q.since)
+		query.AfterDateTime = &after
+	}
+	return &query
+}